@@ -11,7 +11,10 @@ import (
 	"os/signal"
 	"runner-manager-backend/internal/config"
 	"runner-manager-backend/internal/infrastructure/logs"
+	"runner-manager-backend/internal/infrastructure/pubsub"
+	"runner-manager-backend/internal/infrastructure/ws"
 	"runner-manager-backend/internal/middleware"
+	"runner-manager-backend/internal/runners"
 	"runner-manager-backend/pkg/database"
 	"syscall"
 	"time"
@@ -27,8 +30,15 @@ import (
 	runnersV1 "runner-manager-backend/internal/runners/delivery/http"
 	runnersRepository "runner-manager-backend/internal/runners/repository"
 	runnersUseCase "runner-manager-backend/internal/runners/usecase"
+
+	eventsV1 "runner-manager-backend/internal/events/delivery/http"
+	eventsRepository "runner-manager-backend/internal/events/repository"
+	eventsUseCase "runner-manager-backend/internal/events/usecase"
 )
 
+// RollupInterval is how often the raw metrics are aggregated into the 1-minute and 1-hour rollups.
+const RollupInterval = time.Minute
+
 type App struct {
 	client *mongo.Client // Database connection.
 	gin    *gin.Engine   // Gin engine for the application.
@@ -54,20 +64,70 @@ func (app *App) Run() error {
 		c.String(http.StatusOK, "Hello Word 👋")
 	})
 
+	app.cfg.Metrics.SetDefaults()
+	app.cfg.Ctrls.SetDefaults()
+	app.cfg.Events.SetDefaults()
+
 	usersColl := app.client.Database(app.cfg.Database.Name).Collection("users")
-	metricsColl := app.client.Database(app.cfg.Database.Name).Collection("metrics")
+	ctrlsColl := app.client.Database(app.cfg.Database.Name).Collection("controllers")
+	runnersColl := app.client.Database(app.cfg.Database.Name).Collection("runners")
+	eventsColl := app.client.Database(app.cfg.Database.Name).Collection("events")
+	messagesColl := app.client.Database(app.cfg.Database.Name).Collection("ws_messages")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := ensureIndexes(ctx, ctrlsColl, runnersColl); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	if err := ensureEventsIndexes(ctx, eventsColl, app.cfg.Events); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	if err := migrateEmbeddedCtrls(ctx, usersColl, ctrlsColl, runnersColl); err != nil {
+		return fmt.Errorf("failed to migrate controllers: %w", err)
+	}
+	if app.cfg.PubSub.Driver == pubsub.DriverMongo {
+		if err := pubsub.EnsureIndexes(ctx, messagesColl); err != nil {
+			return fmt.Errorf("failed to create indexes: %w", err)
+		}
+	}
+	ps, err := pubsub.New(app.cfg.PubSub, messagesColl)
+	if err != nil {
+		return err
+	}
+	metricsColls, err := ensureMetricsCollections(ctx, app.client.Database(app.cfg.Database.Name), app.cfg.Metrics)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics collections: %w", err)
+	}
+	rollupsColl, err := ensureRollupsQueue(ctx, app.client.Database(app.cfg.Database.Name), metricsColls)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics collections: %w", err)
+	}
 
 	userRepo := userRepository.NewRepository(usersColl)
 	userUC := userUseCase.NewUseCase(userRepo, app.cfg)
 	userCTRL := userV1.NewHandlers(userUC)
 
-	ctrlRepo := ctrlRepository.NewRepository(usersColl)
+	ctrlRepo := ctrlRepository.NewRepository(ctrlsColl, runnersColl, metricsColls)
 	ctrlUC := ctrlUseCase.NewUseCase(userRepo, ctrlRepo, app.cfg)
-	ctrlCTRL := ctrlV1.NewHandlers(ctrlUC)
+	ctrlCTRL := ctrlV1.NewHandlers(ctrlUC, ps)
 
-	runnersRepo := runnersRepository.NewRepository(usersColl, metricsColl)
+	runnersRepo := runnersRepository.NewRepository(ctrlsColl, runnersColl, metricsColls, rollupsColl)
+	if err := migrateLegacyMetrics(ctx, app.client.Database(app.cfg.Database.Name), app.cfg.Metrics.RawRetention, runnersRepo.SaveMetrics); err != nil {
+		return fmt.Errorf("failed to migrate metrics: %w", err)
+	}
 	runnersUC := runnersUseCase.NewUseCase(userRepo, runnersRepo, app.cfg)
-	runnersCTRL := runnersV1.NewHandlers(runnersUC)
+	hub := ws.NewHub(ws.DefaultConfig())
+	runnersCTRL := runnersV1.NewHandlers(runnersUC, hub, ps)
+
+	eventsRepo := eventsRepository.NewRepository(eventsColl)
+	eventsUC := eventsUseCase.NewUseCase(eventsRepo, app.cfg)
+	eventsCTRL := eventsV1.NewHandlers(eventsUC, runnersCTRL.SendToUser)
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go rollupMetrics(jobsCtx, runnersUC)
+	go runnersCTRL.Listen(jobsCtx)
+	go ctrlCTRL.WatchStatus(jobsCtx)
 
 	userDomain := apiDomain.Group("/users")
 	userCTRL.UserRoutes(userDomain, app.cfg)
@@ -78,6 +138,18 @@ func (app *App) Run() error {
 	runnersDomain := apiDomain.Group("/runners")
 	runnersCTRL.RunnerRoutes(runnersDomain, app.cfg)
 
+	promDomain := apiDomain.Group("/v1")
+	runnersCTRL.PrometheusRoutes(promDomain, app.cfg, func(ctx context.Context, apiKey string) (*middleware.Data, error) {
+		user, err := userRepo.GetUserByApiKey(ctx, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		return &middleware.Data{UserID: user.ID.Hex(), Email: user.Email}, nil
+	})
+
+	eventsDomain := apiDomain.Group("/events")
+	eventsCTRL.EventRoutes(eventsDomain, app.cfg)
+
 	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
 	// Use a buffered channel to avoid missing signals as recommended for signal.Notify
 	quit := make(chan os.Signal, 1)
@@ -92,6 +164,8 @@ func (app *App) Run() error {
 	go func() {
 		<-quit
 		logs.Info("Server is shutting down...")
+		stopJobs()
+		hub.Close()
 
 		// Create a context with a timeout of 10 seconds for the server shutdown.
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -110,3 +184,21 @@ func (app *App) Run() error {
 	logs.InfoF("Starting server on port %s", app.cfg.Server.Port)
 	return server.ListenAndServe()
 }
+
+// rollupMetrics periodically aggregates the raw metrics into the rollup collections until ctx is canceled.
+func rollupMetrics(ctx context.Context, runnersUC runners.Usecase) {
+	ticker := time.NewTicker(RollupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := runnersUC.RollupMetrics(ctx); err != nil && ctx.Err() == nil {
+			logs.ErrorF("Failed to roll up metrics: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
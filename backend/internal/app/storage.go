@@ -0,0 +1,362 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"runner-manager-backend/internal/config"
+	"runner-manager-backend/internal/infrastructure/logs"
+	runnerEntities "runner-manager-backend/internal/runners/entities"
+	"time"
+)
+
+// legacyUser is the layout of the users documents with the controllers and their runners embedded.
+type legacyUser struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Ctrls []struct {
+		ID        primitive.ObjectID       `bson:"_id"`
+		Name      string                   `bson:"name"`
+		AdminURL  string                   `bson:"admin_url"`
+		CreatedAt time.Time                `bson:"created_at"`
+		UpdatedAt time.Time                `bson:"updated_at"`
+		Runners   []*runnerEntities.Runner `bson:"runners"`
+	} `bson:"ctrls"`
+}
+
+// ensureIndexes creates the indexes of the controllers and runners collections.
+func ensureIndexes(ctx context.Context, ctrlsColl, runnersColl *mongo.Collection) error {
+	_, err := ctrlsColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "last_seen_at", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = runnersColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "ctrl_id", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+	return err
+}
+
+// ensureEventsIndexes creates the indexes of the events queries, which filter the events of a user by controller,
+// runner or job, latest first, and the TTL index deleting the events older than the retention.
+func ensureEventsIndexes(ctx context.Context, eventsColl *mongo.Collection, cfg config.EventsConfig) error {
+	_, err := eventsColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "ctrl_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "runner", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "job_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ensureTTLIndex(ctx, eventsColl, "timestamp", cfg.Retention)
+}
+
+// migrateEmbeddedCtrls moves the controllers and runners embedded in the users documents to their own collections.
+// Documents are upserted by ID before the embedded ones are removed, so an interrupted migration can be run again.
+func migrateEmbeddedCtrls(ctx context.Context, usersColl, ctrlsColl, runnersColl *mongo.Collection) error {
+	cursor, err := usersColl.Find(ctx, bson.M{"ctrls": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user legacyUser
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		runners := 0
+		for _, ctrl := range user.Ctrls {
+			_, err := ctrlsColl.UpdateOne(ctx,
+				bson.M{"_id": ctrl.ID},
+				bson.M{"$setOnInsert": bson.M{
+					"user_id":    user.ID,
+					"name":       ctrl.Name,
+					"admin_url":  ctrl.AdminURL,
+					"created_at": ctrl.CreatedAt,
+					"updated_at": ctrl.UpdatedAt,
+				}},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				return err
+			}
+
+			for _, runner := range ctrl.Runners {
+				runner.UserID = user.ID
+				runner.CtrlID = ctrl.ID
+				_, err := runnersColl.ReplaceOne(ctx, bson.M{"_id": runner.ID}, runner, options.Replace().SetUpsert(true))
+				if err != nil {
+					return err
+				}
+				runners++
+			}
+		}
+
+		_, err := usersColl.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"ctrls": ""}})
+		if err != nil {
+			return err
+		}
+		logs.InfoF("Migrated %d controllers and %d runners of user %s", len(user.Ctrls), runners, user.ID.Hex())
+	}
+
+	return cursor.Err()
+}
+
+// metricsCollections maps the resolutions of the metrics to their collection. The raw points are stored in a
+// time-series collection, the rollups in regular ones, where a bucket of a runner is upserted when rolled up.
+var metricsCollections = map[runnerEntities.Resolution]string{
+	runnerEntities.ResolutionRaw:    "metrics",
+	runnerEntities.ResolutionMinute: "metrics_1m",
+	runnerEntities.ResolutionHour:   "metrics_1h",
+}
+
+// ensureMetricsCollections creates the collections of the metrics and applies their retention.
+func ensureMetricsCollections(ctx context.Context, db *mongo.Database, cfg config.MetricsConfig) (map[runnerEntities.Resolution]*mongo.Collection, error) {
+	raw, err := ensureRawMetricsCollection(ctx, db, metricsCollections[runnerEntities.ResolutionRaw], cfg.RawRetention)
+	if err != nil {
+		return nil, err
+	}
+	minute, err := ensureRollupCollection(ctx, db, metricsCollections[runnerEntities.ResolutionMinute], cfg.MinuteRetention)
+	if err != nil {
+		return nil, err
+	}
+	hour, err := ensureRollupCollection(ctx, db, metricsCollections[runnerEntities.ResolutionHour], cfg.HourRetention)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[runnerEntities.Resolution]*mongo.Collection{
+		runnerEntities.ResolutionRaw:    raw,
+		runnerEntities.ResolutionMinute: minute,
+		runnerEntities.ResolutionHour:   hour,
+	}, nil
+}
+
+// ensureRawMetricsCollection creates the time-series collection of the raw points.
+// A plain collection left from before is renamed to <name>_legacy, as it cannot be converted in place,
+// and its points are copied over by migrateLegacyMetrics.
+func ensureRawMetricsCollection(ctx context.Context, db *mongo.Database, name string, retention time.Duration) (*mongo.Collection, error) {
+	expireAfter := int64(retention.Seconds())
+
+	spec, err := collectionSpec(ctx, db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec != nil && spec.Type != "timeseries" {
+		legacy := name + "_legacy"
+		if err = renameCollection(ctx, db, name, legacy); err != nil {
+			return nil, err
+		}
+		logs.InfoF("Renamed the plain %s collection to %s", name, legacy)
+		spec = nil
+	}
+
+	if spec != nil {
+		err = db.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: name},
+			{Key: "expireAfterSeconds", Value: expireAfter},
+		}).Err()
+	} else {
+		err = db.CreateCollection(ctx, name, options.CreateCollection().
+			SetTimeSeriesOptions(options.TimeSeries().
+				SetTimeField("timestamp").
+				SetMetaField("metadata").
+				SetGranularity("seconds")).
+			SetExpireAfterSeconds(expireAfter))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up %s: %w", name, err)
+	}
+
+	return db.Collection(name), nil
+}
+
+// ensureRollupCollection creates the collection of a rollup resolution, with a bucket per runner and time,
+// and the TTL index applying its retention.
+func ensureRollupCollection(ctx context.Context, db *mongo.Database, name string, retention time.Duration) (*mongo.Collection, error) {
+	coll := db.Collection(name)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "metadata.runner_id", Value: 1}, {Key: "timestamp", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up %s: %w", name, err)
+	}
+	if err = ensureTTLIndex(ctx, coll, "timestamp", retention); err != nil {
+		return nil, fmt.Errorf("failed to set up %s: %w", name, err)
+	}
+
+	return coll, nil
+}
+
+// ensureRollupsQueue creates the collection of the buckets pending rollup, and queues the buckets of the raw
+// points saved since the latest rollups, so that none is missed when the queue is introduced or the rollups lag.
+func ensureRollupsQueue(ctx context.Context, db *mongo.Database, metricsColls map[runnerEntities.Resolution]*mongo.Collection) (*mongo.Collection, error) {
+	queue := db.Collection("metrics_rollups_pending")
+	_, err := queue.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "_id.resolution", Value: 1}, {Key: "_id.bucket", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, res := range []runnerEntities.Resolution{runnerEntities.ResolutionMinute, runnerEntities.ResolutionHour} {
+		var latest runnerEntities.Metrics
+		err := metricsColls[res].FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"timestamp": -1})).Decode(&latest)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		cursor, err := metricsColls[runnerEntities.ResolutionRaw].Aggregate(ctx, bson.A{
+			bson.M{"$match": bson.M{"timestamp": bson.M{"$gte": latest.Timestamp}}},
+			bson.M{"$group": bson.M{"_id": bson.D{
+				{Key: "runner_id", Value: "$metadata.runner_id"},
+				{Key: "resolution", Value: res},
+				{Key: "bucket", Value: bson.M{"$dateTrunc": bson.M{"date": "$timestamp", "unit": res.Unit()}}},
+			}}},
+			bson.M{"$set": bson.M{"touched_at": "$$NOW"}},
+			bson.M{"$merge": bson.M{"into": queue.Name(), "whenMatched": "keepExisting", "whenNotMatched": "insert"}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to queue the %s rollups: %w", res, err)
+		}
+		if err = cursor.Close(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return queue, nil
+}
+
+// migrateLegacyMetrics copies the points of the plain metrics collection, which held the values in the
+// metadata, into the raw metrics, and drops it once empty. Points past the raw retention are dropped.
+// Each batch is deleted once saved, so an interrupted migration can be run again.
+func migrateLegacyMetrics(ctx context.Context, db *mongo.Database, retention time.Duration, save func(context.Context, []*runnerEntities.Metrics) error) error {
+	legacy := db.Collection(metricsCollections[runnerEntities.ResolutionRaw] + "_legacy")
+	spec, err := collectionSpec(ctx, db, legacy.Name())
+	if err != nil || spec == nil {
+		return err
+	}
+
+	expired := time.Now().Add(-retention)
+	copied := 0
+	for {
+		cursor, err := legacy.Find(ctx, bson.M{}, options.Find().SetLimit(1000))
+		if err != nil {
+			return err
+		}
+		var points []struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			Timestamp time.Time          `bson:"timestamp"`
+			Metadata  bson.M             `bson:"metadata"`
+		}
+		if err = cursor.All(ctx, &points); err != nil {
+			return err
+		}
+		if len(points) == 0 {
+			break
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(points))
+		metrics := make([]*runnerEntities.Metrics, 0, len(points))
+		for _, point := range points {
+			ids = append(ids, point.ID)
+			runnerID, ok := point.Metadata["runner_id"].(primitive.ObjectID)
+			if !ok || point.Timestamp.Before(expired) {
+				continue
+			}
+
+			values := make(map[string]float64, len(point.Metadata))
+			for k, v := range point.Metadata {
+				switch value := v.(type) {
+				case float64:
+					values[k] = value
+				case int32:
+					values[k] = float64(value)
+				case int64:
+					values[k] = float64(value)
+				}
+			}
+			metrics = append(metrics, &runnerEntities.Metrics{
+				Timestamp: point.Timestamp,
+				Metadata:  runnerEntities.MetricsMetadata{RunnerID: runnerID},
+				Values:    values,
+			})
+		}
+
+		if err = save(ctx, metrics); err != nil {
+			return err
+		}
+		if _, err = legacy.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+		copied += len(metrics)
+	}
+
+	if err = legacy.Drop(ctx); err != nil {
+		return err
+	}
+	logs.InfoF("Copied %d points of the %s collection to the raw metrics", copied, legacy.Name())
+	return nil
+}
+
+// ensureTTLIndex creates the TTL index deleting the documents once the field is older than the retention,
+// or updates its retention.
+func ensureTTLIndex(ctx context.Context, coll *mongo.Collection, field string, retention time.Duration) error {
+	expireAfter := int32(retention.Seconds())
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(expireAfter),
+	})
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Name != "IndexOptionsConflict" {
+		return err
+	}
+
+	// The retention changed since the TTL index was created
+	return coll.Database().RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: coll.Name()},
+		{Key: "index", Value: bson.D{
+			{Key: "keyPattern", Value: bson.D{{Key: field, Value: 1}}},
+			{Key: "expireAfterSeconds", Value: expireAfter},
+		}},
+	}).Err()
+}
+
+// collectionSpec returns the specification of the collection, or nil if it does not exist.
+func collectionSpec(ctx context.Context, db *mongo.Database, name string) (*mongo.CollectionSpecification, error) {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.M{"name": name})
+	if err != nil {
+		return nil, err
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	return specs[0], nil
+}
+
+func renameCollection(ctx context.Context, db *mongo.Database, from, to string) error {
+	err := db.Client().Database("admin").RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: db.Name() + "." + from},
+		{Key: "to", Value: db.Name() + "." + to},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", from, to, err)
+	}
+	return nil
+}
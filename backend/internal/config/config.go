@@ -6,6 +6,7 @@ import (
 	"github.com/spf13/viper"
 	"log"
 	"strings"
+	"time"
 )
 
 type (
@@ -15,6 +16,11 @@ type (
 		Database       DatabaseConfig
 		Authentication AuthenticationConfig
 		JWT            JWTConfig
+		Pricing        PricingConfig
+		Metrics        MetricsConfig
+		PubSub         PubSubConfig
+		Ctrls          CtrlsConfig
+		Events         EventsConfig
 	}
 
 	// AppConfig holds the configuration related to the application settings.
@@ -54,8 +60,77 @@ type (
 		Expired int
 		Label   string
 	}
+
+	// MetricsConfig holds the retention of the raw metrics and of their 1-minute and 1-hour rollups.
+	MetricsConfig struct {
+		RawRetention    time.Duration `mapstructure:"raw_retention"`
+		MinuteRetention time.Duration `mapstructure:"minute_retention"`
+		HourRetention   time.Duration `mapstructure:"hour_retention"`
+	}
+
+	// PubSubConfig selects how WebSocket updates reach the replicas of the backend: "memory" for a
+	// single replica, "mongo" for change streams shared by all of them.
+	PubSubConfig struct {
+		Driver string
+	}
+
+	// CtrlsConfig holds how long a controller may stay silent before it is marked offline, and how
+	// long a controller without runners is kept after its last change.
+	CtrlsConfig struct {
+		OfflineTimeout time.Duration `mapstructure:"offline_timeout"`
+		StaleTimeout   time.Duration `mapstructure:"stale_timeout"`
+	}
+
+	// EventsConfig holds how long the runner events are kept.
+	EventsConfig struct {
+		Retention time.Duration
+	}
+
+	// PricingConfig holds the prices used to estimate the cost of the runners.
+	PricingConfig struct {
+		Currency     string
+		VCPUHour     float64 `mapstructure:"vcpu_hour"`     // Price of one vCPU for an hour.
+		GBHour       float64 `mapstructure:"gb_hour"`       // Price of one GB of memory for an hour.
+		SpotDiscount float64 `mapstructure:"spot_discount"` // Discount of Spot capacity, from 0 to 1.
+	}
 )
 
+// IsDevelopment tells whether the backend runs locally or in development, where the controllers
+// may serve their admin API over plain HTTP.
+func (c AppConfig) IsDevelopment() bool {
+	return c.Environment == "local" || c.Environment == "development"
+}
+
+// SetDefaults fills in the retentions left empty in the config.
+func (c *MetricsConfig) SetDefaults() {
+	if c.RawRetention == 0 {
+		c.RawRetention = 7 * 24 * time.Hour
+	}
+	if c.MinuteRetention == 0 {
+		c.MinuteRetention = 30 * 24 * time.Hour
+	}
+	if c.HourRetention == 0 {
+		c.HourRetention = 365 * 24 * time.Hour
+	}
+}
+
+// SetDefaults fills in the timeouts left empty in the config.
+func (c *CtrlsConfig) SetDefaults() {
+	if c.OfflineTimeout == 0 {
+		c.OfflineTimeout = time.Minute
+	}
+	if c.StaleTimeout == 0 {
+		c.StaleTimeout = time.Hour
+	}
+}
+
+// SetDefaults fills in the retention left empty in the config.
+func (c *EventsConfig) SetDefaults() {
+	if c.Retention == 0 {
+		c.Retention = 30 * 24 * time.Hour
+	}
+}
+
 // LoadConfig loads the configuration from the specified filename.
 func LoadConfig(filename string) (Config, error) {
 	// Create a new Viper instance.
@@ -1,18 +1,28 @@
 package http
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"runner-manager-backend/internal/ctrls"
 	"runner-manager-backend/internal/ctrls/dto"
+	"runner-manager-backend/internal/infrastructure/logs"
+	"runner-manager-backend/internal/infrastructure/pubsub"
+	"runner-manager-backend/internal/middleware"
 	"runner-manager-backend/pkg/response"
+	"time"
 )
 
+// StatusInterval is how often the controllers are marked offline or online again.
+const StatusInterval = 15 * time.Second
+
 type handlers struct {
 	uc ctrls.Usecase
+	ps pubsub.PubSub
 }
 
-func NewHandlers(uc ctrls.Usecase) *handlers {
-	return &handlers{uc}
+func NewHandlers(uc ctrls.Usecase, ps pubsub.PubSub) *handlers {
+	return &handlers{uc, ps}
 }
 
 func (h *handlers) RegisterCtrl(c *gin.Context) {
@@ -35,3 +45,164 @@ func (h *handlers) RegisterCtrl(c *gin.Context) {
 
 	response.SuccessBuilder(rsp).Send(c)
 }
+
+// GetCtrls lists the controllers of the user with their status, version and number of runners.
+func (h *handlers) GetCtrls(c *gin.Context) {
+	var query dto.GetCtrlsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.GetCtrls(c, userData.Data.UserID, &query)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+func (h *handlers) GetCtrl(c *gin.Context) {
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.GetCtrl(c, userData.Data.UserID, c.Param("id"))
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+// UpdateCtrl renames, archives or restores a controller.
+func (h *handlers) UpdateCtrl(c *gin.Context) {
+	var payload *dto.UpdateCtrlRequest
+	if err := c.Bind(&payload); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.UpdateCtrl(c, userData.Data.UserID, c.Param("id"), payload)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	h.notify(c, userData.Data.UserID, rsp)
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+// DeleteCtrl deletes a controller along with its runners and their metrics.
+func (h *handlers) DeleteCtrl(c *gin.Context) {
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.DeleteCtrl(c, userData.Data.UserID, c.Param("id"))
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	h.notify(c, userData.Data.UserID, rsp.Ctrl)
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+// Heartbeat keeps the controller of the token online, and records its version.
+func (h *handlers) Heartbeat(c *gin.Context) {
+	var payload *dto.HeartbeatRequest
+	if err := c.Bind(&payload); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+	if userData.Data.CtrlID == "" {
+		response.ErrorBuilder(response.Unauthorized(response.ErrFailedGetTokenInformation)).Send(c)
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	if err := h.uc.Heartbeat(c, userData.Data.UserID, userData.Data.CtrlID, payload); err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(nil).Send(c)
+}
+
+// WatchStatus marks the controllers offline when they stop pushing, and online again when they come
+// back, notifying their users, until ctx is canceled.
+func (h *handlers) WatchStatus(ctx context.Context) {
+	ticker := time.NewTicker(StatusInterval)
+	defer ticker.Stop()
+
+	for {
+		changes, err := h.uc.UpdateCtrlsStatus(ctx)
+		if err != nil && ctx.Err() == nil {
+			logs.ErrorF("Failed to update the status of the controllers: %v", err)
+		}
+		for _, change := range changes {
+			h.notify(ctx, change.UserID, change.Ctrl)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notify sends the ctrl_updated event to the WebSocket connections of the user, and refreshes their
+// controllers and runners.
+func (h *handlers) notify(ctx context.Context, userID string, ctrl *dto.CtrlResponse) {
+	data, err := json.Marshal(map[string]interface{}{
+		"event": "ctrl_updated",
+		"data":  ctrl,
+	})
+	if err != nil {
+		logs.ErrorF("Failed to marshal controller %s: %v", ctrl.Id, err)
+		return
+	}
+
+	err = h.ps.Publish(ctx, &pubsub.Message{UserID: userID, Topic: pubsub.TopicUser, Data: data})
+	if err == nil {
+		err = h.ps.Publish(ctx, &pubsub.Message{UserID: userID, Topic: pubsub.TopicRunners})
+	}
+	if err != nil {
+		logs.ErrorF("Failed to notify user %s of controller %s: %v", userID, ctrl.Id, err)
+	}
+}
@@ -3,8 +3,14 @@ package http
 import (
 	"github.com/gin-gonic/gin"
 	"runner-manager-backend/internal/config"
+	"runner-manager-backend/internal/middleware"
 )
 
 func (h *handlers) CtrlRoutes(router *gin.RouterGroup, cfg config.Config) {
 	router.POST("/", h.RegisterCtrl)
+	router.POST("/heartbeat", middleware.JWTMiddleware(cfg), h.Heartbeat)
+	router.GET("/", middleware.JWTMiddleware(cfg), h.GetCtrls)
+	router.GET("/:id", middleware.JWTMiddleware(cfg), h.GetCtrl)
+	router.PATCH("/:id", middleware.JWTMiddleware(cfg), h.UpdateCtrl)
+	router.DELETE("/:id", middleware.JWTMiddleware(cfg), h.DeleteCtrl)
 }
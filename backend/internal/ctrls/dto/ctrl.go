@@ -1,13 +1,20 @@
 package dto
 
 import (
+	"errors"
 	"github.com/invopop/validation"
 	"github.com/invopop/validation/is"
+	"runner-manager-backend/pkg/constant"
+	"time"
 )
 
 type CreateRunnerControllerRequest struct {
-	Name   string `json:"name"`
-	ApiKey string `json:"api_key"`
+	Name     string `json:"name"`
+	ApiKey   string `json:"api_key"`
+	AdminURL string `json:"admin_url"`
+	// AdminKey signs the tokens the backend authenticates to the admin API with.
+	AdminKey string `json:"admin_key"`
+	Version  string `json:"version"`
 }
 
 type CreateRunnerControllerResponse struct {
@@ -16,8 +23,67 @@ type CreateRunnerControllerResponse struct {
 	ExpiredAt   int64  `json:"expired_at"`
 }
 
+// GetCtrlsQuery lists the controllers of the user, along with the archived ones when Archived is set.
+type GetCtrlsQuery struct {
+	Archived bool `form:"archived"`
+}
+
+// UpdateCtrlRequest renames a controller, and archives or restores it. Fields left out are unchanged.
+type UpdateCtrlRequest struct {
+	Name     *string `json:"name"`
+	Archived *bool   `json:"archived"`
+}
+
+// HeartbeatRequest is sent by the controllers that have no runners to push, so they stay online.
+type HeartbeatRequest struct {
+	Version string `json:"version"`
+}
+
+type CtrlResponse struct {
+	Id         string              `json:"id"`
+	Name       string              `json:"name"`
+	AdminURL   string              `json:"admin_url"`
+	Version    string              `json:"version"`
+	Status     constant.CtrlStatus `json:"status"`
+	LastSeenAt *time.Time          `json:"last_seen_at"`
+	Runners    int                 `json:"runners"`
+	CreatedAt  time.Time           `json:"created_at"`
+	ArchivedAt *time.Time          `json:"archived_at,omitempty"`
+}
+
+// DeleteCtrlResponse holds the deleted controller, and the number of runners and metrics points deleted along with it.
+type DeleteCtrlResponse struct {
+	Ctrl    *CtrlResponse `json:"ctrl"`
+	Runners int64         `json:"runners"`
+	Metrics int64         `json:"metrics"`
+}
+
+// CtrlStatusChange is a controller that went offline or came back online, for its user.
+type CtrlStatusChange struct {
+	UserID string
+	Ctrl   *CtrlResponse
+}
+
 func (cup *CreateRunnerControllerRequest) Validate() error {
 	return validation.ValidateStruct(cup,
 		validation.Field(&cup.ApiKey, validation.Required, is.ASCII, validation.Length(64, 64)),
+		validation.Field(&cup.AdminURL, is.URL),
+		validation.Field(&cup.AdminKey, is.Hexadecimal, validation.Length(64, 64)),
+		validation.Field(&cup.Version, validation.Length(0, 64)),
+	)
+}
+
+func (r *UpdateCtrlRequest) Validate() error {
+	if r.Name == nil && r.Archived == nil {
+		return errors.New("name or archived is required")
+	}
+	return validation.ValidateStruct(r,
+		validation.Field(&r.Name, validation.NilOrNotEmpty, validation.Length(1, 64)),
+	)
+}
+
+func (r *HeartbeatRequest) Validate() error {
+	return validation.ValidateStruct(r,
+		validation.Field(&r.Version, validation.Length(0, 64)),
 	)
 }
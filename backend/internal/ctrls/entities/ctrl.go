@@ -2,23 +2,64 @@ package entities
 
 import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/url"
 	"runner-manager-backend/internal/ctrls/dto"
 	"runner-manager-backend/internal/runners/entities"
+	"runner-manager-backend/pkg/constant"
 	"time"
 )
 
 type RunnerController struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
 	Name      string             `bson:"name"`
+	AdminURL  string             `bson:"admin_url"`
+	AdminKey  string             `bson:"admin_key,omitempty"`
+	Version   string             `bson:"version"`
 	CreatedAt time.Time          `bson:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at"`
-	Runners   []*entities.Runner `bson:"runners"`
+
+	// LastSeenAt is the time of the last push or heartbeat, from which the status job sets Status.
+	LastSeenAt time.Time           `bson:"last_seen_at"`
+	Status     constant.CtrlStatus `bson:"status"`
+	// ArchivedAt is set on the controllers hidden from the dashboard, which may not push anymore.
+	ArchivedAt *time.Time `bson:"archived_at,omitempty"`
+
+	// Runners are stored in their own collection and loaded along with the controller.
+	Runners []*entities.Runner `bson:"-"`
 }
 
 func NewRunnerController(data *dto.CreateRunnerControllerRequest) *RunnerController {
 	return &RunnerController{
-		Name:      data.Name,
-		Runners:   make([]*entities.Runner, 0),
-		CreatedAt: time.Now(),
+		Name:       data.Name,
+		AdminURL:   data.AdminURL,
+		AdminKey:   data.AdminKey,
+		Version:    data.Version,
+		Runners:    make([]*entities.Runner, 0),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		LastSeenAt: time.Now(),
+		Status:     constant.CtrlStatusOnline,
+	}
+}
+
+// AdminURLAllowed tells whether the backend may call the admin API at the URL. Outside development it must
+// use https, as the requests carry a token and return the runner logs.
+func AdminURLAllowed(adminURL string, development bool) bool {
+	u, err := url.Parse(adminURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "https" || (development && u.Scheme == "http")
+}
+
+// CurrentStatus returns the status reported to users, archived for the archived controllers.
+func (c *RunnerController) CurrentStatus() constant.CtrlStatus {
+	if c.ArchivedAt != nil {
+		return constant.CtrlStatusArchived
+	}
+	if c.Status == "" {
+		return constant.CtrlStatusOffline
 	}
+	return c.Status
 }
@@ -2,11 +2,20 @@ package ctrls
 
 import (
 	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"runner-manager-backend/internal/ctrls/entities"
+	"time"
 )
 
 type Repository interface {
-	GetCtrlByID(ctx context.Context, ctrlID string) (*entities.RunnerController, error)
-	GetCtrlsByUserID(ctx context.Context, userID string) (*entities.RunnerController, error)
+	GetCtrlByID(ctx context.Context, userID, ctrlID string) (*entities.RunnerController, error)
+	GetCtrlsByUserID(ctx context.Context, userID string, archived bool) ([]*entities.RunnerController, error)
+	CountRunners(ctx context.Context, ctrlIDs []primitive.ObjectID) (map[primitive.ObjectID]int, error)
 	SaveNewCtrl(ctx context.Context, userID string, ctrl *entities.RunnerController) (string, error)
+	UpdateCtrl(ctx context.Context, userID, ctrlID string, name *string, archived *bool) (*entities.RunnerController, error)
+	DeleteCtrl(ctx context.Context, userID, ctrlID string) (runners int64, metrics int64, err error)
+	Heartbeat(ctx context.Context, userID, ctrlID, version string) error
+	MarkOfflineCtrls(ctx context.Context, seenBefore time.Time) ([]*entities.RunnerController, error)
+	MarkOnlineCtrls(ctx context.Context, seenSince time.Time) ([]*entities.RunnerController, error)
+	DeleteStaleCtrls(ctx context.Context, updatedBefore time.Time) (int, error)
 }
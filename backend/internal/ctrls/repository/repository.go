@@ -2,34 +2,105 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"runner-manager-backend/internal/ctrls"
 	"runner-manager-backend/internal/ctrls/entities"
+	runnerEntities "runner-manager-backend/internal/runners/entities"
+	"runner-manager-backend/pkg/constant"
 	"runner-manager-backend/pkg/response"
+	"time"
 )
 
 type repository struct {
-	coll *mongo.Collection
+	coll         *mongo.Collection
+	runnersColl  *mongo.Collection
+	metricsColls map[runnerEntities.Resolution]*mongo.Collection
 	//conn datasource.ConnTx
 }
 
-func NewRepository(coll *mongo.Collection) ctrls.Repository {
+// NewRepository returns the repository of the controllers. The runners and metrics collections are
+// only used to count the runners and to delete them along with their controller.
+func NewRepository(coll, runnersColl *mongo.Collection, metricsColls map[runnerEntities.Resolution]*mongo.Collection) ctrls.Repository {
 	return &repository{
-		coll: coll,
+		coll:         coll,
+		runnersColl:  runnersColl,
+		metricsColls: metricsColls,
 	}
 }
 
-func (r *repository) GetCtrlByID(ctx context.Context, ctrlID string) (*entities.RunnerController, error) {
-	//TODO implement me
-	panic("implement me")
+func (r *repository) GetCtrlByID(ctx context.Context, userID, ctrlID string) (*entities.RunnerController, error) {
+	filter, err := ctrlFilter(userID, ctrlID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ctrl entities.RunnerController
+	err = r.coll.FindOne(ctx, filter).Decode(&ctrl)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, response.NotFound(response.ErrCtrlNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl, nil
 }
 
-func (r *repository) GetCtrlsByUserID(ctx context.Context, userID string) (*entities.RunnerController, error) {
-	//TODO implement me
-	panic("implement me")
+// GetCtrlsByUserID returns the controllers of the user, oldest first, along with the archived ones when archived is set.
+func (r *repository) GetCtrlsByUserID(ctx context.Context, userID string, archived bool) ([]*entities.RunnerController, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, response.ErrUserNotFound
+	}
+
+	filter := bson.M{"user_id": userObjectID}
+	if !archived {
+		filter["archived_at"] = nil
+	}
+
+	userCtrls := make([]*entities.RunnerController, 0)
+	cursor, err := r.coll.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &userCtrls); err != nil {
+		return nil, err
+	}
+
+	return userCtrls, nil
+}
+
+// CountRunners returns the number of runners of each controller.
+func (r *repository) CountRunners(ctx context.Context, ctrlIDs []primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+	counts := make(map[primitive.ObjectID]int, len(ctrlIDs))
+	if len(ctrlIDs) == 0 {
+		return counts, nil
+	}
+
+	cursor, err := r.runnersColl.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ctrl_id": bson.M{"$in": ctrlIDs}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$ctrl_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		CtrlID primitive.ObjectID `bson:"_id"`
+		Count  int                `bson:"count"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		counts[result.CtrlID] = result.Count
+	}
+	return counts, nil
 }
 
 func (r *repository) SaveNewCtrl(ctx context.Context, userID string, ctrl *entities.RunnerController) (string, error) {
@@ -39,15 +110,210 @@ func (r *repository) SaveNewCtrl(ctx context.Context, userID string, ctrl *entit
 	}
 
 	ctrl.ID = primitive.NewObjectID()
+	ctrl.UserID = objectID
 
-	_, err = r.coll.UpdateOne(
-		context.TODO(),
-		bson.D{{"_id", objectID}},
-		bson.D{{"$push", bson.D{{"ctrls", ctrl}}}},
-		options.Update().SetUpsert(true),
-	)
+	_, err = r.coll.InsertOne(ctx, ctrl)
 	if err != nil {
 		return "", err
 	}
 	return ctrl.ID.Hex(), nil
 }
+
+// UpdateCtrl renames the controller when name is set, and archives or restores it when archived is set.
+func (r *repository) UpdateCtrl(ctx context.Context, userID, ctrlID string, name *string, archived *bool) (*entities.RunnerController, error) {
+	filter, err := ctrlFilter(userID, ctrlID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	set := bson.M{"updated_at": now}
+	update := bson.M{"$set": set}
+	if name != nil {
+		set["name"] = *name
+	}
+	if archived != nil && *archived {
+		set["archived_at"] = now
+	}
+	if archived != nil && !*archived {
+		update["$unset"] = bson.M{"archived_at": ""}
+	}
+
+	var ctrl entities.RunnerController
+	err = r.coll.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&ctrl)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, response.NotFound(response.ErrCtrlNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl, nil
+}
+
+// DeleteCtrl deletes the controller along with its runners and their metrics. The controller is archived
+// first so it cannot push new runners meanwhile, and deleted last so a failed deletion can be retried.
+func (r *repository) DeleteCtrl(ctx context.Context, userID, ctrlID string) (int64, int64, error) {
+	ctrl, err := r.GetCtrlByID(ctx, userID, ctrlID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if ctrl.ArchivedAt == nil {
+		_, err = r.coll.UpdateOne(ctx, bson.M{"_id": ctrl.ID}, bson.M{"$set": bson.M{"archived_at": time.Now()}})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var ctrlRunners []*runnerEntities.Runner
+	cursor, err := r.runnersColl.Find(ctx, bson.M{"ctrl_id": ctrl.ID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = cursor.All(ctx, &ctrlRunners); err != nil {
+		return 0, 0, err
+	}
+
+	var metrics int64
+	if len(ctrlRunners) > 0 {
+		runnerIDs := make([]primitive.ObjectID, 0, len(ctrlRunners))
+		for _, runner := range ctrlRunners {
+			runnerIDs = append(runnerIDs, runner.ID)
+		}
+
+		for _, coll := range r.metricsColls {
+			deleted, err := coll.DeleteMany(ctx, bson.M{"metadata.runner_id": bson.M{"$in": runnerIDs}})
+			if err != nil {
+				return 0, 0, err
+			}
+			metrics += deleted.DeletedCount
+		}
+	}
+
+	deleted, err := r.runnersColl.DeleteMany(ctx, bson.M{"ctrl_id": ctrl.ID})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	_, err = r.coll.DeleteOne(ctx, bson.M{"_id": ctrl.ID})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return deleted.DeletedCount, metrics, nil
+}
+
+// Heartbeat records that the controller is alive, along with its version when set.
+func (r *repository) Heartbeat(ctx context.Context, userID, ctrlID, version string) error {
+	filter, err := ctrlFilter(userID, ctrlID)
+	if err != nil {
+		return err
+	}
+	filter["archived_at"] = nil
+
+	set := bson.M{"last_seen_at": time.Now()}
+	if version != "" {
+		set["version"] = version
+	}
+
+	result, err := r.coll.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return response.NotFound(response.ErrCtrlNotFound)
+	}
+	return nil
+}
+
+// MarkOfflineCtrls marks offline the online controllers last seen before seenBefore, and returns them.
+func (r *repository) MarkOfflineCtrls(ctx context.Context, seenBefore time.Time) ([]*entities.RunnerController, error) {
+	return r.markCtrls(ctx, bson.M{
+		"status":       constant.CtrlStatusOnline,
+		"last_seen_at": bson.M{"$lt": seenBefore},
+		"archived_at":  nil,
+	}, constant.CtrlStatusOffline)
+}
+
+// MarkOnlineCtrls marks online the other controllers seen since seenSince, and returns them.
+func (r *repository) MarkOnlineCtrls(ctx context.Context, seenSince time.Time) ([]*entities.RunnerController, error) {
+	return r.markCtrls(ctx, bson.M{
+		"status":       bson.M{"$ne": constant.CtrlStatusOnline},
+		"last_seen_at": bson.M{"$gte": seenSince},
+		"archived_at":  nil,
+	}, constant.CtrlStatusOnline)
+}
+
+// markCtrls sets the status of the controllers matching filter one at a time, so each change is
+// returned by only one of the replicas running the status job.
+func (r *repository) markCtrls(ctx context.Context, filter bson.M, status constant.CtrlStatus) ([]*entities.RunnerController, error) {
+	var marked []*entities.RunnerController
+	for {
+		var ctrl entities.RunnerController
+		err := r.coll.FindOneAndUpdate(ctx, filter,
+			bson.M{"$set": bson.M{"status": status}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&ctrl)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return marked, nil
+		}
+		if err != nil {
+			return marked, err
+		}
+		marked = append(marked, &ctrl)
+	}
+}
+
+// DeleteStaleCtrls removes the controllers that have no runners and were neither changed nor seen
+// since updatedBefore. Controllers register again on every start, so these are left from previous runs.
+// Archived controllers are kept.
+func (r *repository) DeleteStaleCtrls(ctx context.Context, updatedBefore time.Time) (int, error) {
+	var stale []*entities.RunnerController
+	cursor, err := r.coll.Find(ctx, bson.M{
+		"updated_at":  bson.M{"$lt": updatedBefore},
+		"archived_at": nil,
+		"$or": bson.A{
+			bson.M{"last_seen_at": bson.M{"$lt": updatedBefore}},
+			bson.M{"last_seen_at": bson.M{"$exists": false}},
+		},
+	}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	if err = cursor.All(ctx, &stale); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, ctrl := range stale {
+		count, err := r.runnersColl.CountDocuments(ctx, bson.M{"ctrl_id": ctrl.ID}, options.Count().SetLimit(1))
+		if err != nil {
+			return deleted, err
+		}
+		if count > 0 {
+			continue
+		}
+		result, err := r.coll.DeleteOne(ctx, bson.M{"_id": ctrl.ID, "updated_at": bson.M{"$lt": updatedBefore}})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(result.DeletedCount)
+	}
+
+	return deleted, nil
+}
+
+func ctrlFilter(userID, ctrlID string) (bson.M, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, response.ErrUserNotFound
+	}
+
+	ctrlObjectID, err := primitive.ObjectIDFromHex(ctrlID)
+	if err != nil {
+		return nil, response.NotFound(response.ErrCtrlNotFound)
+	}
+
+	return bson.M{"_id": ctrlObjectID, "user_id": userObjectID}, nil
+}
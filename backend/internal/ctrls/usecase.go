@@ -7,4 +7,10 @@ import (
 
 type Usecase interface {
 	Register(ctx context.Context, payload *dto.CreateRunnerControllerRequest) (rsp *dto.CreateRunnerControllerResponse, err error)
+	GetCtrls(ctx context.Context, userID string, query *dto.GetCtrlsQuery) ([]*dto.CtrlResponse, error)
+	GetCtrl(ctx context.Context, userID, ctrlID string) (*dto.CtrlResponse, error)
+	UpdateCtrl(ctx context.Context, userID, ctrlID string, payload *dto.UpdateCtrlRequest) (*dto.CtrlResponse, error)
+	DeleteCtrl(ctx context.Context, userID, ctrlID string) (*dto.DeleteCtrlResponse, error)
+	Heartbeat(ctx context.Context, userID, ctrlID string, payload *dto.HeartbeatRequest) error
+	UpdateCtrlsStatus(ctx context.Context) ([]*dto.CtrlStatusChange, error)
 }
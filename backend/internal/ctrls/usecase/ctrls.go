@@ -0,0 +1,143 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"runner-manager-backend/internal/ctrls/dto"
+	"runner-manager-backend/internal/ctrls/entities"
+	"runner-manager-backend/internal/infrastructure/logs"
+	"runner-manager-backend/pkg/constant"
+	"runner-manager-backend/pkg/response"
+	"strings"
+	"time"
+)
+
+var errEmptyName = errors.New("name must not be blank")
+
+func (uc *usecase) GetCtrls(ctx context.Context, userID string, query *dto.GetCtrlsQuery) ([]*dto.CtrlResponse, error) {
+	userCtrls, err := uc.repo.GetCtrlsByUserID(ctx, userID, query.Archived)
+	if err != nil {
+		return nil, err
+	}
+
+	ctrlIDs := make([]primitive.ObjectID, 0, len(userCtrls))
+	for _, ctrl := range userCtrls {
+		ctrlIDs = append(ctrlIDs, ctrl.ID)
+	}
+	counts, err := uc.repo.CountRunners(ctx, ctrlIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := make([]*dto.CtrlResponse, 0, len(userCtrls))
+	for _, ctrl := range userCtrls {
+		rsp = append(rsp, newCtrlResponse(ctrl, counts[ctrl.ID]))
+	}
+	return rsp, nil
+}
+
+func (uc *usecase) GetCtrl(ctx context.Context, userID, ctrlID string) (*dto.CtrlResponse, error) {
+	ctrl, err := uc.repo.GetCtrlByID(ctx, userID, ctrlID)
+	if err != nil {
+		return nil, err
+	}
+	return uc.ctrlResponse(ctx, ctrl)
+}
+
+func (uc *usecase) UpdateCtrl(ctx context.Context, userID, ctrlID string, payload *dto.UpdateCtrlRequest) (*dto.CtrlResponse, error) {
+	name := payload.Name
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		if trimmed == "" {
+			return nil, response.BadRequest(errEmptyName)
+		}
+		name = &trimmed
+	}
+
+	ctrl, err := uc.repo.UpdateCtrl(ctx, userID, ctrlID, name, payload.Archived)
+	if err != nil {
+		return nil, err
+	}
+	return uc.ctrlResponse(ctx, ctrl)
+}
+
+func (uc *usecase) DeleteCtrl(ctx context.Context, userID, ctrlID string) (*dto.DeleteCtrlResponse, error) {
+	ctrl, err := uc.repo.GetCtrlByID(ctx, userID, ctrlID)
+	if err != nil {
+		return nil, err
+	}
+
+	runners, metrics, err := uc.repo.DeleteCtrl(ctx, userID, ctrlID)
+	if err != nil {
+		return nil, err
+	}
+	logs.InfoF("Deleted controller %s of user %s with %d runners and %d metrics", ctrlID, userID, runners, metrics)
+
+	rsp := newCtrlResponse(ctrl, 0)
+	rsp.Status = constant.CtrlStatusDeleted
+	return &dto.DeleteCtrlResponse{Ctrl: rsp, Runners: runners, Metrics: metrics}, nil
+}
+
+func (uc *usecase) Heartbeat(ctx context.Context, userID, ctrlID string, payload *dto.HeartbeatRequest) error {
+	return uc.repo.Heartbeat(ctx, userID, ctrlID, payload.Version)
+}
+
+// UpdateCtrlsStatus marks offline the controllers silent for the offline timeout, and online again the
+// ones seen since, then deletes the stale controllers. It returns the status changes to notify.
+func (uc *usecase) UpdateCtrlsStatus(ctx context.Context) ([]*dto.CtrlStatusChange, error) {
+	cutoff := time.Now().Add(-uc.cfg.Ctrls.OfflineTimeout)
+
+	offline, err := uc.repo.MarkOfflineCtrls(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	online, err := uc.repo.MarkOnlineCtrls(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*dto.CtrlStatusChange, 0, len(offline)+len(online))
+	for _, ctrl := range append(offline, online...) {
+		rsp, err := uc.ctrlResponse(ctx, ctrl)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &dto.CtrlStatusChange{UserID: ctrl.UserID.Hex(), Ctrl: rsp})
+	}
+
+	deleted, err := uc.repo.DeleteStaleCtrls(ctx, time.Now().Add(-uc.cfg.Ctrls.StaleTimeout))
+	if err != nil {
+		return changes, err
+	}
+	if deleted > 0 {
+		logs.InfoF("Deleted %d stale controllers", deleted)
+	}
+
+	return changes, nil
+}
+
+func (uc *usecase) ctrlResponse(ctx context.Context, ctrl *entities.RunnerController) (*dto.CtrlResponse, error) {
+	counts, err := uc.repo.CountRunners(ctx, []primitive.ObjectID{ctrl.ID})
+	if err != nil {
+		return nil, err
+	}
+	return newCtrlResponse(ctrl, counts[ctrl.ID]), nil
+}
+
+func newCtrlResponse(ctrl *entities.RunnerController, runners int) *dto.CtrlResponse {
+	rsp := &dto.CtrlResponse{
+		Id:         ctrl.ID.Hex(),
+		Name:       ctrl.Name,
+		AdminURL:   ctrl.AdminURL,
+		Version:    ctrl.Version,
+		Status:     ctrl.CurrentStatus(),
+		Runners:    runners,
+		CreatedAt:  ctrl.CreatedAt,
+		ArchivedAt: ctrl.ArchivedAt,
+	}
+	if !ctrl.LastSeenAt.IsZero() {
+		rsp.LastSeenAt = &ctrl.LastSeenAt
+	}
+	return rsp
+}
@@ -27,6 +27,10 @@ func NewUseCase(usersRepo users.Repository, repo ctrls.Repository, cfg config.Co
 func (uc *usecase) Register(ctx context.Context, request *dto.CreateRunnerControllerRequest) (rsp *dto.CreateRunnerControllerResponse, err error) {
 	apiKey := request.ApiKey
 
+	if request.AdminURL != "" && !entities.AdminURLAllowed(request.AdminURL, uc.cfg.App.IsDevelopment()) {
+		return nil, response.BadRequest(response.ErrInsecureAdminURL)
+	}
+
 	dataLogin, err := uc.usersRepo.GetUserByApiKey(ctx, apiKey)
 	if err != nil {
 		return rsp, response.ErrUserNotFound
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"runner-manager-backend/internal/events"
+	"runner-manager-backend/internal/events/dto"
+	"runner-manager-backend/internal/middleware"
+	"runner-manager-backend/pkg/response"
+)
+
+// Notifier sends data to the user over its WebSocket connection.
+type Notifier func(userID string, data []byte)
+
+type handlers struct {
+	uc     events.Usecase
+	notify Notifier
+}
+
+func NewHandlers(uc events.Usecase, notify Notifier) *handlers {
+	return &handlers{uc, notify}
+}
+
+// SaveEvents stores a batch of events reported by a controller and forwards them to the user.
+func (h *handlers) SaveEvents(c *gin.Context) {
+	var payload *dto.SaveEventsRequest
+	if err := c.Bind(&payload); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+	if userData.Data.CtrlID == "" {
+		response.ErrorBuilder(response.Unauthorized(response.ErrFailedGetTokenInformation)).Send(c)
+		return
+	}
+
+	if err := payload.Validate(); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	saved, err := h.uc.SaveEvents(c, userData.Data.UserID, userData.Data.CtrlID, payload)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"event": "events",
+		"data":  saved,
+	})
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+	h.notify(userData.Data.UserID, jsonData)
+
+	response.SuccessBuilder(nil).Send(c)
+}
+
+// GetEvents returns the timeline of events of the user, narrowed by controller, runner or job.
+func (h *handlers) GetEvents(c *gin.Context) {
+	var query dto.GetEventsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	if err := query.Validate(); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.GetEvents(c, userData.Data.UserID, &query)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
@@ -0,0 +1,12 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"runner-manager-backend/internal/config"
+	"runner-manager-backend/internal/middleware"
+)
+
+func (h *handlers) EventRoutes(router *gin.RouterGroup, cfg config.Config) {
+	router.POST("/", middleware.JWTMiddleware(cfg), h.SaveEvents)
+	router.GET("/", middleware.JWTMiddleware(cfg), h.GetEvents)
+}
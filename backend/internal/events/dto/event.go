@@ -0,0 +1,82 @@
+package dto
+
+import (
+	"fmt"
+	"github.com/invopop/validation"
+	"runner-manager-backend/pkg/constant"
+	"time"
+)
+
+const (
+	DefaultEventsLimit = 100
+	MaxEventsLimit     = 1000
+	MaxEventsPerBatch  = 1000
+)
+
+type SaveEventsRequest struct {
+	Events []EventRequest `json:"events"`
+}
+
+type EventRequest struct {
+	Type           constant.RunnerEventType `json:"type"`
+	Runner         string                   `json:"runner"`
+	Pool           string                   `json:"pool"`
+	ARN            string                   `json:"arn"`
+	JobID          int64                    `json:"job_id"`
+	RunID          int64                    `json:"run_id"`
+	Status         constant.RunnerStatus    `json:"status"`
+	PreviousStatus constant.RunnerStatus    `json:"previous_status"`
+	Reason         string                   `json:"reason"`
+	Timestamp      time.Time                `json:"timestamp"`
+}
+
+type GetEventsQuery struct {
+	CtrlID string `form:"ctrl_id"`
+	Runner string `form:"runner"`
+	JobID  int64  `form:"job_id"`
+	Limit  int    `form:"limit"`
+}
+
+type EventResponse struct {
+	CtrlID         string                   `json:"ctrl_id"`
+	Type           constant.RunnerEventType `json:"type"`
+	Runner         string                   `json:"runner,omitempty"`
+	Pool           string                   `json:"pool,omitempty"`
+	ARN            string                   `json:"arn,omitempty"`
+	JobID          int64                    `json:"job_id,omitempty"`
+	RunID          int64                    `json:"run_id,omitempty"`
+	Status         constant.RunnerStatus    `json:"status,omitempty"`
+	PreviousStatus constant.RunnerStatus    `json:"previous_status,omitempty"`
+	Reason         string                   `json:"reason,omitempty"`
+	Timestamp      string                   `json:"timestamp"`
+}
+
+func (cup *SaveEventsRequest) Validate() error {
+	err := validation.ValidateStruct(cup,
+		validation.Field(&cup.Events, validation.Required, validation.Length(1, MaxEventsPerBatch)),
+	)
+	if err != nil {
+		return err
+	}
+
+	for i := range cup.Events {
+		if err := cup.Events[i].Validate(); err != nil {
+			return fmt.Errorf("events[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (cup *EventRequest) Validate() error {
+	return validation.ValidateStruct(cup,
+		validation.Field(&cup.Type, validation.Required, validation.In(constant.RunnerEventTypes...)),
+		validation.Field(&cup.Timestamp, validation.Required),
+	)
+}
+
+func (cup *GetEventsQuery) Validate() error {
+	return validation.ValidateStruct(cup,
+		validation.Field(&cup.Limit, validation.Min(0), validation.Max(MaxEventsLimit)),
+	)
+}
@@ -0,0 +1,52 @@
+package entities
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"runner-manager-backend/internal/events/dto"
+	"runner-manager-backend/pkg/constant"
+	"time"
+)
+
+type Event struct {
+	ID             primitive.ObjectID       `bson:"_id,omitempty"`
+	UserID         string                   `bson:"user_id"`
+	CtrlID         string                   `bson:"ctrl_id"`
+	Type           constant.RunnerEventType `bson:"type"`
+	Runner         string                   `bson:"runner,omitempty"`
+	Pool           string                   `bson:"pool,omitempty"`
+	ARN            string                   `bson:"arn,omitempty"`
+	JobID          int64                    `bson:"job_id,omitempty"`
+	RunID          int64                    `bson:"run_id,omitempty"`
+	Status         constant.RunnerStatus    `bson:"status,omitempty"`
+	PreviousStatus constant.RunnerStatus    `bson:"previous_status,omitempty"`
+	Reason         string                   `bson:"reason,omitempty"`
+	Timestamp      time.Time                `bson:"timestamp"`
+	CreatedAt      time.Time                `bson:"created_at"`
+}
+
+// EventFilter selects the events of a user, optionally narrowed to a controller, runner or job.
+type EventFilter struct {
+	UserID string
+	CtrlID string
+	Runner string
+	JobID  int64
+	Limit  int
+}
+
+func NewEvent(userID, ctrlID string, data *dto.EventRequest) *Event {
+	return &Event{
+		UserID:         userID,
+		CtrlID:         ctrlID,
+		Type:           data.Type,
+		Runner:         data.Runner,
+		Pool:           data.Pool,
+		ARN:            data.ARN,
+		JobID:          data.JobID,
+		RunID:          data.RunID,
+		Status:         data.Status,
+		PreviousStatus: data.PreviousStatus,
+		Reason:         data.Reason,
+		Timestamp:      data.Timestamp,
+		CreatedAt:      time.Now(),
+	}
+}
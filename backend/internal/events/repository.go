@@ -0,0 +1,11 @@
+package events
+
+import (
+	"context"
+	"runner-manager-backend/internal/events/entities"
+)
+
+type Repository interface {
+	SaveEvents(ctx context.Context, events []*entities.Event) error
+	GetEvents(ctx context.Context, filter *entities.EventFilter) ([]*entities.Event, error)
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"runner-manager-backend/internal/events"
+	"runner-manager-backend/internal/events/entities"
+)
+
+type repository struct {
+	eventsColl *mongo.Collection
+}
+
+func NewRepository(eventsColl *mongo.Collection) events.Repository {
+	return &repository{
+		eventsColl: eventsColl,
+	}
+}
+
+func (r *repository) SaveEvents(ctx context.Context, events []*entities.Event) error {
+	s := make([]interface{}, len(events))
+	for i, v := range events {
+		s[i] = v
+	}
+
+	if len(s) == 0 {
+		return nil
+	}
+	_, err := r.eventsColl.InsertMany(ctx, s)
+	return err
+}
+
+// GetEvents returns the latest events matching the filter, oldest first.
+func (r *repository) GetEvents(ctx context.Context, filter *entities.EventFilter) ([]*entities.Event, error) {
+	query := bson.M{"user_id": filter.UserID}
+	if filter.CtrlID != "" {
+		query["ctrl_id"] = filter.CtrlID
+	}
+	if filter.Runner != "" {
+		query["runner"] = filter.Runner
+	}
+	if filter.JobID != 0 {
+		query["job_id"] = filter.JobID
+	}
+
+	cursor, err := r.eventsColl.Find(
+		ctx,
+		query,
+		options.Find().
+			SetSort(bson.M{"timestamp": -1}).
+			SetLimit(int64(filter.Limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*entities.Event
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+
+	return events, nil
+}
@@ -0,0 +1,11 @@
+package events
+
+import (
+	"context"
+	"runner-manager-backend/internal/events/dto"
+)
+
+type Usecase interface {
+	SaveEvents(ctx context.Context, userID, ctrlID string, payload *dto.SaveEventsRequest) ([]*dto.EventResponse, error)
+	GetEvents(ctx context.Context, userID string, query *dto.GetEventsQuery) ([]*dto.EventResponse, error)
+}
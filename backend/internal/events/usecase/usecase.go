@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"context"
+	"runner-manager-backend/internal/config"
+	"runner-manager-backend/internal/events"
+	"runner-manager-backend/internal/events/dto"
+	"runner-manager-backend/internal/events/entities"
+	"time"
+)
+
+type usecase struct {
+	repo events.Repository
+	cfg  config.Config
+}
+
+func NewUseCase(repo events.Repository, cfg config.Config) events.Usecase {
+	return &usecase{repo, cfg}
+}
+
+func (uc *usecase) SaveEvents(ctx context.Context, userID, ctrlID string, payload *dto.SaveEventsRequest) ([]*dto.EventResponse, error) {
+	e := make([]*entities.Event, 0, len(payload.Events))
+	for _, event := range payload.Events {
+		e = append(e, entities.NewEvent(userID, ctrlID, &event))
+	}
+
+	if err := uc.repo.SaveEvents(ctx, e); err != nil {
+		return nil, err
+	}
+
+	return toResponse(e), nil
+}
+
+func (uc *usecase) GetEvents(ctx context.Context, userID string, query *dto.GetEventsQuery) ([]*dto.EventResponse, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = dto.DefaultEventsLimit
+	}
+
+	e, err := uc.repo.GetEvents(ctx, &entities.EventFilter{
+		UserID: userID,
+		CtrlID: query.CtrlID,
+		Runner: query.Runner,
+		JobID:  query.JobID,
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toResponse(e), nil
+}
+
+func toResponse(events []*entities.Event) []*dto.EventResponse {
+	rsp := make([]*dto.EventResponse, 0, len(events))
+	for _, event := range events {
+		rsp = append(rsp, &dto.EventResponse{
+			CtrlID:         event.CtrlID,
+			Type:           event.Type,
+			Runner:         event.Runner,
+			Pool:           event.Pool,
+			ARN:            event.ARN,
+			JobID:          event.JobID,
+			RunID:          event.RunID,
+			Status:         event.Status,
+			PreviousStatus: event.PreviousStatus,
+			Reason:         event.Reason,
+			Timestamp:      event.Timestamp.Format(time.RFC3339Nano),
+		})
+	}
+	return rsp
+}
@@ -0,0 +1,42 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// memory delivers the messages within the process, enough for a single replica.
+type memory struct {
+	mu       sync.RWMutex
+	handlers map[int]func(msg *Message)
+	nextID   int
+}
+
+func NewMemory() PubSub {
+	return &memory{handlers: make(map[int]func(msg *Message))}
+}
+
+func (m *memory) Publish(ctx context.Context, msg *Message) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, handle := range m.handlers {
+		handle(msg)
+	}
+	return nil
+}
+
+func (m *memory) Subscribe(ctx context.Context, handle func(msg *Message)) error {
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.handlers[id] = handle
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	delete(m.handlers, id)
+	m.mu.Unlock()
+	return ctx.Err()
+}
@@ -0,0 +1,119 @@
+package pubsub
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"hash/fnv"
+	"runner-manager-backend/internal/infrastructure/logs"
+	"time"
+)
+
+const (
+	// MessageTTL is how long the published messages are kept, as they are only read by the change streams.
+	MessageTTL = time.Minute
+
+	retryBackoff = 5 * time.Second
+
+	// The messages are handled by dispatchWorkers goroutines, the messages of a user always by the same one so
+	// they keep their order. A worker queues up to dispatchQueueSize messages before dropping the next ones.
+	dispatchWorkers   = 8
+	dispatchQueueSize = 256
+)
+
+// mongoPubSub inserts the messages in a collection and delivers them from a change stream of it,
+// so it works across replicas with the database alone. Change streams need a replica set.
+type mongoPubSub struct {
+	coll *mongo.Collection
+}
+
+func NewMongo(coll *mongo.Collection) PubSub {
+	return &mongoPubSub{coll: coll}
+}
+
+// EnsureIndexes creates the TTL index removing the delivered messages.
+func EnsureIndexes(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(MessageTTL.Seconds())),
+	})
+	return err
+}
+
+func (p *mongoPubSub) Publish(ctx context.Context, msg *Message) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	_, err := p.coll.InsertOne(ctx, msg)
+	return err
+}
+
+// Subscribe watches the inserted messages, reopening the change stream after the last delivered
+// one when it fails. The messages are handled off the change stream, so a slow handler does not hold it.
+func (p *mongoPubSub) Subscribe(ctx context.Context, handle func(msg *Message)) error {
+	queues := make([]chan *Message, dispatchWorkers)
+	for i := range queues {
+		queues[i] = make(chan *Message, dispatchQueueSize)
+		go func(queue <-chan *Message) {
+			for msg := range queue {
+				handle(msg)
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+
+	dispatch := func(msg *Message) {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(msg.UserID))
+		select {
+		case queues[h.Sum32()%dispatchWorkers] <- msg:
+		default:
+			logs.ErrorF("Dropped a %s message for user %s: its handler is falling behind", msg.Topic, msg.UserID)
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": "insert"}}},
+	}
+
+	var resumeToken bson.Raw
+	for {
+		opts := options.ChangeStream()
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+
+		stream, err := p.coll.Watch(ctx, pipeline, opts)
+		if err == nil {
+			for stream.Next(ctx) {
+				var event struct {
+					FullDocument Message `bson:"fullDocument"`
+				}
+				if err := stream.Decode(&event); err != nil {
+					logs.ErrorF("Failed to decode a published message: %v", err)
+					continue
+				}
+				resumeToken = stream.ResumeToken()
+				dispatch(&event.FullDocument)
+			}
+			err = stream.Err()
+			_ = stream.Close(context.Background())
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logs.ErrorF("Change stream of %s failed, retrying in %s: %v", p.coll.Name(), retryBackoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryBackoff):
+		}
+	}
+}
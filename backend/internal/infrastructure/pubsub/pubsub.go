@@ -0,0 +1,50 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"runner-manager-backend/internal/config"
+	"time"
+)
+
+const (
+	// TopicRunners tells that the runners of the user changed, so every replica refreshes the
+	// WebSocket subscriptions of the user it holds.
+	TopicRunners = "runners"
+	// TopicUser carries a message to send as is to the WebSocket connections of the user.
+	TopicUser = "user"
+)
+
+// Message is published to every replica of the backend. Data is empty for the topics that only notify.
+type Message struct {
+	UserID    string    `bson:"user_id"`
+	Topic     string    `bson:"topic"`
+	Data      []byte    `bson:"data,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// PubSub delivers the messages published by any replica to the subscribers of all the replicas,
+// so each of them can update the WebSocket connections it holds.
+type PubSub interface {
+	Publish(ctx context.Context, msg *Message) error
+	// Subscribe calls handle with the published messages until ctx is canceled.
+	Subscribe(ctx context.Context, handle func(msg *Message)) error
+}
+
+const (
+	DriverMemory = "memory"
+	DriverMongo  = "mongo"
+)
+
+// New returns the pub/sub of the configured driver, memory by default. The mongo driver publishes in coll.
+func New(cfg config.PubSubConfig, coll *mongo.Collection) (PubSub, error) {
+	switch cfg.Driver {
+	case "", DriverMemory:
+		return NewMemory(), nil
+	case DriverMongo:
+		return NewMongo(coll), nil
+	default:
+		return nil, fmt.Errorf("unsupported pubsub driver %s", cfg.Driver)
+	}
+}
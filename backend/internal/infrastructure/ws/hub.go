@@ -0,0 +1,271 @@
+package ws
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"runner-manager-backend/internal/infrastructure/logs"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWriteWait      = 10 * time.Second
+	DefaultPongWait       = 60 * time.Second
+	DefaultSendQueueSize  = 64
+	DefaultMaxMessageSize = 64 << 10
+)
+
+// ErrClosed is returned when sending to a connection that was unregistered.
+var ErrClosed = errors.New("websocket connection closed")
+
+type Config struct {
+	// WriteWait bounds the time to write a message, after which the connection is dropped.
+	WriteWait time.Duration
+	// PongWait is how long a connection may stay silent before it is dropped. Pings are sent at
+	// 9/10 of it, so live clients always answer in time.
+	PongWait time.Duration
+	// SendQueueSize is the number of messages queued per connection. A client falling behind
+	// by more is evicted, so it cannot slow down the others.
+	SendQueueSize int
+	// MaxMessageSize bounds the messages read from clients.
+	MaxMessageSize int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		WriteWait:      DefaultWriteWait,
+		PongWait:       DefaultPongWait,
+		SendQueueSize:  DefaultSendQueueSize,
+		MaxMessageSize: DefaultMaxMessageSize,
+	}
+}
+
+// Hub tracks the WebSocket connections of the users, any number per user, and fans messages out to
+// them. Each connection has its own send queue drained by a writer goroutine, so senders never block
+// on the network. Server-Sent Events streams register as well and drain their queue themselves.
+type Hub struct {
+	cfg Config
+
+	mu      sync.RWMutex
+	clients map[string]map[*Client]struct{}
+	closed  bool
+}
+
+func NewHub(cfg Config) *Hub {
+	return &Hub{
+		cfg:     cfg,
+		clients: make(map[string]map[*Client]struct{}),
+	}
+}
+
+// Register adds a connection of the user and starts writing its queue to it.
+func (h *Hub) Register(userID string, conn *websocket.Conn) *Client {
+	c := h.register(userID, conn)
+	go c.writePump()
+	return c
+}
+
+// RegisterStream adds a client of the user without a WebSocket connection, such as a Server-Sent
+// Events stream, which drains Messages itself.
+func (h *Hub) RegisterStream(userID string) *Client {
+	return h.register(userID, nil)
+}
+
+func (h *Hub) register(userID string, conn *websocket.Conn) *Client {
+	c := &Client{
+		hub:    h,
+		userID: userID,
+		conn:   conn,
+		send:   make(chan []byte, h.cfg.SendQueueSize),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		c.close()
+		return c
+	}
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*Client]struct{})
+	}
+	h.clients[userID][c] = struct{}{}
+	h.mu.Unlock()
+
+	return c
+}
+
+// Unregister removes the connection and closes it. It is safe to call more than once.
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	if userClients, ok := h.clients[c.userID]; ok {
+		delete(userClients, c)
+		if len(userClients) == 0 {
+			delete(h.clients, c.userID)
+		}
+	}
+	h.mu.Unlock()
+
+	c.close()
+}
+
+// SendToUser queues the message on every connection of the user, if the user is connected.
+func (h *Hub) SendToUser(userID string, data []byte) {
+	for _, c := range h.Clients(userID) {
+		_ = c.Send(data)
+	}
+}
+
+// Broadcast queues the message on every connection.
+func (h *Hub) Broadcast(data []byte) {
+	h.mu.RLock()
+	all := make([]*Client, 0, len(h.clients))
+	for _, userClients := range h.clients {
+		for c := range userClients {
+			all = append(all, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range all {
+		_ = c.Send(data)
+	}
+}
+
+// Clients returns the connections of the user.
+func (h *Hub) Clients(userID string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(h.clients[userID]))
+	for c := range h.clients[userID] {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// IsConnected tells whether the user has at least one connection.
+func (h *Hub) IsConnected(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID]) > 0
+}
+
+// Close unregisters all the connections and refuses new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	all := h.clients
+	h.clients = make(map[string]map[*Client]struct{})
+	h.mu.Unlock()
+
+	for _, userClients := range all {
+		for c := range userClients {
+			c.close()
+		}
+	}
+}
+
+// Client is a WebSocket connection or an event stream registered in the hub.
+type Client struct {
+	hub    *Hub
+	userID string
+	conn   *websocket.Conn
+
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *Client) UserID() string {
+	return c.userID
+}
+
+// Messages returns the queue of a stream client.
+func (c *Client) Messages() <-chan []byte {
+	return c.send
+}
+
+// Done is closed when the client is unregistered.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// KeepAlive is how often streams should send something, so proxies and the hub keep them open.
+func (c *Client) KeepAlive() time.Duration {
+	return c.hub.cfg.PongWait * 9 / 10
+}
+
+// Send queues the message for this connection only. A connection whose queue is full is evicted.
+func (c *Client) Send(data []byte) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case c.send <- data:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	default:
+		logs.InfoF("Evicting a slow WebSocket client of user %s", c.userID)
+		c.hub.Unregister(c)
+		return ErrClosed
+	}
+}
+
+// ReadMessages calls handle with the messages of the client until the connection fails or is
+// closed, then unregisters it. Pongs extend the read deadline, so silent clients are dropped.
+func (c *Client) ReadMessages(handle func(message []byte)) error {
+	defer c.hub.Unregister(c)
+
+	c.conn.SetReadLimit(c.hub.cfg.MaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(c.hub.cfg.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.hub.cfg.PongWait))
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		handle(message)
+	}
+}
+
+// writePump writes the queued messages and the pings, the only writer of the connection.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.KeepAlive())
+	defer ticker.Stop()
+	defer c.hub.Unregister(c)
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case data := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// close stops the writer and closes the connection, which also ends ReadMessages.
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.conn != nil {
+			_ = c.conn.Close()
+		}
+	})
+}
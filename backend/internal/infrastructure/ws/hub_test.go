@@ -0,0 +1,276 @@
+package ws
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testTimeout = 2 * time.Second
+
+// testServer upgrades the requests to WebSocket connections of the user of the "user" query parameter,
+// registers them with register and reads them until they are closed. The registered clients are sent
+// on the returned channel.
+func testServer(t *testing.T, hub *Hub, register func(userID string, conn *websocket.Conn) *Client) (*httptest.Server, <-chan *Client) {
+	t.Helper()
+
+	clients := make(chan *Client, 16)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := register(r.URL.Query().Get("user"), conn)
+		clients <- c
+		_ = c.ReadMessages(func([]byte) {})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, clients
+}
+
+// dial connects as the user and waits for the connection to be registered.
+func dial(t *testing.T, srv *httptest.Server, clients <-chan *Client, userID string) (*websocket.Conn, *Client) {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?user="+userID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	select {
+	case c := <-clients:
+		return conn, c
+	case <-time.After(testTimeout):
+		t.Fatal("connection not registered")
+		return nil, nil
+	}
+}
+
+func expectMessage(t *testing.T, conn *websocket.Conn, want string) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(testTimeout))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	if string(message) != want {
+		t.Fatalf("got %q, want %q", message, want)
+	}
+}
+
+// expectClosed checks that the server closes the connection.
+func expectClosed(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(testTimeout))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("connection still open")
+			}
+			return
+		}
+	}
+}
+
+func expectDone(t *testing.T, c *Client) {
+	t.Helper()
+
+	select {
+	case <-c.Done():
+	case <-time.After(testTimeout):
+		t.Fatal("client not unregistered")
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	hub := NewHub(DefaultConfig())
+	srv, clients := testServer(t, hub, hub.Register)
+
+	first, _ := dial(t, srv, clients, "user-1")
+	second, _ := dial(t, srv, clients, "user-1")
+	other, _ := dial(t, srv, clients, "user-2")
+
+	if got := len(hub.Clients("user-1")); got != 2 {
+		t.Fatalf("user-1 has %d connections, want 2", got)
+	}
+	if !hub.IsConnected("user-2") || hub.IsConnected("user-3") {
+		t.Fatal("unexpected connected users")
+	}
+
+	// The queues are in order, so the next message of each connection tells what it was sent before
+	hub.SendToUser("user-1", []byte("to user-1"))
+	hub.SendToUser("user-3", []byte("to nobody"))
+	hub.Broadcast([]byte("to all"))
+
+	expectMessage(t, first, "to user-1")
+	expectMessage(t, second, "to user-1")
+	for _, conn := range []*websocket.Conn{first, second, other} {
+		expectMessage(t, conn, "to all")
+	}
+}
+
+func TestClientClosedByPeer(t *testing.T) {
+	hub := NewHub(DefaultConfig())
+	srv, clients := testServer(t, hub, hub.Register)
+
+	conn, c := dial(t, srv, clients, "user-1")
+	remaining, _ := dial(t, srv, clients, "user-1")
+
+	_ = conn.Close()
+	expectDone(t, c)
+
+	if got := len(hub.Clients("user-1")); got != 1 {
+		t.Fatalf("user-1 has %d connections, want 1", got)
+	}
+	hub.SendToUser("user-1", []byte("still there"))
+	expectMessage(t, remaining, "still there")
+}
+
+func TestSlowConsumerEviction(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SendQueueSize = 2
+	hub := NewHub(cfg)
+
+	// Without its writer, the queue of the connection is never drained, as if the client had stopped reading
+	srv, clients := testServer(t, hub, hub.register)
+	conn, slow := dial(t, srv, clients, "user-1")
+
+	for i := 0; i < cfg.SendQueueSize; i++ {
+		if err := slow.Send([]byte("queued")); err != nil {
+			t.Fatalf("send %d: %s", i, err)
+		}
+	}
+	if err := slow.Send([]byte("overflow")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send to a full queue: got %v, want ErrClosed", err)
+	}
+
+	expectDone(t, slow)
+	expectClosed(t, conn)
+	if hub.IsConnected("user-1") {
+		t.Fatal("slow client still registered")
+	}
+	if err := slow.Send([]byte("after eviction")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send after eviction: got %v, want ErrClosed", err)
+	}
+}
+
+func TestSlowConsumerDoesNotAffectOthers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SendQueueSize = 2
+	hub := NewHub(cfg)
+
+	srv, clients := testServer(t, hub, hub.Register)
+	fast, _ := dial(t, srv, clients, "user-1")
+	slow := hub.RegisterStream("user-1")
+	for i := 0; i < cfg.SendQueueSize; i++ {
+		if err := slow.Send([]byte("queued")); err != nil {
+			t.Fatalf("send %d: %s", i, err)
+		}
+	}
+
+	hub.SendToUser("user-1", []byte("fan-out"))
+
+	expectDone(t, slow)
+	expectMessage(t, fast, "fan-out")
+	if got := len(hub.Clients("user-1")); got != 1 {
+		t.Fatalf("user-1 has %d connections, want 1", got)
+	}
+}
+
+func TestPongDeadline(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PongWait = 500 * time.Millisecond
+	hub := NewHub(cfg)
+	srv, clients := testServer(t, hub, hub.Register)
+
+	// The client answers the pings while it reads, so it outlives the pong wait
+	live, liveClient := dial(t, srv, clients, "live")
+	go func() {
+		for {
+			if _, _, err := live.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// The client never reads, so the pings are not answered
+	_, silentClient := dial(t, srv, clients, "silent")
+
+	expectDone(t, silentClient)
+	if hub.IsConnected("silent") {
+		t.Fatal("silent client still registered")
+	}
+
+	time.Sleep(3 * cfg.PongWait)
+	select {
+	case <-liveClient.Done():
+		t.Fatal("live client dropped")
+	default:
+	}
+	if !hub.IsConnected("live") {
+		t.Fatal("live client not registered")
+	}
+}
+
+func TestUnregisterTwice(t *testing.T) {
+	hub := NewHub(DefaultConfig())
+	srv, clients := testServer(t, hub, hub.Register)
+
+	conn, c := dial(t, srv, clients, "user-1")
+	other, _ := dial(t, srv, clients, "user-1")
+
+	hub.Unregister(c)
+	hub.Unregister(c)
+
+	expectDone(t, c)
+	expectClosed(t, conn)
+	if err := c.Send([]byte("closed")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send after unregister: got %v, want ErrClosed", err)
+	}
+	if got := len(hub.Clients("user-1")); got != 1 {
+		t.Fatalf("user-1 has %d connections, want 1", got)
+	}
+
+	hub.SendToUser("user-1", []byte("other"))
+	expectMessage(t, other, "other")
+}
+
+func TestClose(t *testing.T) {
+	hub := NewHub(DefaultConfig())
+	srv, clients := testServer(t, hub, hub.Register)
+
+	first, firstClient := dial(t, srv, clients, "user-1")
+	second, secondClient := dial(t, srv, clients, "user-2")
+	stream := hub.RegisterStream("user-1")
+
+	hub.Close()
+
+	for _, c := range []*Client{firstClient, secondClient, stream} {
+		expectDone(t, c)
+	}
+	expectClosed(t, first)
+	expectClosed(t, second)
+	if hub.IsConnected("user-1") || hub.IsConnected("user-2") {
+		t.Fatal("clients still registered")
+	}
+
+	late := hub.RegisterStream("user-1")
+	expectDone(t, late)
+	if hub.IsConnected("user-1") {
+		t.Fatal("client registered after Close")
+	}
+
+	// Unregistering after Close is a no-op
+	hub.Unregister(firstClient)
+}
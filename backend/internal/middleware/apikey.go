@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"runner-manager-backend/internal/config"
+	"runner-manager-backend/pkg/response"
+	"runner-manager-backend/pkg/utils"
+)
+
+// ApiKeyLookup returns the token data of the user owning the API key.
+type ApiKeyLookup func(ctx context.Context, apiKey string) (*Data, error)
+
+// ApiKeyMiddleware authenticates with the API key of the user, sent as the password of basic auth or
+// in the X-Api-Key header, for clients such as Grafana that cannot refresh JWT tokens. Requests
+// without an API key fall back to the JWT token.
+func ApiKeyMiddleware(cfg config.Config, lookup ApiKeyLookup) gin.HandlerFunc {
+	jwtMiddleware := JWTMiddleware(cfg)
+
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader("X-Api-Key")
+		if _, password, ok := c.Request.BasicAuth(); ok {
+			apiKey = password
+		}
+
+		if apiKey == "" {
+			jwtMiddleware(c)
+			return
+		}
+
+		data, err := lookup(c, apiKey)
+		if err != nil {
+			response.ErrorBuilder(response.Unauthorized(errors.New("invalid API key"))).Send(c)
+			c.Abort()
+			return
+		}
+
+		c.Set(utils.AuthCtxKey, &PayloadToken{Data: data})
+
+		c.Next()
+	}
+}
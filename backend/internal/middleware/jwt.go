@@ -21,11 +21,30 @@ type Data struct {
 	Email  string `json:"email"`
 }
 
+// StreamAudience is the audience of the tokens of the event stream, which only StreamJWTMiddleware accepts.
+const StreamAudience = "stream"
+
 // JWTMiddleware Middleware function to validate JWT token
 func JWTMiddleware(cfg config.Config) gin.HandlerFunc {
+	return jwtMiddleware(cfg, func(claims *PayloadToken, fromQuery bool) bool {
+		return claims.Audience != StreamAudience
+	})
+}
+
+// StreamJWTMiddleware accepts the user tokens in the Authorization header, and only the tokens of the
+// event stream in the query string, where EventSource sends them. They are checked when the stream is
+// opened, so a stream lives on past the expiry of the token it was opened with.
+func StreamJWTMiddleware(cfg config.Config) gin.HandlerFunc {
+	return jwtMiddleware(cfg, func(claims *PayloadToken, fromQuery bool) bool {
+		return !fromQuery || claims.Audience == StreamAudience
+	})
+}
+
+func jwtMiddleware(cfg config.Config, accept func(claims *PayloadToken, fromQuery bool) bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
-		if tokenString == "" {
+		fromQuery := tokenString == ""
+		if fromQuery {
 			tokenString = c.Query("token")
 		} else {
 			// Remove "Bearer " prefix from token string
@@ -58,6 +77,11 @@ func JWTMiddleware(cfg config.Config) gin.HandlerFunc {
 
 		// Store the token claims in the request context for later use
 		claims := token.Claims.(*PayloadToken)
+		if !accept(claims, fromQuery) {
+			response.ErrorBuilder(response.Unauthorized(errors.New("JWT token is not valid for this route"))).Send(c)
+			c.Abort()
+			return
+		}
 		c.Set(utils.AuthCtxKey, claims)
 
 		c.Next()
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"runner-manager-backend/internal/config"
+)
+
+func signToken(t *testing.T, cfg config.Config, audience string) string {
+	t.Helper()
+
+	claims := PayloadToken{
+		Data: &Data{UserID: "65f0c2a1b3d4e5f600000001"},
+		StandardClaims: jwt.StandardClaims{
+			Audience:  audience,
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWT.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestJWTMiddlewareAudience(t *testing.T) {
+	cfg := config.Config{JWT: config.JWTConfig{Key: "secret"}}
+	userToken := signToken(t, cfg, "")
+	streamToken := signToken(t, cfg, StreamAudience)
+
+	tests := map[string]struct {
+		middleware gin.HandlerFunc
+		header     string
+		query      string
+		want       int
+	}{
+		"user token in header":           {JWTMiddleware(cfg), userToken, "", http.StatusOK},
+		"stream token in header":         {JWTMiddleware(cfg), streamToken, "", http.StatusUnauthorized},
+		"stream token in query":          {JWTMiddleware(cfg), "", streamToken, http.StatusUnauthorized},
+		"stream: user token in header":   {StreamJWTMiddleware(cfg), userToken, "", http.StatusOK},
+		"stream: stream token in header": {StreamJWTMiddleware(cfg), streamToken, "", http.StatusOK},
+		"stream: stream token in query":  {StreamJWTMiddleware(cfg), "", streamToken, http.StatusOK},
+		"stream: user token in query":    {StreamJWTMiddleware(cfg), "", userToken, http.StatusUnauthorized},
+		"stream: missing token":          {StreamJWTMiddleware(cfg), "", "", http.StatusUnauthorized},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for name, tt := range tests {
+		router := gin.New()
+		router.GET("/events", tt.middleware, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.header)
+		}
+		if tt.query != "" {
+			req.URL.RawQuery = "token=" + tt.query
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", name, rec.Code, tt.want)
+		}
+	}
+}
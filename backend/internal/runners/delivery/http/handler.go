@@ -1,45 +1,80 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"net/http"
 	"runner-manager-backend/internal/infrastructure/logs"
+	"runner-manager-backend/internal/infrastructure/pubsub"
+	"runner-manager-backend/internal/infrastructure/ws"
 	"runner-manager-backend/internal/middleware"
 	"runner-manager-backend/internal/runners"
 	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/internal/runners/usecase"
 	"runner-manager-backend/pkg/response"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type handlers struct {
-	uc runners.Usecase
+	uc  runners.Usecase
+	hub *ws.Hub
+	ps  pubsub.PubSub
+
+	// sessions holds the subscription of every WebSocket connection.
+	mu       sync.Mutex
+	sessions map[*ws.Client]*UserWS
 }
 
+// refreshTimeout bounds the queries made to update the WebSocket connections of a user.
+const refreshTimeout = 30 * time.Second
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{dto.WSProtocolV2},
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
-// Mapping of JWT tokens to WebSocket connections
-var tokenToConn = make(map[string]*UserWS)
-
+// UserWS is the subscription of a WebSocket connection. A user may have several, one per browser tab.
 type UserWS struct {
-	Data       *RequestWSData
-	Connection *websocket.Conn
+	mu     sync.Mutex
+	Data   *RequestWSData
+	Client *ws.Client
+
+	// MetricsSince is where the next metrics update resumes, and MetricsStep the step of the series
+	// already sent, so the updates line up with them.
+	MetricsSince time.Time
+	MetricsStep  string
+
+	// V2 is the subscription of the connections using the versioned protocol, nil for the others.
+	V2 *subscriptionV2
 }
 
+// RequestWSData subscribes to the events of a controller. For metrics, From, Step and Fields are
+// those of the metrics query API, and the following updates only carry the steps after the last one sent.
+// The event stream takes it from the query string.
 type RequestWSData struct {
-	CtrlID string `json:"ctrl_id"`
-	Event  string `json:"event"`
+	CtrlID string    `json:"ctrl_id" form:"ctrl_id"`
+	Event  string    `json:"event" form:"-"`
+	From   time.Time `json:"from" form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	Step   string    `json:"step" form:"step"`
+	Fields string    `json:"fields" form:"fields"`
 }
 
-func NewHandlers(uc runners.Usecase) *handlers {
-	return &handlers{uc}
+func NewHandlers(uc runners.Usecase, hub *ws.Hub, ps pubsub.PubSub) *handlers {
+	return &handlers{
+		uc:       uc,
+		hub:      hub,
+		ps:       ps,
+		sessions: make(map[*ws.Client]*UserWS),
+	}
 }
 
 func (h *handlers) UpdateRunners(c *gin.Context) {
@@ -70,164 +105,465 @@ func (h *handlers) UpdateRunners(c *gin.Context) {
 		return
 	}
 
-	_, err = h.uc.UpdateRunners(c, userData.Data.UserID, userData.Data.CtrlID, payload)
+	err = h.uc.UpdateRunners(c, userData.Data.UserID, userData.Data.CtrlID, payload)
 	if err != nil {
 		response.ErrorBuilder(err).Send(c)
 		return
 	}
 
-	userWS, ok := tokenToConn[userData.Data.UserID]
-	if !ok {
-		response.SuccessBuilder(nil).Send(c)
+	// The user may be connected to another replica, which refreshes its connections on the message.
+	err = h.ps.Publish(c, &pubsub.Message{UserID: userData.Data.UserID, Topic: pubsub.TopicRunners})
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
 		return
 	}
 
-	err = h.updateControllersWS(c, userData)
+	response.SuccessBuilder(nil).Send(c)
+}
+
+// GetAnalytics returns queue latency, job duration, utilization and failure rates over a time range.
+func (h *handlers) GetAnalytics(c *gin.Context) {
+	var query dto.AnalyticsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	query.Normalize()
+	if err := query.Validate(); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
 	if err != nil {
 		response.ErrorBuilder(err).Send(c)
 		return
 	}
 
-	err = h.updateMetricsWS(userData, userWS.Data, c)
+	rsp, err := h.uc.GetAnalytics(c, userData.Data.UserID, &query)
 	if err != nil {
 		response.ErrorBuilder(err).Send(c)
 		return
 	}
 
-	response.SuccessBuilder(nil).Send(c)
+	response.SuccessBuilder(rsp).Send(c)
 }
 
-func (h *handlers) updateControllersWS(c *gin.Context, userData *middleware.PayloadToken) error {
-	ctrls, err := h.uc.GetAllCtrlsByUserID(c, userData.Data.UserID)
+// GetCosts returns the estimated cost of the runners over a time range, as JSON or as a CSV file.
+func (h *handlers) GetCosts(c *gin.Context) {
+	var query dto.CostQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	query.Normalize()
+	if err := query.Validate(); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
 	if err != nil {
-		return err
+		response.ErrorBuilder(err).Send(c)
+		return
 	}
 
-	res := map[string]interface{}{
-		"event": "ctrls",
-		"data":  ctrls,
+	rsp, err := h.uc.GetCosts(c, userData.Data.UserID, &query)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
 	}
 
-	if len(ctrls) == 0 {
-		res["empty"] = true
+	if query.Format == dto.CostFormatCSV {
+		data, err := usecase.CostsCSV(rsp)
+		if err != nil {
+			response.ErrorBuilder(err).Send(c)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=costs-%s.csv", query.GroupBy))
+		c.Data(http.StatusOK, "text/csv", data)
+		return
 	}
 
-	jsonData, err := json.Marshal(&res)
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+// GetForecast returns the hourly demand forecast of the pools, pulled by the controllers and shown to users.
+func (h *handlers) GetForecast(c *gin.Context) {
+	var query dto.ForecastQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+	maxSizes, err := bindMaxSizes(c)
 	if err != nil {
-		return err
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+	query.MaxSizes = maxSizes
+
+	if err := query.Validate(); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.GetForecast(c, userData.Data.UserID, &query)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+// GetRunnerMetrics returns the metrics series of a runner over a time range.
+func (h *handlers) GetRunnerMetrics(c *gin.Context) {
+	query, err := bindMetricsQuery(c)
+	if err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.GetRunnerMetrics(c, userData.Data.UserID, c.Param("id"), query)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+// GetCtrlMetrics returns the metrics series of all the runners of a controller over a time range.
+func (h *handlers) GetCtrlMetrics(c *gin.Context) {
+	query, err := bindMetricsQuery(c)
+	if err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.GetCtrlMetrics(c, userData.Data.UserID, c.Param("id"), query)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+func bindMetricsQuery(c *gin.Context) (*dto.MetricsQuery, error) {
+	var query dto.MetricsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return nil, err
+	}
+
+	query.Normalize()
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return &query, nil
+}
+
+// bindMaxSizes reads the max_size[pool]=size query parameters of the forecast.
+func bindMaxSizes(c *gin.Context) (map[string]int, error) {
+	values := c.QueryMap("max_size")
+	maxSizes := make(map[string]int, len(values))
+	for pool, value := range values {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("max_size of pool %s must be an integer", pool)
+		}
+		maxSizes[pool] = size
+	}
+	return maxSizes, nil
+}
+
+func (h *handlers) GetRunnerLogs(c *gin.Context) {
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	lines := usecase.DefaultLogLines
+	if value := c.Query("lines"); value != "" {
+		lines, err = strconv.Atoi(value)
+		if err != nil || lines < 1 || lines > usecase.MaxLogLines {
+			response.ErrorBuilder(response.BadRequest(fmt.Errorf("lines must be between 1 and %d", usecase.MaxLogLines))).Send(c)
+			return
+		}
+	}
+
+	rsp, err := h.uc.GetRunnerLogs(c, userData.Data.UserID, c.Param("id"), lines)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+// Listen delivers the published messages to the WebSocket connections of this replica until ctx is canceled.
+func (h *handlers) Listen(ctx context.Context) {
+	err := h.ps.Subscribe(ctx, func(msg *pubsub.Message) {
+		if !h.hub.IsConnected(msg.UserID) {
+			return
+		}
+
+		switch msg.Topic {
+		case pubsub.TopicUser:
+			for _, session := range h.userSessions(msg.UserID) {
+				if session.V2 != nil {
+					h.forwardV2(session, msg.Data)
+					continue
+				}
+				_ = session.Client.Send(msg.Data)
+			}
+		case pubsub.TopicRunners:
+			if err := h.refreshUserWS(ctx, msg.UserID); err != nil {
+				logs.ErrorF("Failed to update the WebSocket connections of user %s: %v", msg.UserID, err)
+			}
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		logs.ErrorF("Failed to subscribe to WebSocket updates: %v", err)
 	}
+}
 
-	logs.Info("Sending data to user")
+// SendToUser publishes data for the WebSocket connections of the user, on whichever replica they are.
+func (h *handlers) SendToUser(userID string, data []byte) {
+	err := h.ps.Publish(context.Background(), &pubsub.Message{UserID: userID, Topic: pubsub.TopicUser, Data: data})
+	if err != nil {
+		logs.ErrorF("Failed to publish to user %s: %v", userID, err)
+	}
+}
 
-	sendToUser(userData.Data.UserID, jsonData)
+// refreshUserWS sends the controllers and the new metrics to the connections of the user. A connection
+// failing to get its metrics does not keep the next ones from being refreshed.
+func (h *handlers) refreshUserWS(ctx context.Context, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
 
+	ctrls, err := h.uc.GetAllCtrlsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	data, err := ctrlsMessage(ctrls)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range h.userSessions(userID) {
+		if session.V2 != nil {
+			h.syncV2(ctx, userID, session, ctrls, false)
+			continue
+		}
+
+		_ = session.Client.Send(data)
+		if err := h.updateMetricsWS(ctx, userID, session); err != nil {
+			logs.ErrorF("Failed to update the metrics of a WebSocket connection of user %s: %v", userID, err)
+		}
+	}
 	return nil
 }
 
-func (h *handlers) updateMetricsWS(userData *middleware.PayloadToken, data *RequestWSData, c *gin.Context) error {
+// controllersWS builds the ctrls event with the controllers and runners of the user.
+func (h *handlers) controllersWS(ctx context.Context, userID string) ([]byte, error) {
+	ctrls, err := h.uc.GetAllCtrlsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return ctrlsMessage(ctrls)
+}
+
+func ctrlsMessage(ctrls []*dto.RunnerControllerWSResponse) ([]byte, error) {
+	res := map[string]interface{}{
+		"event": "ctrls",
+		"data":  ctrls,
+	}
+
+	if len(ctrls) == 0 {
+		res["empty"] = true
+	}
+
+	return json.Marshal(&res)
+}
+
+// updateMetricsWS sends the metrics of the subscribed controller. The first update covers the
+// requested range, the following ones only the steps completed since the previous update.
+func (h *handlers) updateMetricsWS(ctx context.Context, userID string, user *UserWS) error {
+	user.mu.Lock()
+	defer user.mu.Unlock()
+
+	data := user.Data
 	if data.CtrlID == "" {
-		logs.InfoF("CtrlID is missing, skipping")
+		logs.Info("CtrlID is missing, skipping")
 		return nil
 	}
 
-	metrics, err := h.uc.GetAllMetricsByCtrlID(c, userData.Data.UserID, data.CtrlID)
+	incremental := !user.MetricsSince.IsZero()
+	query, err := nextMetricsQuery(data.From, data.Step, data.Fields, user.MetricsSince, user.MetricsStep)
+	if err != nil || query == nil {
+		return err
+	}
+
+	metrics, err := h.uc.GetCtrlMetrics(ctx, userID, data.CtrlID, query)
 	if err != nil {
 		return err
 	}
 
+	user.MetricsSince, user.MetricsStep, err = metricsWatermark(metrics)
+	if err != nil {
+		return err
+	}
+
+	if incremental && len(metrics.Timestamps) == 0 {
+		return nil
+	}
+
+	// The ID tells where the metrics resume, so the event stream can continue from Last-Event-ID.
 	res := map[string]interface{}{
-		"event": "metrics",
-		"data":  metrics,
+		"event":       "metrics",
+		"id":          metricsEventID(user.MetricsSince, user.MetricsStep),
+		"incremental": incremental,
+		"data":        metrics,
 	}
 
 	jsonData, err := json.Marshal(&res)
 	if err != nil {
 		return err
 	}
-	logs.Info("Sending data to user")
 
-	sendToUser(userData.Data.UserID, jsonData)
+	return user.Client.Send(jsonData)
+}
 
-	return nil
+// nextMetricsQuery returns the query of the next metrics update: the requested range for the first
+// one, then the steps after since. It returns nil when no step was completed since.
+func nextMetricsQuery(from time.Time, step, fields string, since time.Time, sinceStep string) (*dto.MetricsQuery, error) {
+	query := &dto.MetricsQuery{
+		From:   from,
+		Step:   step,
+		Fields: fields,
+	}
+	if !since.IsZero() {
+		query.From = since
+		query.Step = sinceStep
+	}
+
+	query.Normalize()
+	if !query.From.Before(query.To) {
+		return nil, nil
+	}
+	if err := query.Validate(); err != nil {
+		return nil, response.BadRequest(err)
+	}
+	return query, nil
 }
 
-func (h *handlers) WsCtrl(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+// metricsWatermark returns where the metrics resume after the response, and the step to keep.
+func metricsWatermark(metrics *dto.MetricsResponse) (time.Time, string, error) {
+	to, err := time.Parse(time.RFC3339, metrics.To)
 	if err != nil {
-		fmt.Println("Failed to upgrade to WebSocket:", err)
-		return
+		return time.Time{}, "", err
 	}
-	defer conn.Close()
+	return to, (time.Duration(metrics.StepSeconds) * time.Second).String(), nil
+}
 
-	// Validate JWT token (implement your token validation logic here)
-	// For simplicity, let's assume a function validateToken(token string) bool
+func (h *handlers) WsCtrl(c *gin.Context) {
 	tokenPayload, err := middleware.NewTokenInformation(c)
 	if err != nil {
 		response.ErrorBuilder(err).Send(c)
 		return
 	}
-	fmt.Println("User ID:", tokenPayload.Data.UserID)
 
-	user := &UserWS{
-		Data:       &RequestWSData{},
-		Connection: conn,
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logs.ErrorF("Failed to upgrade to WebSocket: %v", err)
+		return
 	}
-	// Associate WebSocket connection with JWT token
-	tokenToConn[tokenPayload.Data.UserID] = user
-	defer delete(tokenToConn, tokenPayload.Data.UserID) // Remove the entry from the map when the connection closes
 
-	// Handle WebSocket connection
-	for {
-		// Read message from WebSocket client
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			logs.InfoF("Read error: ", err)
-			break
+	user := &UserWS{
+		Data:   &RequestWSData{},
+		Client: h.hub.Register(tokenPayload.Data.UserID, conn),
+	}
+	if conn.Subprotocol() == dto.WSProtocolV2 {
+		user.V2 = newSubscriptionV2()
+	}
+	h.mu.Lock()
+	h.sessions[user.Client] = user
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.sessions, user.Client)
+		h.mu.Unlock()
+	}()
+
+	err = user.Client.ReadMessages(func(message []byte) {
+		if user.V2 != nil {
+			h.handleV2(c, tokenPayload.Data.UserID, user, message)
+			return
 		}
 
 		data := &RequestWSData{}
-
-		if err = json.Unmarshal(message, &data); err != nil {
-			logs.InfoF("Error unmarshalling message:", err)
+		if err := json.Unmarshal(message, &data); err != nil {
+			logs.InfoF("Error unmarshalling message: %v", err)
 			return
 		}
 
-		if _, ok := tokenToConn[tokenPayload.Data.UserID]; ok {
-			tokenToConn[tokenPayload.Data.UserID].Data = data
-		}
+		// A new subscription starts the metrics over from the requested range.
+		user.mu.Lock()
+		user.Data = data
+		user.MetricsSince = time.Time{}
+		user.mu.Unlock()
 
-		if data.Event != "" {
-			switch data.Event {
-			case "metrics":
-				err = h.updateMetricsWS(tokenPayload, data, c)
-				if err != nil {
-					logs.InfoF("Error updating metrics:", err)
-					return
-				}
-			case "ctrls":
-				err = h.updateControllersWS(c, tokenPayload)
-				if err != nil {
-					logs.InfoF("Error updating controllers:", err)
-					return
-				}
+		switch data.Event {
+		case "metrics":
+			if err := h.updateMetricsWS(c, tokenPayload.Data.UserID, user); err != nil {
+				logs.InfoF("Error updating metrics: %v", err)
+			}
+		case "ctrls":
+			ctrls, err := h.controllersWS(c, tokenPayload.Data.UserID)
+			if err != nil {
+				logs.InfoF("Error updating controllers: %v", err)
+				return
 			}
+			_ = user.Client.Send(ctrls)
 		}
-
-		logs.InfoF("Received message: %s", message)
-	}
+	})
+	logs.InfoF("WebSocket of user %s closed: %v", tokenPayload.Data.UserID, err)
 }
 
-// Send data to the user associated with the JWT token
-func sendToUser(userID string, data []byte) {
-	// Get WebSocket connection associated with the JWT token
-	user, ok := tokenToConn[userID]
-	if !ok {
-		fmt.Println("No WebSocket connection found for token:", userID)
-		return
-	}
+// userSessions returns the subscriptions of the connections of the user.
+func (h *handlers) userSessions(userID string) []*UserWS {
+	clients := h.hub.Clients(userID)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	// Send the data to the user's WebSocket connection
-	if err := user.Connection.WriteMessage(websocket.TextMessage, data); err != nil {
-		fmt.Println("Error sending data to user:", err)
+	sessions := make([]*UserWS, 0, len(clients))
+	for _, client := range clients {
+		if session, ok := h.sessions[client]; ok {
+			sessions = append(sessions, session)
+		}
 	}
+	return sessions
 }
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"runner-manager-backend/internal/middleware"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/pkg/remotewrite"
+	"runner-manager-backend/pkg/response"
+	"strings"
+)
+
+const (
+	// MaxRemoteWriteSize bounds the compressed body of remote-write requests.
+	MaxRemoteWriteSize = 32 << 20
+	// MaxRemoteWriteDecodedSize bounds the decompressed body of remote-write requests.
+	MaxRemoteWriteDecodedSize = 64 << 20
+)
+
+// QueryRange implements /api/v1/query_range of the Prometheus HTTP API over the stored metrics.
+func (h *handlers) QueryRange(c *gin.Context) {
+	var query dto.PromQueryRangeQuery
+	if err := c.ShouldBind(&query); err != nil {
+		sendPromError(c, response.BadRequest(err))
+		return
+	}
+	if err := query.Parse(); err != nil {
+		sendPromError(c, response.BadRequest(err))
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		sendPromError(c, err)
+		return
+	}
+
+	rsp, err := h.uc.QueryRange(c, userData.Data.UserID, &query)
+	if err != nil {
+		sendPromError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.PromResponse{Status: dto.PromStatusSuccess, Data: rsp})
+}
+
+// GetSeries implements /api/v1/series of the Prometheus HTTP API over the stored metrics.
+func (h *handlers) GetSeries(c *gin.Context) {
+	var query dto.PromSeriesQuery
+	if err := c.ShouldBind(&query); err != nil {
+		sendPromError(c, response.BadRequest(err))
+		return
+	}
+	if err := query.Parse(); err != nil {
+		sendPromError(c, response.BadRequest(err))
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		sendPromError(c, err)
+		return
+	}
+
+	rsp, err := h.uc.GetSeries(c, userData.Data.UserID, &query)
+	if err != nil {
+		sendPromError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.PromResponse{Status: dto.PromStatusSuccess, Data: rsp})
+}
+
+// sendPromError sends the error in the envelope of the Prometheus HTTP API.
+func sendPromError(c *gin.Context, err error) {
+	code, errorType := http.StatusInternalServerError, dto.PromErrorInternal
+
+	var appErr *response.AppError
+	if errors.As(err, &appErr) {
+		code = appErr.Code
+		if code == http.StatusBadRequest {
+			errorType = dto.PromErrorBadData
+		}
+	}
+
+	c.JSON(code, dto.PromResponse{Status: dto.PromStatusError, ErrorType: errorType, Error: err.Error()})
+}
+
+// RemoteWrite implements the receiver of the Prometheus remote-write protocol, so controllers or
+// Prometheus agents scraping the runners can push their metrics. Series are mapped to runners by
+// their runner_id or runner label.
+func (h *handlers) RemoteWrite(c *gin.Context) {
+	if !strings.EqualFold(c.GetHeader("Content-Encoding"), "snappy") {
+		response.ErrorBuilder(response.BadRequest(errors.New("remote-write requests must be snappy encoded"))).Send(c)
+		return
+	}
+	if strings.Contains(c.GetHeader("Content-Type"), "io.prometheus.write.v2") {
+		response.ErrorBuilder(response.BadRequest(remotewrite.ErrUnsupportedVersion)).Send(c)
+		return
+	}
+
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxRemoteWriteSize))
+	if err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	req, err := remotewrite.Decode(body, MaxRemoteWriteDecodedSize)
+	if err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.RemoteWrite(c, userData.Data.UserID, userData.Data.CtrlID, req)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
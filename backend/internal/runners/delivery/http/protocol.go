@@ -0,0 +1,473 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runner-manager-backend/internal/infrastructure/logs"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/pkg/response"
+	"sort"
+	"time"
+)
+
+// subscriptionV2 is the state of a connection using the versioned protocol, guarded by the mutex of
+// its UserWS. A connection follows everything until it subscribes to some controllers, runners or
+// events; from then on it only follows those, as described in docs/websocket-protocol.md.
+type subscriptionV2 struct {
+	ctrlIDs    map[string]struct{}
+	runnerIDs  map[string]struct{}
+	events     map[string]struct{}
+	allRunners bool
+	allEvents  bool
+	metrics    dto.WSMetricsOptions
+	// epoch counts the changes of the metrics options, which start all the series over.
+	epoch int
+
+	// runners holds the last state sent of every runner, so updates only carry the changes.
+	runners map[string]*sentRunner
+	// cursors holds where the metrics of every controller or runner resume.
+	cursors map[string]*metricsCursor
+}
+
+type sentRunner struct {
+	ctrlID string
+	data   []byte
+}
+
+type metricsCursor struct {
+	since time.Time
+	step  string
+}
+
+// metricsRequest is the metrics query of a target, built under the lock of the connection and run
+// outside of it.
+type metricsRequest struct {
+	target metricsTarget
+	// cursor is the one the query resumes from, nil for the first query of the target.
+	cursor *metricsCursor
+	epoch  int
+	query  *dto.MetricsQuery
+	err    error
+}
+
+// metricsTarget is a controller or a runner whose metrics are sent.
+type metricsTarget struct {
+	ctrlID   string
+	runnerID string
+}
+
+func (t metricsTarget) key() string {
+	if t.runnerID != "" {
+		return "runner:" + t.runnerID
+	}
+	return "ctrl:" + t.ctrlID
+}
+
+func newSubscriptionV2() *subscriptionV2 {
+	return &subscriptionV2{
+		ctrlIDs:    make(map[string]struct{}),
+		runnerIDs:  make(map[string]struct{}),
+		events:     make(map[string]struct{}),
+		allRunners: true,
+		allEvents:  true,
+		runners:    make(map[string]*sentRunner),
+		cursors:    make(map[string]*metricsCursor),
+	}
+}
+
+func (s *subscriptionV2) subscribe(req *dto.WSRequest) {
+	if len(req.CtrlIDs) > 0 || len(req.RunnerIDs) > 0 {
+		s.allRunners = false
+	}
+	if len(req.Events) > 0 {
+		s.allEvents = false
+	}
+	for _, id := range req.CtrlIDs {
+		s.ctrlIDs[id] = struct{}{}
+	}
+	for _, id := range req.RunnerIDs {
+		s.runnerIDs[id] = struct{}{}
+	}
+	for _, event := range req.Events {
+		s.events[event] = struct{}{}
+	}
+
+	// New metrics options start all the series over from the requested range.
+	if req.Metrics != nil {
+		s.metrics = *req.Metrics
+		s.cursors = make(map[string]*metricsCursor)
+		s.epoch++
+	}
+}
+
+func (s *subscriptionV2) unsubscribe(req *dto.WSRequest) {
+	for _, id := range req.CtrlIDs {
+		delete(s.ctrlIDs, id)
+		delete(s.cursors, metricsTarget{ctrlID: id}.key())
+	}
+	for _, id := range req.RunnerIDs {
+		delete(s.runnerIDs, id)
+		delete(s.cursors, metricsTarget{runnerID: id}.key())
+	}
+	for _, event := range req.Events {
+		delete(s.events, event)
+	}
+}
+
+func (s *subscriptionV2) wants(event string) bool {
+	if s.allEvents {
+		return true
+	}
+	_, ok := s.events[event]
+	return ok
+}
+
+func (s *subscriptionV2) matches(ctrlID, runnerID string) bool {
+	if s.allRunners {
+		return true
+	}
+	if _, ok := s.ctrlIDs[ctrlID]; ok {
+		return true
+	}
+	_, ok := s.runnerIDs[runnerID]
+	return ok
+}
+
+// followsCtrl reports whether the events of the controller are sent: all of them without a filter,
+// else the subscribed controllers and the controllers of the subscribed runners.
+func (s *subscriptionV2) followsCtrl(ctrlID string) bool {
+	if s.allRunners {
+		return true
+	}
+	if _, ok := s.ctrlIDs[ctrlID]; ok {
+		return true
+	}
+	for _, runner := range s.runners {
+		if runner.ctrlID == ctrlID {
+			return true
+		}
+	}
+	return false
+}
+
+// follows reports whether the metrics of the target are still sent.
+func (s *subscriptionV2) follows(target metricsTarget) bool {
+	if target.runnerID != "" {
+		_, ok := s.runnerIDs[target.runnerID]
+		return ok
+	}
+	if s.allRunners {
+		return true
+	}
+	_, ok := s.ctrlIDs[target.ctrlID]
+	return ok
+}
+
+// targets returns the controllers and runners whose metrics are sent: the subscribed ones, or all the
+// controllers of the user without a filter.
+func (s *subscriptionV2) targets(ctrls []*dto.RunnerControllerWSResponse) []metricsTarget {
+	var targets []metricsTarget
+	if s.allRunners {
+		for _, ctrl := range ctrls {
+			targets = append(targets, metricsTarget{ctrlID: ctrl.Id})
+		}
+		return targets
+	}
+
+	for _, id := range sortedKeys(s.ctrlIDs) {
+		targets = append(targets, metricsTarget{ctrlID: id})
+	}
+	for _, id := range sortedKeys(s.runnerIDs) {
+		targets = append(targets, metricsTarget{runnerID: id})
+	}
+	return targets
+}
+
+// metricsRequest returns the next query of the metrics of the target, or nil when no step was
+// completed since the previous one.
+func (s *subscriptionV2) metricsRequest(target metricsTarget) *metricsRequest {
+	cursor := s.cursors[target.key()]
+	var since time.Time
+	var step string
+	if cursor != nil {
+		since, step = cursor.since, cursor.step
+	}
+
+	query, err := nextMetricsQuery(s.metrics.From, s.metrics.Step, s.metrics.Fields, since, step)
+	if err == nil && query == nil {
+		return nil
+	}
+	return &metricsRequest{target: target, cursor: cursor, epoch: s.epoch, query: query, err: err}
+}
+
+// current reports whether the subscription is still where the request was built, so that its result
+// is not sent twice or for options replaced meanwhile.
+func (s *subscriptionV2) current(req *metricsRequest) bool {
+	return s.epoch == req.epoch && s.cursors[req.target.key()] == req.cursor && s.follows(req.target)
+}
+
+func (s *subscriptionV2) info() *dto.WSSubscription {
+	return &dto.WSSubscription{
+		CtrlIDs:    sortedKeys(s.ctrlIDs),
+		RunnerIDs:  sortedKeys(s.runnerIDs),
+		Events:     sortedKeys(s.events),
+		AllRunners: s.allRunners,
+		AllEvents:  s.allEvents,
+	}
+}
+
+// handleV2 answers a frame of a connection using the versioned protocol.
+func (h *handlers) handleV2(ctx context.Context, userID string, user *UserWS, message []byte) {
+	req := &dto.WSRequest{}
+	if err := json.Unmarshal(message, req); err != nil {
+		sendV2Error(user, "", dto.WSErrorBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		code := dto.WSErrorBadRequest
+		if req.V != dto.WSVersion {
+			code = dto.WSErrorUnsupportedVersion
+		}
+		sendV2Error(user, req.ID, code, err.Error())
+		return
+	}
+
+	switch req.Type {
+	case dto.WSTypeSubscribe:
+		user.mu.Lock()
+		user.V2.subscribe(req)
+		info := user.V2.info()
+		user.mu.Unlock()
+		sendV2(user, &dto.WSFrame{Type: dto.WSTypeAck, ID: req.ID, Data: info})
+
+		ctrls, err := h.uc.GetAllCtrlsByUserID(ctx, userID)
+		if err != nil {
+			logs.ErrorF("Failed to get the controllers of user %s: %v", userID, err)
+			sendV2Error(user, req.ID, dto.WSErrorInternal, "failed to get the controllers")
+			return
+		}
+		h.syncV2(ctx, userID, user, ctrls, true)
+	case dto.WSTypeUnsubscribe:
+		user.mu.Lock()
+		user.V2.unsubscribe(req)
+		info := user.V2.info()
+		user.mu.Unlock()
+		sendV2(user, &dto.WSFrame{Type: dto.WSTypeAck, ID: req.ID, Data: info})
+	case dto.WSTypePing:
+		sendV2(user, &dto.WSFrame{Type: dto.WSTypePong, ID: req.ID})
+	default:
+		sendV2Error(user, req.ID, dto.WSErrorUnknownType, "unknown frame type "+req.Type)
+	}
+}
+
+// syncV2 sends the subscribed runners, all of them in a snapshot frame or only the ones changed
+// since the previous call, then the metrics completed since. The metrics are queried without holding
+// the lock of the connection.
+func (h *handlers) syncV2(ctx context.Context, userID string, user *UserWS, ctrls []*dto.RunnerControllerWSResponse, snapshot bool) {
+	user.mu.Lock()
+	sub := user.V2
+	current := make(map[string]*sentRunner)
+	updated := make([]*dto.RunnerUpdatedWSResponse, 0)
+	for _, ctrl := range ctrls {
+		for _, runner := range ctrl.RunnersWSResponse {
+			if !sub.matches(ctrl.Id, runner.Id) {
+				continue
+			}
+
+			r := &dto.RunnerUpdatedWSResponse{CtrlID: ctrl.Id, RunnerWSResponse: runner}
+			data, err := json.Marshal(r)
+			if err != nil {
+				logs.ErrorF("Failed to marshal runner %s: %v", runner.Id, err)
+				continue
+			}
+			current[runner.Id] = &sentRunner{ctrlID: ctrl.Id, data: data}
+
+			if prev, ok := sub.runners[runner.Id]; snapshot || !ok || !bytes.Equal(prev.data, data) {
+				updated = append(updated, r)
+			}
+		}
+	}
+
+	if snapshot {
+		sendV2(user, &dto.WSFrame{Type: dto.WSTypeSnapshot, Data: &dto.WSSnapshot{Runners: updated}})
+	} else {
+		if sub.wants(dto.WSTypeRunnerUpdated) {
+			for _, r := range updated {
+				sendV2(user, &dto.WSFrame{Type: dto.WSTypeRunnerUpdated, Data: r})
+			}
+		}
+		if sub.wants(dto.WSTypeRunnerRemoved) {
+			for _, id := range sortedKeys(sub.runners) {
+				if _, ok := current[id]; !ok {
+					removed := &dto.RunnerRemovedWSResponse{Id: id, CtrlID: sub.runners[id].ctrlID}
+					sendV2(user, &dto.WSFrame{Type: dto.WSTypeRunnerRemoved, Data: removed})
+				}
+			}
+		}
+	}
+	sub.runners = current
+
+	var requests []*metricsRequest
+	if sub.wants(dto.WSTypeMetricsAppended) {
+		for _, target := range sub.targets(ctrls) {
+			if req := sub.metricsRequest(target); req != nil {
+				requests = append(requests, req)
+			}
+		}
+	}
+	user.mu.Unlock()
+
+	for _, req := range requests {
+		h.appendMetricsV2(ctx, userID, user, req)
+	}
+}
+
+// appendMetricsV2 runs the metrics request and sends the metrics of its target, from the requested
+// range the first time and then the steps completed since. A target that does not exist is dropped
+// from the subscription, which does not follow everything again when it was the last one.
+func (h *handlers) appendMetricsV2(ctx context.Context, userID string, user *UserWS, req *metricsRequest) {
+	target := req.target
+	err := req.err
+
+	var metrics *dto.MetricsResponse
+	if err == nil {
+		if target.runnerID != "" {
+			metrics, err = h.uc.GetRunnerMetrics(ctx, userID, target.runnerID, req.query)
+		} else {
+			metrics, err = h.uc.GetCtrlMetrics(ctx, userID, target.ctrlID, req.query)
+		}
+	}
+	cursor := &metricsCursor{}
+	if err == nil {
+		cursor.since, cursor.step, err = metricsWatermark(metrics)
+	}
+
+	user.mu.Lock()
+	sub := user.V2
+	if !sub.current(req) {
+		// The subscription changed during the query, or another sync already sent these steps
+		user.mu.Unlock()
+		return
+	}
+	if err != nil {
+		var appErr *response.AppError
+		notFound := errors.As(err, &appErr) && appErr.Code == http.StatusNotFound
+		if notFound {
+			delete(sub.ctrlIDs, target.ctrlID)
+			delete(sub.runnerIDs, target.runnerID)
+			delete(sub.cursors, target.key())
+		}
+		user.mu.Unlock()
+
+		switch {
+		case notFound:
+			sendV2Error(user, "", dto.WSErrorNotFound, err.Error())
+		case errors.As(err, &appErr) && appErr.Code == http.StatusBadRequest:
+			sendV2Error(user, "", dto.WSErrorBadRequest, err.Error())
+		default:
+			logs.ErrorF("Failed to get the metrics of %s for user %s: %v", target.key(), userID, err)
+			sendV2Error(user, "", dto.WSErrorInternal, "failed to get the metrics")
+		}
+		return
+	}
+	sub.cursors[target.key()] = cursor
+	user.mu.Unlock()
+
+	if req.cursor != nil && len(metrics.Timestamps) == 0 {
+		return
+	}
+
+	sendV2(user, &dto.WSFrame{
+		Type: dto.WSTypeMetricsAppended,
+		Data: &dto.MetricsAppendedWSResponse{
+			CtrlID:          target.ctrlID,
+			RunnerID:        target.runnerID,
+			MetricsResponse: metrics,
+		},
+	})
+}
+
+// forwardV2 sends a legacy {event, data} message as a frame of its event type, if subscribed.
+// The events and ctrl_updated frames are narrowed to the followed controllers.
+func (h *handlers) forwardV2(user *UserWS, message []byte) {
+	var legacy struct {
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message, &legacy); err != nil || legacy.Event == "" {
+		return
+	}
+
+	user.mu.Lock()
+	sub := user.V2
+	if !sub.wants(legacy.Event) {
+		user.mu.Unlock()
+		return
+	}
+
+	data := legacy.Data
+	if legacy.Event == dto.WSTypeEvents && !sub.allRunners {
+		var events []json.RawMessage
+		if err := json.Unmarshal(legacy.Data, &events); err != nil {
+			user.mu.Unlock()
+			return
+		}
+
+		filtered := make([]json.RawMessage, 0, len(events))
+		for _, event := range events {
+			var e struct {
+				CtrlID string `json:"ctrl_id"`
+			}
+			if json.Unmarshal(event, &e) == nil {
+				if sub.followsCtrl(e.CtrlID) {
+					filtered = append(filtered, event)
+				}
+			}
+		}
+		if len(filtered) == 0 {
+			user.mu.Unlock()
+			return
+		}
+		data, _ = json.Marshal(filtered)
+	}
+	if legacy.Event == dto.WSTypeCtrlUpdated {
+		var ctrl struct {
+			Id string `json:"id"`
+		}
+		_ = json.Unmarshal(legacy.Data, &ctrl)
+		if !sub.followsCtrl(ctrl.Id) {
+			user.mu.Unlock()
+			return
+		}
+	}
+	user.mu.Unlock()
+
+	sendV2(user, &dto.WSFrame{Type: legacy.Event, Data: data})
+}
+
+func sendV2(user *UserWS, frame *dto.WSFrame) {
+	frame.V = dto.WSVersion
+	data, err := json.Marshal(frame)
+	if err != nil {
+		logs.ErrorF("Failed to marshal a %s frame: %v", frame.Type, err)
+		return
+	}
+	_ = user.Client.Send(data)
+}
+
+func sendV2Error(user *UserWS, id, code, message string) {
+	sendV2(user, &dto.WSFrame{Type: dto.WSTypeError, ID: id, Error: &dto.WSError{Code: code, Message: message}})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
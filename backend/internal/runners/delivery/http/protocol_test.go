@@ -0,0 +1,457 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"runner-manager-backend/internal/infrastructure/pubsub"
+	"runner-manager-backend/internal/infrastructure/ws"
+	"runner-manager-backend/internal/middleware"
+	"runner-manager-backend/internal/runners"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/pkg/constant"
+	"runner-manager-backend/pkg/response"
+	"runner-manager-backend/pkg/utils"
+)
+
+const (
+	testUserID   = "65f0c2a1b3d4e5f600000001"
+	testCtrlID   = "65f0c2a1b3d4e5f600000002"
+	testRunner1  = "65f0c2a1b3d4e5f600000003"
+	testRunner2  = "65f0c2a1b3d4e5f600000004"
+	unknownID    = "65f0c2a1b3d4e5f6000000ff"
+	frameTimeout = 2 * time.Second
+)
+
+// fakeUsecase serves the controllers and metrics of a single user. The other methods are not used by
+// the WebSocket protocol and panic.
+type fakeUsecase struct {
+	runners.Usecase
+
+	mu    sync.Mutex
+	ctrls []*dto.RunnerControllerWSResponse
+}
+
+func (f *fakeUsecase) setCtrls(ctrls []*dto.RunnerControllerWSResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ctrls = ctrls
+}
+
+func (f *fakeUsecase) GetAllCtrlsByUserID(ctx context.Context, userID string) ([]*dto.RunnerControllerWSResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ctrls, nil
+}
+
+func (f *fakeUsecase) GetCtrlMetrics(ctx context.Context, userID, ctrlID string, query *dto.MetricsQuery) (*dto.MetricsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ctrl := range f.ctrls {
+		if ctrl.Id == ctrlID {
+			return metricsResponse(query, ctrl.RunnersWSResponse), nil
+		}
+	}
+	return nil, response.NotFound(response.ErrCtrlNotFound)
+}
+
+func (f *fakeUsecase) GetRunnerMetrics(ctx context.Context, userID, runnerID string, query *dto.MetricsQuery) (*dto.MetricsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ctrl := range f.ctrls {
+		for _, runner := range ctrl.RunnersWSResponse {
+			if runner.Id == runnerID {
+				return metricsResponse(query, []*dto.RunnerWSResponse{runner}), nil
+			}
+		}
+	}
+	return nil, response.NotFound(response.ErrRunnerNotFound)
+}
+
+// metricsResponse returns a point per minute of the range for the runners. The ranges under an hour
+// are the incremental updates, which get no points so that they send no frame.
+func metricsResponse(query *dto.MetricsQuery, runners []*dto.RunnerWSResponse) *dto.MetricsResponse {
+	from := query.From.Truncate(time.Minute)
+	to := query.To.Truncate(time.Minute)
+	rsp := &dto.MetricsResponse{
+		From:        from.UTC().Format(time.RFC3339),
+		To:          to.UTC().Format(time.RFC3339),
+		StepSeconds: 60,
+		Resolution:  "raw",
+		Timestamps:  make([]int64, 0),
+		Runners:     make([]*dto.RunnerMetricsSeries, 0, len(runners)),
+	}
+	if to.Sub(from) >= time.Hour {
+		for t := from; t.Before(to); t = t.Add(time.Minute) {
+			rsp.Timestamps = append(rsp.Timestamps, t.Unix())
+		}
+	}
+
+	for _, runner := range runners {
+		series := make([]*float64, len(rsp.Timestamps))
+		for i := range series {
+			value := float64(i)
+			series[i] = &value
+		}
+		rsp.Runners = append(rsp.Runners, &dto.RunnerMetricsSeries{
+			Id:     runner.Id,
+			Name:   runner.Name,
+			Series: map[string][]*float64{"cpu": series},
+		})
+	}
+	return rsp
+}
+
+func testCtrls(runners ...*dto.RunnerWSResponse) []*dto.RunnerControllerWSResponse {
+	return []*dto.RunnerControllerWSResponse{{
+		Id:                testCtrlID,
+		Name:              "ctrl",
+		Status:            constant.CtrlStatusOnline,
+		RunnersWSResponse: runners,
+	}}
+}
+
+func testRunner(id, name string, status constant.RunnerStatus) *dto.RunnerWSResponse {
+	return &dto.RunnerWSResponse{Id: id, Name: name, Pool: "default", Status: status}
+}
+
+// schemas compiles the frames of docs/websocket-protocol.schema.json.
+func schemas(t *testing.T) (client, server *jsonschema.Schema) {
+	t.Helper()
+
+	path, err := filepath.Abs(filepath.Join("..", "..", "..", "..", "docs", "websocket-protocol.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	client, err = compiler.Compile(path + "#/$defs/clientFrame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = compiler.Compile(path + "#/$defs/serverFrame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+// wsConn is a connection of the test user using the versioned protocol, which checks every frame
+// against the schema of the protocol.
+type wsConn struct {
+	t      *testing.T
+	conn   *websocket.Conn
+	client *jsonschema.Schema
+	server *jsonschema.Schema
+}
+
+type testFrame struct {
+	V     int             `json:"v"`
+	Type  string          `json:"type"`
+	ID    string          `json:"id"`
+	Data  json.RawMessage `json:"data"`
+	Error *dto.WSError    `json:"error"`
+}
+
+func newTestHandlers(t *testing.T, uc runners.Usecase) (*handlers, *wsConn) {
+	t.Helper()
+
+	hub := ws.NewHub(ws.DefaultConfig())
+	t.Cleanup(hub.Close)
+	h := NewHandlers(uc, hub, pubsub.NewMemory())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		c.Set(utils.AuthCtxKey, &middleware.PayloadToken{Data: &middleware.Data{UserID: testUserID}})
+	}, h.WsCtrl)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{dto.WSProtocolV2}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if conn.Subprotocol() != dto.WSProtocolV2 {
+		t.Fatalf("negotiated subprotocol %q, want %q", conn.Subprotocol(), dto.WSProtocolV2)
+	}
+
+	client, server := schemas(t)
+	return h, &wsConn{t: t, conn: conn, client: client, server: server}
+}
+
+// send sends a frame, which must be valid unless it is one of the invalid frames of the tests.
+func (c *wsConn) send(frame string, valid bool) {
+	c.t.Helper()
+
+	if valid {
+		var v interface{}
+		if err := json.Unmarshal([]byte(frame), &v); err != nil {
+			c.t.Fatal(err)
+		}
+		if err := c.client.Validate(v); err != nil {
+			c.t.Fatalf("client frame %s does not match the schema: %#v", frame, err)
+		}
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read reads the next frame, checks it against the schema and that it is of the type.
+func (c *wsConn) read(typ string) *testFrame {
+	c.t.Helper()
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(frameTimeout))
+	_, message, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("waiting for a %s frame: %s", typ, err)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(message, &v); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.server.Validate(v); err != nil {
+		c.t.Fatalf("server frame %s does not match the schema: %#v", message, err)
+	}
+
+	frame := &testFrame{}
+	if err := json.Unmarshal(message, frame); err != nil {
+		c.t.Fatal(err)
+	}
+	if frame.Type != typ {
+		c.t.Fatalf("got frame %s, want a %s frame", message, typ)
+	}
+	return frame
+}
+
+func (c *wsConn) readError(id, code string) {
+	c.t.Helper()
+
+	frame := c.read(dto.WSTypeError)
+	if frame.ID != id || frame.Error.Code != code {
+		c.t.Fatalf("got error %q %+v, want %q %s", frame.ID, frame.Error, id, code)
+	}
+}
+
+func decode[T any](t *testing.T, frame *testFrame) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(frame.Data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestV2SubscribeAndUpdates(t *testing.T) {
+	uc := &fakeUsecase{}
+	uc.setCtrls(testCtrls(
+		testRunner(testRunner1, "runner-1", constant.RunnerStatusReady),
+		testRunner(testRunner2, "runner-2", constant.RunnerStatusBusy),
+	))
+	h, conn := newTestHandlers(t, uc)
+
+	conn.send(`{"v":2,"id":"sub-1","type":"subscribe","ctrl_ids":["`+testCtrlID+`"],`+
+		`"events":["runner_updated","runner_removed","metrics_appended"],"metrics":{"step":"1m"}}`, true)
+
+	ack := conn.read(dto.WSTypeAck)
+	sub := decode[dto.WSSubscription](t, ack)
+	if ack.ID != "sub-1" || len(sub.CtrlIDs) != 1 || sub.CtrlIDs[0] != testCtrlID || len(sub.Events) != 3 {
+		t.Fatalf("unexpected ack %q %+v", ack.ID, sub)
+	}
+
+	snapshot := decode[struct {
+		Runners []dto.RunnerRemovedWSResponse `json:"runners"`
+	}](t, conn.read(dto.WSTypeSnapshot))
+	if len(snapshot.Runners) != 2 || snapshot.Runners[0].Id != testRunner1 || snapshot.Runners[1].Id != testRunner2 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	metrics := decode[dto.MetricsAppendedWSResponse](t, conn.read(dto.WSTypeMetricsAppended))
+	if metrics.CtrlID != testCtrlID || len(metrics.Timestamps) == 0 || len(metrics.Runners) != 2 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+
+	// runner-1 changes and runner-2 is gone: only they are sent, then the next ping is answered
+	uc.setCtrls(testCtrls(testRunner(testRunner1, "runner-1", constant.RunnerStatusBusy)))
+	if err := h.refreshUserWS(context.Background(), testUserID); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := decode[dto.RunnerWSResponse](t, conn.read(dto.WSTypeRunnerUpdated))
+	if updated.Id != testRunner1 || updated.Status != constant.RunnerStatusBusy {
+		t.Fatalf("unexpected runner_updated %+v", updated)
+	}
+	removed := decode[dto.RunnerRemovedWSResponse](t, conn.read(dto.WSTypeRunnerRemoved))
+	if removed.Id != testRunner2 || removed.CtrlID != testCtrlID {
+		t.Fatalf("unexpected runner_removed %+v", removed)
+	}
+
+	conn.send(`{"v":2,"id":"ping-1","type":"ping"}`, true)
+	if pong := conn.read(dto.WSTypePong); pong.ID != "ping-1" {
+		t.Fatalf("unexpected pong id %q", pong.ID)
+	}
+
+	// Nothing changed since, so a refresh sends nothing before the pong
+	if err := h.refreshUserWS(context.Background(), testUserID); err != nil {
+		t.Fatal(err)
+	}
+	conn.send(`{"v":2,"id":"ping-2","type":"ping"}`, true)
+	if pong := conn.read(dto.WSTypePong); pong.ID != "ping-2" {
+		t.Fatalf("unexpected pong id %q", pong.ID)
+	}
+
+	conn.send(`{"v":2,"id":"unsub-1","type":"unsubscribe","ctrl_ids":["`+testCtrlID+`"],"events":["metrics_appended"]}`, true)
+	ack = conn.read(dto.WSTypeAck)
+	sub = decode[dto.WSSubscription](t, ack)
+	if ack.ID != "unsub-1" || len(sub.CtrlIDs) != 0 || len(sub.Events) != 2 {
+		t.Fatalf("unexpected ack %q %+v", ack.ID, sub)
+	}
+}
+
+func TestV2Errors(t *testing.T) {
+	tests := map[string]struct {
+		frame string
+		id    string
+		code  string
+	}{
+		"bad version": {
+			frame: `{"v":1,"id":"v1","type":"subscribe"}`,
+			id:    "v1",
+			code:  dto.WSErrorUnsupportedVersion,
+		},
+		"missing version": {
+			frame: `{"id":"v0","type":"ping"}`,
+			id:    "v0",
+			code:  dto.WSErrorUnsupportedVersion,
+		},
+		"unknown type": {
+			frame: `{"v":2,"id":"t1","type":"publish"}`,
+			id:    "t1",
+			code:  dto.WSErrorUnknownType,
+		},
+		"invalid JSON": {
+			frame: `{"v":2,"type":`,
+			code:  dto.WSErrorBadRequest,
+		},
+		"invalid ID": {
+			frame: `{"v":2,"id":"b1","type":"subscribe","ctrl_ids":["nope"]}`,
+			id:    "b1",
+			code:  dto.WSErrorBadRequest,
+		},
+		"unknown event": {
+			frame: `{"v":2,"id":"b2","type":"subscribe","events":["everything"]}`,
+			id:    "b2",
+			code:  dto.WSErrorBadRequest,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			uc := &fakeUsecase{}
+			uc.setCtrls(testCtrls())
+			_, conn := newTestHandlers(t, uc)
+
+			conn.send(tt.frame, false)
+			conn.readError(tt.id, tt.code)
+
+			// The connection stays usable after an error
+			conn.send(`{"v":2,"id":"ping","type":"ping"}`, true)
+			conn.read(dto.WSTypePong)
+		})
+	}
+}
+
+func TestV2UnknownCtrl(t *testing.T) {
+	uc := &fakeUsecase{}
+	uc.setCtrls(testCtrls(testRunner(testRunner1, "runner-1", constant.RunnerStatusReady)))
+	h, conn := newTestHandlers(t, uc)
+
+	conn.send(`{"v":2,"id":"sub-1","type":"subscribe","ctrl_ids":["`+unknownID+`"]}`, true)
+
+	sub := decode[dto.WSSubscription](t, conn.read(dto.WSTypeAck))
+	if len(sub.CtrlIDs) != 1 || sub.CtrlIDs[0] != unknownID {
+		t.Fatalf("unexpected subscription %+v", sub)
+	}
+	snapshot := decode[dto.WSSnapshot](t, conn.read(dto.WSTypeSnapshot))
+	if len(snapshot.Runners) != 0 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+	conn.readError("", dto.WSErrorNotFound)
+
+	// The unknown controller was dropped from the subscription, which then follows nothing rather than
+	// everything, and it is not reported again
+	if err := h.refreshUserWS(context.Background(), testUserID); err != nil {
+		t.Fatal(err)
+	}
+	conn.send(`{"v":2,"id":"ping","type":"ping"}`, true)
+	conn.read(dto.WSTypePong)
+
+	conn.send(`{"v":2,"id":"unsub-1","type":"unsubscribe","events":["events"]}`, true)
+	if sub := decode[dto.WSSubscription](t, conn.read(dto.WSTypeAck)); len(sub.CtrlIDs) != 0 || sub.AllRunners || !sub.AllEvents {
+		t.Fatalf("unexpected subscription %+v", sub)
+	}
+}
+
+func TestV2UnsubscribeLastCtrl(t *testing.T) {
+	uc := &fakeUsecase{}
+	uc.setCtrls(testCtrls(testRunner(testRunner1, "runner-1", constant.RunnerStatusReady)))
+	h, conn := newTestHandlers(t, uc)
+
+	conn.send(`{"v":2,"id":"sub-1","type":"subscribe","ctrl_ids":["`+testCtrlID+`"],"events":["runner_updated","metrics_appended","ctrl_updated"]}`, true)
+	if sub := decode[dto.WSSubscription](t, conn.read(dto.WSTypeAck)); sub.AllRunners || sub.AllEvents {
+		t.Fatalf("unexpected subscription %+v", sub)
+	}
+	conn.read(dto.WSTypeSnapshot)
+	conn.read(dto.WSTypeMetricsAppended)
+
+	conn.send(`{"v":2,"id":"unsub-1","type":"unsubscribe","ctrl_ids":["`+testCtrlID+`"]}`, true)
+	sub := decode[dto.WSSubscription](t, conn.read(dto.WSTypeAck))
+	if len(sub.CtrlIDs) != 0 || len(sub.Events) != 3 || sub.AllRunners || sub.AllEvents {
+		t.Fatalf("unexpected subscription %+v", sub)
+	}
+
+	// A new runner and the events of the controller are not sent to a connection following nothing
+	uc.setCtrls(testCtrls(
+		testRunner(testRunner1, "runner-1", constant.RunnerStatusBusy),
+		testRunner(testRunner2, "runner-2", constant.RunnerStatusReady),
+	))
+	if err := h.refreshUserWS(context.Background(), testUserID); err != nil {
+		t.Fatal(err)
+	}
+	for _, session := range h.userSessions(testUserID) {
+		h.forwardV2(session, []byte(`{"event":"ctrl_updated","data":{"id":"`+testCtrlID+`","status":"offline"}}`))
+	}
+	conn.send(`{"v":2,"id":"ping","type":"ping"}`, true)
+	conn.read(dto.WSTypePong)
+
+	// Unsubscribing from the last event types does not receive them all again either
+	conn.send(`{"v":2,"id":"unsub-2","type":"unsubscribe","events":["runner_updated","metrics_appended","ctrl_updated"]}`, true)
+	if sub := decode[dto.WSSubscription](t, conn.read(dto.WSTypeAck)); len(sub.Events) != 0 || sub.AllEvents {
+		t.Fatalf("unexpected subscription %+v", sub)
+	}
+
+	// Subscribing again to the controller follows it again
+	conn.send(`{"v":2,"id":"sub-2","type":"subscribe","ctrl_ids":["`+testCtrlID+`"],"events":["runner_updated"]}`, true)
+	conn.read(dto.WSTypeAck)
+	snapshot := decode[dto.WSSnapshot](t, conn.read(dto.WSTypeSnapshot))
+	if len(snapshot.Runners) != 2 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+}
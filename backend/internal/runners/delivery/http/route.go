@@ -9,4 +9,24 @@ import (
 func (h *handlers) RunnerRoutes(router *gin.RouterGroup, cfg config.Config) {
 	router.POST("/", middleware.JWTMiddleware(cfg), h.UpdateRunners)
 	router.GET("/ws", middleware.JWTMiddleware(cfg), h.WsCtrl)
+	router.GET("/events", middleware.StreamJWTMiddleware(cfg), h.StreamEvents)
+	router.POST("/events/token", middleware.JWTMiddleware(cfg), h.GetStreamToken)
+	router.GET("/analytics", middleware.JWTMiddleware(cfg), h.GetAnalytics)
+	router.GET("/costs", middleware.JWTMiddleware(cfg), h.GetCosts)
+	router.GET("/forecast", middleware.JWTMiddleware(cfg), h.GetForecast)
+	router.GET("/:id/logs", middleware.JWTMiddleware(cfg), h.GetRunnerLogs)
+	router.GET("/:id/metrics", middleware.JWTMiddleware(cfg), h.GetRunnerMetrics)
+	router.GET("/ctrls/:id/metrics", middleware.JWTMiddleware(cfg), h.GetCtrlMetrics)
+}
+
+// PrometheusRoutes serves the Prometheus HTTP API, so the backend can be added to Grafana as a
+// Prometheus datasource with the /api URL, and receives remote-write requests on /api/v1/write.
+// Grafana and Prometheus agents authenticate with an API key over basic auth, controllers with their token.
+func (h *handlers) PrometheusRoutes(router *gin.RouterGroup, cfg config.Config, lookup middleware.ApiKeyLookup) {
+	auth := middleware.ApiKeyMiddleware(cfg, lookup)
+	router.GET("/query_range", auth, h.QueryRange)
+	router.POST("/query_range", auth, h.QueryRange)
+	router.GET("/series", auth, h.GetSeries)
+	router.POST("/series", auth, h.GetSeries)
+	router.POST("/write", auth, h.RemoteWrite)
 }
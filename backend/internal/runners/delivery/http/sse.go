@@ -0,0 +1,200 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"runner-manager-backend/internal/infrastructure/logs"
+	"runner-manager-backend/internal/middleware"
+	"runner-manager-backend/pkg/response"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseRetry is the reconnection delay advised to the clients of the event stream, in milliseconds.
+const sseRetry = 5000
+
+// StreamEvents streams the ctrls and metrics events of the WebSocket as Server-Sent Events, for
+// networks where WebSockets do not get through. The subscription is taken from the query string.
+// A reconnecting client sends the Last-Event-ID header, from which the metrics resume.
+// The stream token is only checked when the stream is opened, and the stream sends a token event with
+// a fresh one before the previous one expires, for the client to reconnect with.
+func (h *handlers) StreamEvents(c *gin.Context) {
+	tokenPayload, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	data := &RequestWSData{}
+	if err := c.ShouldBindQuery(data); err != nil {
+		response.ErrorBuilder(response.BadRequest(err)).Send(c)
+		return
+	}
+
+	userID := tokenPayload.Data.UserID
+	user := &UserWS{
+		Data:   data,
+		Client: h.hub.RegisterStream(userID),
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	if since, step, ok := parseMetricsEventID(lastEventID); ok {
+		user.MetricsSince = since
+		user.MetricsStep = step
+	}
+
+	h.mu.Lock()
+	h.sessions[user.Client] = user
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.sessions, user.Client)
+		h.mu.Unlock()
+		h.hub.Unregister(user.Client)
+	}()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetry); err != nil {
+		return
+	}
+	c.Writer.Flush()
+
+	ctrls, err := h.controllersWS(c, userID)
+	if err != nil {
+		logs.ErrorF("Failed to get the controllers of user %s: %v", userID, err)
+		return
+	}
+	_ = user.Client.Send(ctrls)
+	if err := h.updateMetricsWS(c, userID, user); err != nil {
+		logs.InfoF("Error updating metrics: %v", err)
+	}
+
+	refresh, err := h.sendStreamToken(c, tokenPayload.Data)
+	if err != nil {
+		logs.ErrorF("Failed to issue a stream token for user %s: %v", userID, err)
+		return
+	}
+	refreshTimer := time.NewTimer(refresh)
+	defer refreshTimer.Stop()
+
+	ticker := time.NewTicker(user.Client.KeepAlive())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-user.Client.Done():
+			return
+		case message := <-user.Client.Messages():
+			if err := writeSSE(c.Writer, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-refreshTimer.C:
+			refresh, err := h.sendStreamToken(c, tokenPayload.Data)
+			if err != nil {
+				logs.ErrorF("Failed to issue a stream token for user %s: %v", userID, err)
+				return
+			}
+			refreshTimer.Reset(refresh)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// sendStreamToken writes a token event with a fresh stream token, and returns when to send the next one:
+// halfway through its lifetime, so the client always holds a valid token to reconnect with.
+func (h *handlers) sendStreamToken(c *gin.Context, data *middleware.Data) (time.Duration, error) {
+	rsp, err := h.uc.NewStreamToken(c, data)
+	if err != nil {
+		return 0, err
+	}
+
+	message, err := json.Marshal(map[string]interface{}{
+		"event": "token",
+		"data":  rsp,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err = writeSSE(c.Writer, message); err != nil {
+		return 0, err
+	}
+	return time.Duration(rsp.ExpiredAt) * time.Second / 2, nil
+}
+
+// GetStreamToken issues a short-lived token to open the event stream with, as the EventSource of
+// browsers cannot send the Authorization header.
+func (h *handlers) GetStreamToken(c *gin.Context) {
+	userData, err := middleware.NewTokenInformation(c)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	rsp, err := h.uc.NewStreamToken(c, userData.Data)
+	if err != nil {
+		response.ErrorBuilder(err).Send(c)
+		return
+	}
+
+	response.SuccessBuilder(rsp).Send(c)
+}
+
+// writeSSE writes a message of the WebSocket as an event named after its event field.
+func writeSSE(w gin.ResponseWriter, message []byte) error {
+	var header struct {
+		Event string `json:"event"`
+		ID    string `json:"id"`
+	}
+	if err := json.Unmarshal(message, &header); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if header.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", header.ID)
+	}
+	if header.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", header.Event)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", message)
+
+	_, err := w.WriteString(b.String())
+	return err
+}
+
+// metricsEventID encodes where the metrics resume: the end of the last range sent and its step.
+func metricsEventID(since time.Time, step string) string {
+	return fmt.Sprintf("%d_%s", since.Unix(), step)
+}
+
+func parseMetricsEventID(id string) (time.Time, string, bool) {
+	seconds, step, ok := strings.Cut(id, "_")
+	if !ok {
+		return time.Time{}, "", false
+	}
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	if _, err := time.ParseDuration(step); err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(unix, 0), step, true
+}
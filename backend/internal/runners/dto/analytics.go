@@ -0,0 +1,91 @@
+package dto
+
+import (
+	"errors"
+	"github.com/invopop/validation"
+	"time"
+)
+
+const (
+	AnalyticsGroupByRepository = "repository"
+	AnalyticsGroupByWorkflow   = "workflow"
+	AnalyticsGroupByLabel      = "label"
+	AnalyticsGroupByPool       = "pool"
+
+	DefaultAnalyticsRange = 7 * 24 * time.Hour
+	MaxAnalyticsRange     = 90 * 24 * time.Hour
+)
+
+type AnalyticsQuery struct {
+	From    time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To      time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	GroupBy string    `form:"group_by"`
+}
+
+type AnalyticsResponse struct {
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	GroupBy string            `json:"group_by"`
+	Groups  []*AnalyticsGroup `json:"groups"`
+}
+
+// AnalyticsGroup aggregates the runners and jobs sharing a repository, workflow, label or pool.
+type AnalyticsGroup struct {
+	Key                string         `json:"key"`
+	Runners            int            `json:"runners"`
+	FailedRunners      int            `json:"failed_runners"`
+	RunnerFailureRate  float64        `json:"runner_failure_rate"`
+	Jobs               int            `json:"jobs"`
+	FailedJobs         int            `json:"failed_jobs"`
+	JobFailureRate     float64        `json:"job_failure_rate"`
+	QueueLatency       *DurationStats `json:"queue_latency"`
+	JobDuration        *DurationStats `json:"job_duration"`
+	BusySeconds        float64        `json:"busy_seconds"`
+	ProvisionedSeconds float64        `json:"provisioned_seconds"`
+	Utilization        float64        `json:"utilization"`
+}
+
+// DurationStats summarizes durations in seconds.
+type DurationStats struct {
+	Count int     `json:"count"`
+	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// Normalize fills the default range and grouping, ending now.
+func (q *AnalyticsQuery) Normalize() {
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-DefaultAnalyticsRange)
+	}
+	if q.GroupBy == "" {
+		q.GroupBy = AnalyticsGroupByRepository
+	}
+}
+
+func (q *AnalyticsQuery) Validate() error {
+	err := validation.ValidateStruct(q,
+		validation.Field(&q.GroupBy, validation.In(
+			AnalyticsGroupByRepository,
+			AnalyticsGroupByWorkflow,
+			AnalyticsGroupByLabel,
+			AnalyticsGroupByPool),
+		),
+	)
+	if err != nil {
+		return err
+	}
+	if !q.From.Before(q.To) {
+		return errors.New("from must be before to")
+	}
+	if q.To.Sub(q.From) > MaxAnalyticsRange {
+		return errors.New("time range must not exceed 90 days")
+	}
+	return nil
+}
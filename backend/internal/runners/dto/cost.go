@@ -0,0 +1,86 @@
+package dto
+
+import (
+	"errors"
+	"github.com/invopop/validation"
+	"time"
+)
+
+const (
+	CostGroupByController = "controller"
+	CostGroupByRepository = "repository"
+	CostGroupByWorkflow   = "workflow"
+	CostGroupByJob        = "job"
+	CostGroupByRunner     = "runner"
+	CostGroupByDay        = "day"
+
+	CostFormatJSON = "json"
+	CostFormatCSV  = "csv"
+)
+
+type CostQuery struct {
+	From    time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To      time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	GroupBy string    `form:"group_by"`
+	Format  string    `form:"format"`
+}
+
+type CostResponse struct {
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	GroupBy  string       `json:"group_by"`
+	Currency string       `json:"currency"`
+	Total    float64      `json:"total"`
+	Groups   []*CostGroup `json:"groups"`
+}
+
+// CostGroup is the estimated cost of the runners sharing a controller, repository, workflow, job, runner or day.
+type CostGroup struct {
+	Key         string  `json:"key"`
+	Runners     int     `json:"runners"`
+	RunnerHours float64 `json:"runner_hours"`
+	SpotHours   float64 `json:"spot_hours"`
+	VCPUHours   float64 `json:"vcpu_hours"`
+	GBHours     float64 `json:"gb_hours"`
+	Cost        float64 `json:"cost"`
+}
+
+// Normalize fills the default range, grouping and format, ending now.
+func (q *CostQuery) Normalize() {
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-DefaultAnalyticsRange)
+	}
+	if q.GroupBy == "" {
+		q.GroupBy = CostGroupByRepository
+	}
+	if q.Format == "" {
+		q.Format = CostFormatJSON
+	}
+}
+
+func (q *CostQuery) Validate() error {
+	err := validation.ValidateStruct(q,
+		validation.Field(&q.GroupBy, validation.In(
+			CostGroupByController,
+			CostGroupByRepository,
+			CostGroupByWorkflow,
+			CostGroupByJob,
+			CostGroupByRunner,
+			CostGroupByDay),
+		),
+		validation.Field(&q.Format, validation.In(CostFormatJSON, CostFormatCSV)),
+	)
+	if err != nil {
+		return err
+	}
+	if !q.From.Before(q.To) {
+		return errors.New("from must be before to")
+	}
+	if q.To.Sub(q.From) > MaxAnalyticsRange {
+		return errors.New("time range must not exceed 90 days")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package dto
+
+import "github.com/invopop/validation"
+
+const (
+	DefaultForecastWeeks = 4
+	MaxForecastWeeks     = 12
+	// ForecastPercentile is the percentage of the past days whose demand in an hour the recommendation covers
+	ForecastPercentile = 90
+)
+
+// ForecastQuery selects the weeks of jobs the forecast is derived from. MaxSizes caps the recommendation
+// of the pools, passed by the controllers as max_size[pool]=size.
+type ForecastQuery struct {
+	Weeks    int            `form:"weeks"`
+	MaxSizes map[string]int `form:"-"`
+}
+
+// ForecastResponse is the hourly demand of the pools, offered to the controllers as warm pool sizes.
+type ForecastResponse struct {
+	Weeks int             `json:"weeks"`
+	Pools []*PoolForecast `json:"pools"`
+}
+
+type PoolForecast struct {
+	Pool  string          `json:"pool"`
+	Hours []*HourForecast `json:"hours"`
+}
+
+// HourForecast is the demand of a pool in an hour of the day, in UTC. ExpectedJobs is the average
+// number of jobs started in the hour. As each job consumes a runner, Recommended is the number of jobs
+// started in the hour on ForecastPercentile of the days, capped at the max size of the pool.
+type HourForecast struct {
+	Hour         int     `json:"hour"`
+	ExpectedJobs float64 `json:"expected_jobs"`
+	Recommended  int     `json:"recommended"`
+}
+
+func (q *ForecastQuery) Validate() error {
+	return validation.ValidateStruct(q,
+		validation.Field(&q.Weeks, validation.Min(0), validation.Max(MaxForecastWeeks)),
+		validation.Field(&q.MaxSizes, validation.Each(validation.Min(0))),
+	)
+}
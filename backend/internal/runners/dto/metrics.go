@@ -0,0 +1,97 @@
+package dto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMetricsRange = time.Hour
+	MaxMetricsRange     = 365 * 24 * time.Hour
+
+	// DefaultMetricsPoints is the number of points per series when no step is requested.
+	DefaultMetricsPoints = 300
+	// MaxMetricsPoints bounds the number of points per series, as Prometheus does.
+	MaxMetricsPoints = 11000
+	// MinMetricsStep is the smallest step of the raw points, about the scrape interval of the controllers.
+	MinMetricsStep = 5 * time.Second
+)
+
+// MetricsQuery selects the range, step and metrics to return. Step is a duration such as 30s or 5m,
+// picked from the range when empty, and Fields is a comma-separated list of metric names.
+type MetricsQuery struct {
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Step   string    `form:"step"`
+	Fields string    `form:"fields"`
+}
+
+// MetricsResponse holds series aligned on Timestamps, in Unix seconds. Each series has a value per
+// timestamp, null when the runner reported nothing in the step.
+type MetricsResponse struct {
+	From        string                 `json:"from"`
+	To          string                 `json:"to"`
+	StepSeconds float64                `json:"step_seconds"`
+	Resolution  string                 `json:"resolution"`
+	Timestamps  []int64                `json:"timestamps"`
+	Runners     []*RunnerMetricsSeries `json:"runners"`
+}
+
+type RunnerMetricsSeries struct {
+	Id     string                `json:"id"`
+	Name   string                `json:"name"`
+	Series map[string][]*float64 `json:"series"`
+}
+
+// Normalize fills the default range, ending now.
+func (q *MetricsQuery) Normalize() {
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-DefaultMetricsRange)
+	}
+}
+
+func (q *MetricsQuery) Validate() error {
+	if !q.From.Before(q.To) {
+		return errors.New("from must be before to")
+	}
+	if q.To.Sub(q.From) > MaxMetricsRange {
+		return errors.New("time range must not exceed 365 days")
+	}
+	if q.Step == "" {
+		return nil
+	}
+
+	step, err := time.ParseDuration(q.Step)
+	if err != nil {
+		return fmt.Errorf("invalid step: %w", err)
+	}
+	if step < time.Second || step%time.Second != 0 {
+		return errors.New("step must be a whole number of seconds")
+	}
+	if q.To.Sub(q.From)/step > MaxMetricsPoints {
+		return fmt.Errorf("step is too small, the range must not exceed %d points", MaxMetricsPoints)
+	}
+	return nil
+}
+
+// Interval returns the requested step, or 0 when it is left to the server.
+func (q *MetricsQuery) Interval() time.Duration {
+	step, _ := time.ParseDuration(q.Step)
+	return step
+}
+
+// FieldList returns the requested metric names, or nil for all of them.
+func (q *MetricsQuery) FieldList() []string {
+	var fields []string
+	for _, field := range strings.Split(q.Fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,133 @@
+package dto
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	PromStatusSuccess = "success"
+	PromStatusError   = "error"
+
+	PromErrorBadData  = "bad_data"
+	PromErrorInternal = "internal"
+
+	PromResultMatrix = "matrix"
+
+	// DefaultSeriesRange is the range searched for series when start and end are not set.
+	DefaultSeriesRange = 24 * time.Hour
+)
+
+// PromQueryRangeQuery is a range query of the Prometheus HTTP API. Times are Unix seconds or RFC3339
+// and the step is a duration or a number of seconds, as Prometheus accepts them.
+type PromQueryRangeQuery struct {
+	Query string `form:"query"`
+	Start string `form:"start"`
+	End   string `form:"end"`
+	Step  string `form:"step"`
+
+	StartTime time.Time     `form:"-"`
+	EndTime   time.Time     `form:"-"`
+	Interval  time.Duration `form:"-"`
+}
+
+// PromSeriesQuery lists the series matching any of the Match selectors.
+type PromSeriesQuery struct {
+	Match []string `form:"match[]"`
+	Start string   `form:"start"`
+	End   string   `form:"end"`
+
+	StartTime time.Time `form:"-"`
+	EndTime   time.Time `form:"-"`
+}
+
+// PromResponse is the envelope of the Prometheus HTTP API, used instead of the usual one so
+// the backend can be added to Grafana as a Prometheus datasource.
+type PromResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type PromMatrix struct {
+	ResultType string        `json:"resultType"`
+	Result     []*PromSeries `json:"result"`
+}
+
+// PromSeries holds the values of a series as [timestamp, "value"] pairs.
+type PromSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]interface{}  `json:"values"`
+}
+
+func (q *PromQueryRangeQuery) Parse() error {
+	if q.Query == "" {
+		return errors.New("query is required")
+	}
+
+	var err error
+	if q.StartTime, err = parsePromTime(q.Start); err != nil {
+		return fmt.Errorf("invalid start: %w", err)
+	}
+	if q.EndTime, err = parsePromTime(q.End); err != nil {
+		return fmt.Errorf("invalid end: %w", err)
+	}
+	if q.Interval, err = parsePromDuration(q.Step); err != nil {
+		return fmt.Errorf("invalid step: %w", err)
+	}
+
+	if q.EndTime.Before(q.StartTime) {
+		return errors.New("end timestamp must not be before start time")
+	}
+	if q.Interval <= 0 {
+		return errors.New("zero or negative query resolution step widths are not accepted")
+	}
+	if q.EndTime.Sub(q.StartTime)/q.Interval > MaxMetricsPoints {
+		return fmt.Errorf("exceeded maximum resolution of %d points per timeseries", MaxMetricsPoints)
+	}
+	return nil
+}
+
+func (q *PromSeriesQuery) Parse() error {
+	if len(q.Match) == 0 {
+		return errors.New("no match[] parameter provided")
+	}
+
+	var err error
+	q.EndTime = time.Now()
+	if q.End != "" {
+		if q.EndTime, err = parsePromTime(q.End); err != nil {
+			return fmt.Errorf("invalid end: %w", err)
+		}
+	}
+	q.StartTime = q.EndTime.Add(-DefaultSeriesRange)
+	if q.Start != "" {
+		if q.StartTime, err = parsePromTime(q.Start); err != nil {
+			return fmt.Errorf("invalid start: %w", err)
+		}
+	}
+
+	if q.EndTime.Before(q.StartTime) {
+		return errors.New("end timestamp must not be before start time")
+	}
+	return nil
+}
+
+func parsePromTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func parsePromDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
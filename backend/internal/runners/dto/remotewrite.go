@@ -0,0 +1,8 @@
+package dto
+
+// RemoteWriteResponse counts the samples stored from a remote-write request and the ones dropped.
+type RemoteWriteResponse struct {
+	Samples        int `json:"samples"`
+	DroppedSamples int `json:"dropped_samples"`
+	DroppedSeries  int `json:"dropped_series"`
+}
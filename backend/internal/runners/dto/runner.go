@@ -4,6 +4,7 @@ import (
 	"github.com/invopop/validation"
 	"github.com/invopop/validation/is"
 	"runner-manager-backend/pkg/constant"
+	"time"
 )
 
 type CreateRunnerRequest struct {
@@ -18,37 +19,82 @@ type UpdateRunnersRequest struct {
 
 type UpdateRunnerRequest struct {
 	Name        string                   `json:"name"`
+	Pool        string                   `json:"pool"`
+	Labels      []string                 `json:"labels"`
+	ARN         string                   `json:"arn"`
 	PrivateIPv4 string                   `json:"private_ipv4"`
 	Status      constant.RunnerStatus    `json:"status"`
+	StopReason  string                   `json:"stop_reason"`
+	CPU         string                   `json:"cpu"`
+	Memory      string                   `json:"memory"`
+	Job         *JobRequest              `json:"job"`
 	Metrics     []map[string]interface{} `json:"metrics"`
+
+	CapacityProvider string `json:"capacity_provider"`
 }
 
 type RunnerControllerWSResponse struct {
 	Id                string              `json:"id"`
 	Name              string              `json:"name"`
+	Version           string              `json:"version,omitempty"`
+	Status            constant.CtrlStatus `json:"status"`
+	LastSeenAt        *time.Time          `json:"last_seen_at,omitempty"`
 	RunnersWSResponse []*RunnerWSResponse `json:"runners"`
 }
 
 type RunnerWSResponse struct {
 	Id          string                   `json:"id"`
 	Name        string                   `json:"name"`
+	Pool        string                   `json:"pool"`
+	Labels      []string                 `json:"labels,omitempty"`
+	ARN         string                   `json:"arn"`
 	PrivateIPv4 string                   `json:"private_ipv4"`
 	Status      constant.RunnerStatus    `json:"status"`
+	StopReason  string                   `json:"stop_reason,omitempty"`
+	Job         *JobResponse             `json:"job,omitempty"`
 	Metrics     []map[string]interface{} `json:"metrics"`
 }
 
-type MetricsCtrlWSResponse struct {
-	RunnerMetrics []*MetricsRunnerWSResponse `json:"runners"`
+type JobRequest struct {
+	ID           int64      `json:"id"`
+	RunID        int64      `json:"run_id"`
+	Name         string     `json:"name"`
+	WorkflowName string     `json:"workflow_name"`
+	Repository   string     `json:"repository"`
+	HeadBranch   string     `json:"head_branch"`
+	HeadSHA      string     `json:"head_sha"`
+	Conclusion   string     `json:"conclusion"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+}
+
+type JobResponse struct {
+	ID               int64   `json:"id"`
+	RunID            int64   `json:"run_id"`
+	Name             string  `json:"name"`
+	WorkflowName     string  `json:"workflow_name"`
+	Repository       string  `json:"repository"`
+	HeadBranch       string  `json:"head_branch"`
+	HeadSHA          string  `json:"head_sha"`
+	Conclusion       string  `json:"conclusion,omitempty"`
+	CreatedAt        string  `json:"created_at"`
+	StartedAt        string  `json:"started_at,omitempty"`
+	CompletedAt      string  `json:"completed_at,omitempty"`
+	QueueWaitSeconds float64 `json:"queue_wait_seconds,omitempty"`
+	DurationSeconds  float64 `json:"duration_seconds,omitempty"`
 }
 
-type MetricsRunnerWSResponse struct {
-	Name          string               `json:"name"`
-	RunnerMetrics []*MetricsWSResponse `json:"metrics"`
+type RunnerLogsResponse struct {
+	Id    string           `json:"id"`
+	Name  string           `json:"name"`
+	ARN   string           `json:"arn"`
+	Lines []*RunnerLogLine `json:"lines"`
 }
 
-type MetricsWSResponse struct {
-	Timestamp string                 `json:"timestamp"`
-	Metadata  map[string]interface{} `json:"metadata"`
+type RunnerLogLine struct {
+	Timestamp string `json:"timestamp"`
+	Message   string `json:"message"`
 }
 
 func (cup *UpdateRunnersRequest) Validate() error {
@@ -0,0 +1,7 @@
+package dto
+
+// StreamTokenResponse is a short-lived token for the event stream, which browsers open without headers.
+type StreamTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiredAt   int64  `json:"expired_at"`
+}
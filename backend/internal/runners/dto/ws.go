@@ -0,0 +1,147 @@
+package dto
+
+import (
+	"errors"
+	"fmt"
+	"github.com/invopop/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// WSProtocolV2 is the WebSocket subprotocol of the versioned protocol, documented in
+// docs/websocket-protocol.md. Connections without it use the legacy {ctrl_id, event} messages.
+const (
+	WSProtocolV2 = "runners.v2"
+	WSVersion    = 2
+)
+
+// Types of the frames of the versioned protocol.
+const (
+	WSTypeSubscribe   = "subscribe"
+	WSTypeUnsubscribe = "unsubscribe"
+	WSTypePing        = "ping"
+
+	WSTypeAck             = "ack"
+	WSTypeError           = "error"
+	WSTypePong            = "pong"
+	WSTypeSnapshot        = "snapshot"
+	WSTypeRunnerUpdated   = "runner_updated"
+	WSTypeRunnerRemoved   = "runner_removed"
+	WSTypeMetricsAppended = "metrics_appended"
+	WSTypeEvents          = "events"
+	WSTypeCtrlUpdated     = "ctrl_updated"
+)
+
+// Codes of the error frames.
+const (
+	WSErrorBadRequest         = "bad_request"
+	WSErrorUnsupportedVersion = "unsupported_version"
+	WSErrorUnknownType        = "unknown_type"
+	WSErrorNotFound           = "not_found"
+	WSErrorInternal           = "internal"
+)
+
+// WSEventTypes are the event types a connection can subscribe to.
+var WSEventTypes = []interface{}{
+	WSTypeRunnerUpdated,
+	WSTypeRunnerRemoved,
+	WSTypeMetricsAppended,
+	WSTypeEvents,
+	WSTypeCtrlUpdated,
+}
+
+// WSRequest is a frame sent by the client. ID is echoed in the ack or error frame answering it.
+// Subscriptions add to the ones of the connection and unsubscriptions remove from them.
+type WSRequest struct {
+	V         int               `json:"v"`
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	CtrlIDs   []string          `json:"ctrl_ids,omitempty"`
+	RunnerIDs []string          `json:"runner_ids,omitempty"`
+	Events    []string          `json:"events,omitempty"`
+	Metrics   *WSMetricsOptions `json:"metrics,omitempty"`
+}
+
+// WSMetricsOptions are the range, step and metric names of the first metrics_appended frames, as
+// in the metrics query API. The following frames only carry the steps completed since.
+type WSMetricsOptions struct {
+	From   time.Time `json:"from"`
+	Step   string    `json:"step"`
+	Fields string    `json:"fields"`
+}
+
+// WSFrame is a frame sent by the server.
+type WSFrame struct {
+	V     int         `json:"v"`
+	Type  string      `json:"type"`
+	ID    string      `json:"id,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+	Error *WSError    `json:"error,omitempty"`
+}
+
+type WSError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// WSSubscription is the subscription of a connection, sent in the ack frames. AllRunners and AllEvents
+// stay set until the connection subscribes to some controllers or runners and some event types.
+type WSSubscription struct {
+	CtrlIDs    []string `json:"ctrl_ids"`
+	RunnerIDs  []string `json:"runner_ids"`
+	Events     []string `json:"events"`
+	AllRunners bool     `json:"all_runners"`
+	AllEvents  bool     `json:"all_events"`
+}
+
+type WSSnapshot struct {
+	Runners []*RunnerUpdatedWSResponse `json:"runners"`
+}
+
+type RunnerUpdatedWSResponse struct {
+	CtrlID string `json:"ctrl_id"`
+	*RunnerWSResponse
+}
+
+type RunnerRemovedWSResponse struct {
+	Id     string `json:"id"`
+	CtrlID string `json:"ctrl_id"`
+}
+
+// MetricsAppendedWSResponse holds the new steps of the metrics of a controller or of a runner.
+type MetricsAppendedWSResponse struct {
+	CtrlID   string `json:"ctrl_id,omitempty"`
+	RunnerID string `json:"runner_id,omitempty"`
+	*MetricsResponse
+}
+
+func (r *WSRequest) Validate() error {
+	if r.V != WSVersion {
+		return fmt.Errorf("unsupported protocol version %d, expected %d", r.V, WSVersion)
+	}
+
+	err := validation.ValidateStruct(r,
+		validation.Field(&r.ID, validation.Length(0, 64)),
+		validation.Field(&r.CtrlIDs, validation.Each(validation.By(isObjectID))),
+		validation.Field(&r.RunnerIDs, validation.Each(validation.By(isObjectID))),
+		validation.Field(&r.Events, validation.Each(validation.In(WSEventTypes...))),
+	)
+	if err != nil {
+		return err
+	}
+
+	if r.Metrics != nil && r.Metrics.Step != "" {
+		query := &MetricsQuery{From: r.Metrics.From, Step: r.Metrics.Step}
+		query.Normalize()
+		return query.Validate()
+	}
+	return nil
+}
+
+func isObjectID(value interface{}) error {
+	id, _ := value.(string)
+	if !primitive.IsValidObjectID(id) {
+		return errors.New("must be a valid id")
+	}
+	return nil
+}
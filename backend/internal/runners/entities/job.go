@@ -0,0 +1,56 @@
+package entities
+
+import (
+	"runner-manager-backend/internal/runners/dto"
+	"time"
+)
+
+// Job is the workflow job a runner served.
+type Job struct {
+	ID           int64      `bson:"id"`
+	RunID        int64      `bson:"run_id"`
+	Name         string     `bson:"name"`
+	WorkflowName string     `bson:"workflow_name"`
+	Repository   string     `bson:"repository"`
+	HeadBranch   string     `bson:"head_branch"`
+	HeadSHA      string     `bson:"head_sha"`
+	Conclusion   string     `bson:"conclusion,omitempty"`
+	CreatedAt    time.Time  `bson:"created_at"`
+	StartedAt    *time.Time `bson:"started_at,omitempty"`
+	CompletedAt  *time.Time `bson:"completed_at,omitempty"`
+}
+
+func NewJob(data *dto.JobRequest) *Job {
+	if data == nil {
+		return nil
+	}
+	return &Job{
+		ID:           data.ID,
+		RunID:        data.RunID,
+		Name:         data.Name,
+		WorkflowName: data.WorkflowName,
+		Repository:   data.Repository,
+		HeadBranch:   data.HeadBranch,
+		HeadSHA:      data.HeadSHA,
+		Conclusion:   data.Conclusion,
+		CreatedAt:    data.CreatedAt,
+		StartedAt:    data.StartedAt,
+		CompletedAt:  data.CompletedAt,
+	}
+}
+
+// QueueWait is the time the job waited for a runner, zero until it started.
+func (j *Job) QueueWait() time.Duration {
+	if j.StartedAt == nil || j.CreatedAt.IsZero() {
+		return 0
+	}
+	return j.StartedAt.Sub(j.CreatedAt)
+}
+
+// Duration is the execution time of the job, zero until it completed.
+func (j *Job) Duration() time.Duration {
+	if j.StartedAt == nil || j.CompletedAt == nil {
+		return 0
+	}
+	return j.CompletedAt.Sub(*j.StartedAt)
+}
@@ -0,0 +1,136 @@
+package entities
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolution is the step of the stored metrics: raw points as scraped, or 1-minute and 1-hour rollups.
+type Resolution string
+
+const (
+	ResolutionRaw    Resolution = "raw"
+	ResolutionMinute Resolution = "1m"
+	ResolutionHour   Resolution = "1h"
+)
+
+// Step returns the bucket size of the rollup resolution, or 0 for raw points.
+func (r Resolution) Step() time.Duration {
+	switch r {
+	case ResolutionMinute:
+		return time.Minute
+	case ResolutionHour:
+		return time.Hour
+	default:
+		return 0
+	}
+}
+
+// Unit returns the $dateTrunc unit of the buckets of the rollup resolution.
+func (r Resolution) Unit() string {
+	if r == ResolutionHour {
+		return "hour"
+	}
+	return "minute"
+}
+
+// Metrics is a point of the metrics time series of a runner. Metadata is the metaField
+// of the time-series collections, so it only holds what identifies the series.
+type Metrics struct {
+	Timestamp time.Time          `bson:"timestamp"`
+	Metadata  MetricsMetadata    `bson:"metadata"`
+	Values    map[string]float64 `bson:"values"`
+
+	// Max and Count are set on rollups, where Values holds the averages of the bucket.
+	Max   map[string]float64 `bson:"max,omitempty"`
+	Count int                `bson:"count,omitempty"`
+}
+
+type MetricsMetadata struct {
+	RunnerID primitive.ObjectID `bson:"runner_id"`
+}
+
+// PendingRollup is a bucket of a runner to roll up, as points of it were saved since it was last rolled up.
+// TouchedAt is the time of the latest save, so that a bucket saved to again while it is rolled up stays pending.
+type PendingRollup struct {
+	ID        PendingRollupID `bson:"_id"`
+	TouchedAt time.Time       `bson:"touched_at"`
+}
+
+type PendingRollupID struct {
+	RunnerID   primitive.ObjectID `bson:"runner_id"`
+	Resolution Resolution         `bson:"resolution"`
+	Bucket     time.Time          `bson:"bucket"`
+}
+
+// MetricsBucket is the average of a value of a runner over a step starting at Timestamp.
+type MetricsBucket struct {
+	RunnerID  primitive.ObjectID `bson:"runner_id"`
+	Timestamp time.Time          `bson:"timestamp"`
+	Field     string             `bson:"field"`
+	Value     float64            `bson:"value"`
+}
+
+// MetricsSeries identifies a value reported by a runner.
+type MetricsSeries struct {
+	RunnerID primitive.ObjectID `bson:"runner_id"`
+	Field    string             `bson:"field"`
+}
+
+// SeriesKey names the value of a series in Metrics.Values: the metric name, followed by the labels
+// that tell apart the series of a runner sorted by name, as in cpu_seconds_total{cpu="0",mode="user"}.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseSeriesKey splits a key made by SeriesKey into the metric name and labels. Keys without
+// labels, such as the ones flattened by the controllers, are returned as the name.
+func ParseSeriesKey(key string) (string, map[string]string) {
+	i := strings.IndexByte(key, '{')
+	if i < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+
+	name, body := key[:i], key[i+1:len(key)-1]
+	labels := make(map[string]string)
+	for body != "" {
+		j := strings.IndexByte(body, '=')
+		if j < 0 {
+			return key, nil
+		}
+		quoted, err := strconv.QuotedPrefix(body[j+1:])
+		if err != nil {
+			return key, nil
+		}
+		value, _ := strconv.Unquote(quoted)
+		labels[body[:j]] = value
+
+		body = strings.TrimPrefix(body[j+1+len(quoted):], ",")
+	}
+	return name, labels
+}
@@ -4,29 +4,87 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"runner-manager-backend/internal/runners/dto"
 	"runner-manager-backend/pkg/constant"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Runner struct {
 	ID          primitive.ObjectID    `bson:"_id,omitempty"`
+	UserID      primitive.ObjectID    `bson:"user_id"`
+	CtrlID      primitive.ObjectID    `bson:"ctrl_id"`
 	Color       string                `bson:"color"`
 	Name        string                `bson:"name"`
+	Pool        string                `bson:"pool"`
+	Labels      []string              `bson:"labels,omitempty"`
+	ARN         string                `bson:"arn"`
 	PrivateIPv4 string                `bson:"private_ipv4"`
 	Status      constant.RunnerStatus `bson:"status"`
-	CreatedAt   time.Time             `bson:"created_at"`
-	UpdatedAt   time.Time             `bson:"updated_at"`
+	StopReason  string                `bson:"stop_reason,omitempty"`
+	// CPU and Memory are the task size in CPU units and MiB, as reported by the controller.
+	CPU              string `bson:"cpu,omitempty"`
+	Memory           string `bson:"memory,omitempty"`
+	CapacityProvider string `bson:"capacity_provider,omitempty"`
+	Job              *Job   `bson:"job,omitempty"`
+	// StatusHistory records when the runner entered each status, oldest first.
+	StatusHistory []*StatusChange `bson:"status_history,omitempty"`
+	CreatedAt     time.Time       `bson:"created_at"`
+	UpdatedAt     time.Time       `bson:"updated_at"`
 }
 
-type Metrics struct {
-	Timestamp time.Time              `bson:"timestamp"`
-	Metadata  map[string]interface{} `bson:"metadata"`
+type StatusChange struct {
+	Status constant.RunnerStatus `bson:"status"`
+	At     time.Time             `bson:"at"`
 }
 
 func NewRunner(data *dto.UpdateRunnerRequest) *Runner {
 	return &Runner{
 		Name:        data.Name,
+		Pool:        data.Pool,
+		Labels:      data.Labels,
+		ARN:         data.ARN,
 		PrivateIPv4: data.PrivateIPv4,
 		Status:      data.Status,
+		StopReason:  data.StopReason,
+		CPU:         data.CPU,
+		Memory:      data.Memory,
+		Job:         NewJob(data.Job),
 		CreatedAt:   time.Now(),
+
+		CapacityProvider: data.CapacityProvider,
+	}
+}
+
+// VCPU returns the vCPUs of the runner, from CPU units ("1024") or vCPUs ("1 vCPU").
+func (r *Runner) VCPU() float64 {
+	return parseSize(r.CPU, "vcpu", 1024)
+}
+
+// MemoryGB returns the memory of the runner in GB, from MiB ("2048") or GB ("2 GB").
+func (r *Runner) MemoryGB() float64 {
+	return parseSize(r.Memory, "gb", 1024)
+}
+
+// IsSpot reports whether the runner was placed on Spot capacity.
+func (r *Runner) IsSpot() bool {
+	return strings.HasSuffix(strings.ToUpper(r.CapacityProvider), "_SPOT")
+}
+
+func parseSize(value, unit string, unitsPerUnit float64) float64 {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0
+	}
+	if strings.HasSuffix(value, unit) {
+		size, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, unit)), 64)
+		if err != nil {
+			return 0
+		}
+		return size
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
 	}
+	return size / unitsPerUnit
 }
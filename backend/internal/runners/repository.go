@@ -2,13 +2,23 @@ package runners
 
 import (
 	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	ctrlEntities "runner-manager-backend/internal/ctrls/entities"
 	"runner-manager-backend/internal/runners/entities"
+	"time"
 )
 
 type Repository interface {
-	UpdateRunners(ctx context.Context, userID string, ctrlID string, runners []*entities.Runner) ([]*ctrlEntities.RunnerController, map[string]*entities.Runner, error)
+	SeenCtrl(ctx context.Context, userID, ctrlID string) error
+	UpdateRunners(ctx context.Context, userID string, ctrlID string, runners []*entities.Runner) (map[string]*entities.Runner, error)
 	SaveMetrics(ctx context.Context, metrics []*entities.Metrics) error
-	GetAllMetricsByCtrlID(ctx context.Context, userID, ctrlID string) (map[string][]*entities.Metrics, error)
-	GetAllCtrlsByUserID(ctx context.Context, userID string) ([]*ctrlEntities.RunnerController, error)
+	GetRunnersByCtrlID(ctx context.Context, userID, ctrlID string) ([]*entities.Runner, error)
+	GetRunnerByID(ctx context.Context, userID, runnerID string) (*entities.Runner, error)
+	FindRunners(ctx context.Context, userID, ctrlID string, runnerIDs []primitive.ObjectID, names []string) ([]*entities.Runner, error)
+	AggregateMetrics(ctx context.Context, res entities.Resolution, runnerIDs []primitive.ObjectID, from, to time.Time, step time.Duration, fields []string) ([]*entities.MetricsBucket, error)
+	GetMetricsSeries(ctx context.Context, res entities.Resolution, runnerIDs []primitive.ObjectID, from, to time.Time) ([]*entities.MetricsSeries, error)
+	RollupMetrics(ctx context.Context, res entities.Resolution, runnerIDs []primitive.ObjectID, from, to time.Time) (int, error)
+	GetPendingRollups(ctx context.Context, res entities.Resolution, before time.Time) ([]*entities.PendingRollup, error)
+	DeletePendingRollups(ctx context.Context, pending []*entities.PendingRollup) error
+	GetAllCtrlsByUserID(ctx context.Context, userID string, archived bool) ([]*ctrlEntities.RunnerController, error)
 }
@@ -9,124 +9,190 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"math/rand"
+	"regexp"
 	ctrlEntities "runner-manager-backend/internal/ctrls/entities"
 	"runner-manager-backend/internal/runners"
 	"runner-manager-backend/internal/runners/entities"
-	userEntities "runner-manager-backend/internal/users/entities"
 	"runner-manager-backend/pkg/response"
+	"strings"
 	"time"
 )
 
 type repository struct {
-	usersColl   *mongo.Collection
-	metricsColl *mongo.Collection
+	ctrlsColl    *mongo.Collection
+	runnersColl  *mongo.Collection
+	metricsColls map[entities.Resolution]*mongo.Collection
+	rollupsColl  *mongo.Collection
 	//conn datasource.ConnTx
 }
 
-func NewRepository(usersColl *mongo.Collection, metricsColl *mongo.Collection) runners.Repository {
+func NewRepository(ctrlsColl *mongo.Collection, runnersColl *mongo.Collection, metricsColls map[entities.Resolution]*mongo.Collection, rollupsColl *mongo.Collection) runners.Repository {
 	return &repository{
-		usersColl:   usersColl,
-		metricsColl: metricsColl,
+		ctrlsColl:    ctrlsColl,
+		runnersColl:  runnersColl,
+		metricsColls: metricsColls,
+		rollupsColl:  rollupsColl,
 	}
 }
 
-func (r *repository) UpdateRunners(ctx context.Context, userID string, ctrlID string, runners []*entities.Runner) ([]*ctrlEntities.RunnerController, map[string]*entities.Runner, error) {
+// SeenCtrl records a push of the controller as a heartbeat. It fails for the controllers of other
+// users and the archived ones, which may not push anymore.
+func (r *repository) SeenCtrl(ctx context.Context, userID, ctrlID string) error {
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, nil, response.ErrUserNotFound
+		return response.ErrUserNotFound
 	}
 
 	ctrlObjectID, err := primitive.ObjectIDFromHex(ctrlID)
 	if err != nil {
-		return nil, nil, response.ErrUserNotFound
+		return response.NotFound(response.ErrCtrlNotFound)
 	}
 
-	var user *userEntities.User
-	err = r.usersColl.FindOne(ctx, bson.M{"_id": userObjectID}).Decode(&user)
+	result, err := r.ctrlsColl.UpdateOne(ctx,
+		bson.M{"_id": ctrlObjectID, "user_id": userObjectID, "archived_at": nil},
+		bson.M{"$set": bson.M{"last_seen_at": time.Now()}},
+	)
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return response.NotFound(response.ErrCtrlNotFound)
 	}
+	return nil
+}
 
-	var ctrlFound bool
-	var runnerMap map[string]*entities.Runner
-	var ctrls []*ctrlEntities.RunnerController
-	for i, ctrl := range user.RunnerController {
-		if ctrl.ID == ctrlObjectID {
-			ctrlFound = true
-			runnerMap = make(map[string]*entities.Runner)
-			for _, existingRunner := range ctrl.Runners {
-				runnerMap[existingRunner.Name] = existingRunner
-			}
+// UpdateRunners upserts the runners reported by the controller, one atomic update per runner,
+// so controllers of the same user pushing concurrently do not overwrite each other.
+// A status change is recorded in the status history of the runner. The controller is checked by SeenCtrl.
+// It returns the ID and name of the updated runners, by name.
+func (r *repository) UpdateRunners(ctx context.Context, userID string, ctrlID string, runners []*entities.Runner) (map[string]*entities.Runner, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, response.ErrUserNotFound
+	}
 
-			for _, newRunner := range runners {
-				if oldRunner, ok := runnerMap[newRunner.Name]; ok {
-					newRunner.ID = oldRunner.ID
-					newRunner.CreatedAt = oldRunner.CreatedAt
-					if newRunner.Status != oldRunner.Status {
-						newRunner.UpdatedAt = time.Now()
-					} else {
-						newRunner.UpdatedAt = oldRunner.UpdatedAt
-					}
-				} else {
-					newRunner.ID = primitive.NewObjectID()
-					newRunner.Color = randomColor()
-					user.RunnerController[i].UpdatedAt = time.Now()
-				}
-				runnerMap[newRunner.Name] = newRunner
-			}
+	ctrlObjectID, err := primitive.ObjectIDFromHex(ctrlID)
+	if err != nil {
+		return nil, response.ErrUserNotFound
+	}
 
-			var updatedRunners []*entities.Runner
-			for _, runner := range runnerMap {
-				updatedRunners = append(updatedRunners, runner)
-			}
+	now := time.Now()
+	names := make([]string, 0, len(runners))
+	models := make([]mongo.WriteModel, 0, 2*len(runners))
+	for _, runner := range runners {
+		names = append(names, runner.Name)
+		filter := bson.M{"ctrl_id": ctrlObjectID, "name": runner.Name}
 
-			user.RunnerController[i].Runners = updatedRunners
-			ctrls = user.RunnerController
-			runners = updatedRunners
-			break
-		}
-	}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(bson.M{
+				"$set": bson.M{
+					"pool":              runner.Pool,
+					"labels":            runner.Labels,
+					"arn":               runner.ARN,
+					"private_ipv4":      runner.PrivateIPv4,
+					"stop_reason":       runner.StopReason,
+					"cpu":               runner.CPU,
+					"memory":            runner.Memory,
+					"capacity_provider": runner.CapacityProvider,
+					"job":               runner.Job,
+				},
+				"$setOnInsert": bson.M{
+					"_id":            primitive.NewObjectID(),
+					"user_id":        userObjectID,
+					"color":          randomColor(),
+					"status":         runner.Status,
+					"status_history": []*entities.StatusChange{{Status: runner.Status, At: now}},
+					"created_at":     now,
+					"updated_at":     now,
+				},
+			}).
+			SetUpsert(true),
+		)
 
-	if !ctrlFound {
-		return ctrls, nil, errors.New("controller not found")
+		// Only matches runners that existed before with another status
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"ctrl_id": ctrlObjectID, "name": runner.Name, "status": bson.M{"$ne": runner.Status}}).
+			SetUpdate(bson.M{
+				"$set":  bson.M{"status": runner.Status, "updated_at": now},
+				"$push": bson.M{"status_history": &entities.StatusChange{Status: runner.Status, At: now}},
+			}),
+		)
 	}
 
-	newCtrls := make([]*ctrlEntities.RunnerController, 0, len(user.RunnerController))
-	for _, ctrl := range user.RunnerController {
-		if len(ctrl.Runners) == 0 && ctrl.UpdatedAt.Add(time.Minute*60).Before(time.Now()) {
-			continue
+	if len(models) > 0 {
+		result, err := r.runnersColl.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+		if err != nil {
+			return nil, err
+		}
+		if result.UpsertedCount > 0 {
+			_, err = r.ctrlsColl.UpdateOne(ctx, bson.M{"_id": ctrlObjectID}, bson.M{"$set": bson.M{"updated_at": now}})
+			if err != nil {
+				return nil, err
+			}
 		}
-		newCtrls = append(newCtrls, ctrl)
 	}
-	user.RunnerController = newCtrls
 
-	// Update the user document with the modified controllers
-	_, err = r.usersColl.ReplaceOne(ctx, bson.M{"_id": userObjectID}, user)
+	var updated []*entities.Runner
+	cursor, err := r.runnersColl.Find(ctx,
+		bson.M{"ctrl_id": ctrlObjectID, "name": bson.M{"$in": names}},
+		options.Find().SetProjection(bson.M{"_id": 1, "name": 1}),
+	)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if err = cursor.All(ctx, &updated); err != nil {
+		return nil, err
 	}
 
-	return ctrls, runnerMap, nil
+	runnerMap := make(map[string]*entities.Runner, len(updated))
+	for _, runner := range updated {
+		runnerMap[runner.Name] = runner
+	}
+
+	return runnerMap, nil
 }
 
+// SaveMetrics stores the raw points, and marks their 1-minute and 1-hour buckets as pending rollup,
+// however late the points arrive.
 func (r *repository) SaveMetrics(ctx context.Context, metrics []*entities.Metrics) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
 	s := make([]interface{}, len(metrics))
 	for i, v := range metrics {
 		s[i] = v
 	}
-
-	if len(s) == 0 {
-		return nil
-	}
-	_, err := r.metricsColl.InsertMany(ctx, s)
-	if err != nil {
+	if _, err := r.metricsColls[entities.ResolutionRaw].InsertMany(ctx, s); err != nil {
 		return err
 	}
 
-	return nil
+	now := time.Now()
+	pending := make(map[entities.PendingRollupID]struct{})
+	for _, metric := range metrics {
+		for _, res := range []entities.Resolution{entities.ResolutionMinute, entities.ResolutionHour} {
+			pending[entities.PendingRollupID{
+				RunnerID:   metric.Metadata.RunnerID,
+				Resolution: res,
+				Bucket:     metric.Timestamp.UTC().Truncate(res.Step()),
+			}] = struct{}{}
+		}
+	}
+
+	models := make([]mongo.WriteModel, 0, len(pending))
+	for id := range pending {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$set": bson.M{"touched_at": now}}).
+			SetUpsert(true))
+	}
+	_, err := r.rollupsColl.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
 }
 
-func (r *repository) GetAllMetricsByCtrlID(ctx context.Context, userID, ctrlID string) (map[string][]*entities.Metrics, error) {
+// GetRunnersByCtrlID returns the ID and name of the runners of the controller, by name.
+func (r *repository) GetRunnersByCtrlID(ctx context.Context, userID, ctrlID string) ([]*entities.Runner, error) {
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, response.ErrUserNotFound
@@ -137,56 +203,308 @@ func (r *repository) GetAllMetricsByCtrlID(ctx context.Context, userID, ctrlID s
 		return nil, response.ErrUserNotFound
 	}
 
-	var user *userEntities.User
-	err = r.usersColl.FindOne(ctx, bson.M{"_id": userObjectID}).Decode(&user)
+	var ctrlRunners []*entities.Runner
+	cursor, err := r.runnersColl.Find(
+		ctx,
+		bson.M{"user_id": userObjectID, "ctrl_id": ctrlObjectID},
+		options.Find().SetProjection(bson.M{"_id": 1, "name": 1}).SetSort(bson.M{"name": 1}),
+	)
 	if err != nil {
 		return nil, err
 	}
+	if err = cursor.All(ctx, &ctrlRunners); err != nil {
+		return nil, err
+	}
 
-	runnerIDs := make([]primitive.ObjectID, 0, 4)
-	for _, ctrl := range user.RunnerController {
-		if ctrl.ID != ctrlObjectID {
-			continue
-		}
-		for _, runner := range ctrl.Runners {
-			runnerIDs = append(runnerIDs, runner.ID)
-		}
-		break
+	return ctrlRunners, nil
+}
+
+func (r *repository) GetRunnerByID(ctx context.Context, userID, runnerID string) (*entities.Runner, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, response.ErrUserNotFound
 	}
 
-	res := make(map[string][]*entities.Metrics)
-	for _, runnerID := range runnerIDs {
-		var metrics []*entities.Metrics
-		cursor, err := r.metricsColl.Find(
-			ctx,
-			bson.M{"metadata.runner_id": runnerID},
-			options.Find().SetProjection(bson.M{"metadata.runner_id": 0}),
-		)
+	runnerObjectID, err := primitive.ObjectIDFromHex(runnerID)
+	if err != nil {
+		return nil, response.NotFound(response.ErrRunnerNotFound)
+	}
+
+	var runner entities.Runner
+	err = r.runnersColl.FindOne(ctx, bson.M{"_id": runnerObjectID, "user_id": userObjectID}).Decode(&runner)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, response.NotFound(response.ErrRunnerNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &runner, nil
+}
+
+// FindRunners returns the runners of the user with any of the IDs or names, oldest first. When
+// ctrlID is set, only the runners of that controller are returned.
+func (r *repository) FindRunners(ctx context.Context, userID, ctrlID string, runnerIDs []primitive.ObjectID, names []string) ([]*entities.Runner, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, response.ErrUserNotFound
+	}
+
+	filter := bson.M{
+		"user_id": userObjectID,
+		"$or": bson.A{
+			bson.M{"_id": bson.M{"$in": runnerIDs}},
+			bson.M{"name": bson.M{"$in": names}},
+		},
+	}
+	if ctrlID != "" {
+		ctrlObjectID, err := primitive.ObjectIDFromHex(ctrlID)
 		if err != nil {
-			return nil, err
+			return nil, response.ErrUserNotFound
 		}
-		if err = cursor.All(ctx, &metrics); err != nil {
-			return nil, err
+		filter["ctrl_id"] = ctrlObjectID
+	}
+
+	var found []*entities.Runner
+	cursor, err := r.runnersColl.Find(
+		ctx,
+		filter,
+		options.Find().SetProjection(bson.M{"_id": 1, "name": 1, "ctrl_id": 1}).SetSort(bson.M{"created_at": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// AggregateMetrics averages the values of the runners in [from, to) over steps starting at from.
+// Only the values of the given metric names are returned, with or without series labels, or all of
+// them when fields is empty.
+func (r *repository) AggregateMetrics(ctx context.Context, res entities.Resolution, runnerIDs []primitive.ObjectID, from, to time.Time, step time.Duration, fields []string) ([]*entities.MetricsBucket, error) {
+	// The bucket of a point is from + floor((timestamp - from) / step) * step.
+	offset := bson.M{"$subtract": bson.A{"$timestamp", from}}
+	bucket := bson.M{"$add": bson.A{
+		from,
+		bson.M{"$subtract": bson.A{offset, bson.M{"$mod": bson.A{offset, step.Milliseconds()}}}},
+	}}
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{
+			"metadata.runner_id": bson.M{"$in": runnerIDs},
+			"timestamp":          bson.M{"$gte": from, "$lt": to},
+		}},
+		bson.M{"$project": bson.M{
+			"runner_id": "$metadata.runner_id",
+			"timestamp": 1,
+			"kv":        bson.M{"$objectToArray": "$values"},
+		}},
+		bson.M{"$unwind": "$kv"},
+	}
+	if len(fields) > 0 {
+		quoted := make([]string, 0, len(fields))
+		for _, field := range fields {
+			quoted = append(quoted, regexp.QuoteMeta(field))
 		}
-		res[runnerID.Hex()] = metrics
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"$or": bson.A{
+			bson.M{"kv.k": bson.M{"$in": fields}},
+			bson.M{"kv.k": bson.M{"$regex": `^(?:` + strings.Join(quoted, "|") + `)\{`}},
+		}}})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"runner_id": "$runner_id", "bucket": bucket, "field": "$kv.k"},
+			"value": bson.M{"$avg": "$kv.v"},
+		}},
+		bson.M{"$project": bson.M{
+			"_id":       0,
+			"runner_id": "$_id.runner_id",
+			"timestamp": "$_id.bucket",
+			"field":     "$_id.field",
+			"value":     1,
+		}},
+	)
+
+	cursor, err := r.metricsColls[res].Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []*entities.MetricsBucket
+	if err = cursor.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// GetMetricsSeries returns the values reported by the runners in [from, to).
+func (r *repository) GetMetricsSeries(ctx context.Context, res entities.Resolution, runnerIDs []primitive.ObjectID, from, to time.Time) ([]*entities.MetricsSeries, error) {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{
+			"metadata.runner_id": bson.M{"$in": runnerIDs},
+			"timestamp":          bson.M{"$gte": from, "$lt": to},
+		}},
+		bson.M{"$project": bson.M{
+			"runner_id": "$metadata.runner_id",
+			"fields":    bson.M{"$map": bson.M{"input": bson.M{"$objectToArray": "$values"}, "in": "$$this.k"}},
+		}},
+		bson.M{"$unwind": "$fields"},
+		bson.M{"$group": bson.M{"_id": bson.M{"runner_id": "$runner_id", "field": "$fields"}}},
+		bson.M{"$project": bson.M{"_id": 0, "runner_id": "$_id.runner_id", "field": "$_id.field"}},
+	}
+
+	cursor, err := r.metricsColls[res].Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var series []*entities.MetricsSeries
+	if err = cursor.All(ctx, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// RollupMetrics aggregates the raw points of the runners in [from, to) into buckets of the resolution, averaging
+// and taking the maximum of every value per runner, and upserts them in the collection of the resolution,
+// so that rolling up the same buckets again replaces them.
+func (r *repository) RollupMetrics(ctx context.Context, res entities.Resolution, runnerIDs []primitive.ObjectID, from, to time.Time) (int, error) {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{
+			"metadata.runner_id": bson.M{"$in": runnerIDs},
+			"timestamp":          bson.M{"$gte": from, "$lt": to},
+		}},
+		bson.M{"$project": bson.M{
+			"runner_id": "$metadata.runner_id",
+			"bucket":    bson.M{"$dateTrunc": bson.M{"date": "$timestamp", "unit": res.Unit()}},
+			"kv":        bson.M{"$objectToArray": "$values"},
+		}},
+		bson.M{"$unwind": "$kv"},
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"runner_id": "$runner_id", "bucket": "$bucket", "k": "$kv.k"},
+			"avg":   bson.M{"$avg": "$kv.v"},
+			"max":   bson.M{"$max": "$kv.v"},
+			"count": bson.M{"$sum": 1},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":    bson.M{"runner_id": "$_id.runner_id", "bucket": "$_id.bucket"},
+			"values": bson.M{"$push": bson.M{"k": "$_id.k", "v": "$avg"}},
+			"max":    bson.M{"$push": bson.M{"k": "$_id.k", "v": "$max"}},
+			"count":  bson.M{"$max": "$count"},
+		}},
+		bson.M{"$project": bson.M{
+			"_id":       0,
+			"timestamp": "$_id.bucket",
+			"metadata":  bson.M{"runner_id": "$_id.runner_id"},
+			"values":    bson.M{"$arrayToObject": "$values"},
+			"max":       bson.M{"$arrayToObject": "$max"},
+			"count":     1,
+		}},
+	}
+
+	cursor, err := r.metricsColls[entities.ResolutionRaw].Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
 	}
 
-	return res, nil
+	var rollups []*entities.Metrics
+	if err = cursor.All(ctx, &rollups); err != nil {
+		return 0, err
+	}
+
+	if len(rollups) == 0 {
+		return 0, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(rollups))
+	for _, rollup := range rollups {
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"metadata.runner_id": rollup.Metadata.RunnerID, "timestamp": rollup.Timestamp}).
+			SetReplacement(rollup).
+			SetUpsert(true))
+	}
+	if _, err = r.metricsColls[res].BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, err
+	}
+	return len(rollups), nil
+}
+
+// GetPendingRollups returns the buckets of the resolution pending rollup that start before the given time.
+func (r *repository) GetPendingRollups(ctx context.Context, res entities.Resolution, before time.Time) ([]*entities.PendingRollup, error) {
+	cursor, err := r.rollupsColl.Find(ctx, bson.M{
+		"_id.resolution": res,
+		"_id.bucket":     bson.M{"$lt": before},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]*entities.PendingRollup, 0)
+	if err = cursor.All(ctx, &pending); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// DeletePendingRollups removes the rolled up buckets from the pending ones, unless points were saved to them since.
+func (r *repository) DeletePendingRollups(ctx context.Context, pending []*entities.PendingRollup) error {
+	if len(pending) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(pending))
+	for _, p := range pending {
+		models = append(models, mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": p.ID, "touched_at": p.TouchedAt}))
+	}
+	_, err := r.rollupsColl.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
 }
 
-func (r *repository) GetAllCtrlsByUserID(ctx context.Context, userID string) ([]*ctrlEntities.RunnerController, error) {
+// GetAllCtrlsByUserID returns the controllers of the user with their runners, oldest first, along with the
+// archived ones when archived is set.
+func (r *repository) GetAllCtrlsByUserID(ctx context.Context, userID string, archived bool) ([]*ctrlEntities.RunnerController, error) {
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, response.ErrUserNotFound
 	}
 
-	var user *userEntities.User
-	err = r.usersColl.FindOne(ctx, bson.M{"_id": userObjectID}).Decode(&user)
+	filter := bson.M{"user_id": userObjectID}
+	if !archived {
+		filter["archived_at"] = nil
+	}
+
+	ctrls := make([]*ctrlEntities.RunnerController, 0)
+	cursor, err := r.ctrlsColl.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": 1}))
 	if err != nil {
 		return nil, err
 	}
+	if err = cursor.All(ctx, &ctrls); err != nil {
+		return nil, err
+	}
+
+	var userRunners []*entities.Runner
+	cursor, err = r.runnersColl.Find(ctx, bson.M{"user_id": userObjectID}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &userRunners); err != nil {
+		return nil, err
+	}
+
+	ctrlMap := make(map[primitive.ObjectID]*ctrlEntities.RunnerController, len(ctrls))
+	for _, ctrl := range ctrls {
+		ctrl.Runners = make([]*entities.Runner, 0)
+		ctrlMap[ctrl.ID] = ctrl
+	}
+	for _, runner := range userRunners {
+		if ctrl, ok := ctrlMap[runner.CtrlID]; ok {
+			ctrl.Runners = append(ctrl.Runners, runner)
+		}
+	}
 
-	return user.RunnerController, nil
+	return ctrls, nil
 }
 
 func randomColor() string {
@@ -2,11 +2,23 @@ package runners
 
 import (
 	"context"
+	"runner-manager-backend/internal/middleware"
 	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/pkg/remotewrite"
 )
 
 type Usecase interface {
-	UpdateRunners(ctx context.Context, userID, ctrlID string, payload *dto.UpdateRunnersRequest) ([]*dto.RunnerControllerWSResponse, error)
+	UpdateRunners(ctx context.Context, userID, ctrlID string, payload *dto.UpdateRunnersRequest) error
 	GetAllCtrlsByUserID(ctx context.Context, userID string) ([]*dto.RunnerControllerWSResponse, error)
-	GetAllMetricsByCtrlID(ctx context.Context, userID, ctrlID string) (*dto.MetricsCtrlWSResponse, error)
+	GetRunnerMetrics(ctx context.Context, userID, runnerID string, query *dto.MetricsQuery) (*dto.MetricsResponse, error)
+	GetCtrlMetrics(ctx context.Context, userID, ctrlID string, query *dto.MetricsQuery) (*dto.MetricsResponse, error)
+	RollupMetrics(ctx context.Context) error
+	QueryRange(ctx context.Context, userID string, query *dto.PromQueryRangeQuery) (*dto.PromMatrix, error)
+	RemoteWrite(ctx context.Context, userID, ctrlID string, req *remotewrite.WriteRequest) (*dto.RemoteWriteResponse, error)
+	GetSeries(ctx context.Context, userID string, query *dto.PromSeriesQuery) ([]map[string]string, error)
+	GetAnalytics(ctx context.Context, userID string, query *dto.AnalyticsQuery) (*dto.AnalyticsResponse, error)
+	GetCosts(ctx context.Context, userID string, query *dto.CostQuery) (*dto.CostResponse, error)
+	GetForecast(ctx context.Context, userID string, query *dto.ForecastQuery) (*dto.ForecastResponse, error)
+	NewStreamToken(ctx context.Context, data *middleware.Data) (*dto.StreamTokenResponse, error)
+	GetRunnerLogs(ctx context.Context, userID, runnerID string, lines int) (*dto.RunnerLogsResponse, error)
 }
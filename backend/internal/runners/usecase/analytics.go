@@ -0,0 +1,241 @@
+package usecase
+
+import (
+	"context"
+	"math"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/internal/runners/entities"
+	"runner-manager-backend/pkg/constant"
+	"sort"
+	"time"
+)
+
+const (
+	unknownGroup   = "unknown"
+	jobFailure     = "failure"
+	jobTimedOut    = "timed_out"
+	jobStartFailed = "startup_failure"
+)
+
+type analyticsGroup struct {
+	runners       int
+	failedRunners int
+	jobs          int
+	failedJobs    int
+	queueLatency  []time.Duration
+	jobDuration   []time.Duration
+	busy          time.Duration
+	provisioned   time.Duration
+}
+
+// GetAnalytics aggregates the runners of the user over the time range by repository, workflow, label or pool.
+// Runners count in the range they were created in, jobs in the range they started (queue latency)
+// or completed (duration, failures) in, and busy and provisioned times are clipped to the range.
+// The runners of the archived controllers are included, as they ran all the same.
+func (uc *usecase) GetAnalytics(ctx context.Context, userID string, query *dto.AnalyticsQuery) (*dto.AnalyticsResponse, error) {
+	ctrls, err := uc.repo.GetAllCtrlsByUserID(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*analyticsGroup)
+	for _, ctrl := range ctrls {
+		for _, runner := range ctrl.Runners {
+			for _, key := range groupKeys(runner, query.GroupBy) {
+				group, ok := groups[key]
+				if !ok {
+					group = &analyticsGroup{}
+					groups[key] = group
+				}
+				group.add(runner, query.From, query.To)
+			}
+		}
+	}
+
+	rsp := &dto.AnalyticsResponse{
+		From:    query.From.Format(time.RFC3339),
+		To:      query.To.Format(time.RFC3339),
+		GroupBy: query.GroupBy,
+		Groups:  make([]*dto.AnalyticsGroup, 0, len(groups)),
+	}
+	for key, group := range groups {
+		if group.runners == 0 && group.jobs == 0 && len(group.queueLatency) == 0 && group.provisioned == 0 {
+			continue
+		}
+		rsp.Groups = append(rsp.Groups, group.response(key))
+	}
+	sort.Slice(rsp.Groups, func(i, j int) bool {
+		return rsp.Groups[i].Key < rsp.Groups[j].Key
+	})
+
+	return rsp, nil
+}
+
+func groupKeys(runner *entities.Runner, groupBy string) []string {
+	var keys []string
+	switch groupBy {
+	case dto.AnalyticsGroupByRepository:
+		if runner.Job != nil && runner.Job.Repository != "" {
+			keys = []string{runner.Job.Repository}
+		}
+	case dto.AnalyticsGroupByWorkflow:
+		if runner.Job != nil && runner.Job.WorkflowName != "" {
+			keys = []string{runner.Job.Repository + "/" + runner.Job.WorkflowName}
+		}
+	case dto.AnalyticsGroupByLabel:
+		keys = runner.Labels
+	case dto.AnalyticsGroupByPool:
+		if runner.Pool != "" {
+			keys = []string{runner.Pool}
+		}
+	}
+	if len(keys) == 0 {
+		return []string{unknownGroup}
+	}
+	return keys
+}
+
+func (g *analyticsGroup) add(runner *entities.Runner, from, to time.Time) {
+	if inRange(runner.CreatedAt, from, to) {
+		g.runners++
+		if runner.Status == constant.RunnerStatusFailed {
+			g.failedRunners++
+		}
+	}
+
+	if job := runner.Job; job != nil {
+		if job.StartedAt != nil && inRange(*job.StartedAt, from, to) {
+			g.queueLatency = append(g.queueLatency, job.QueueWait())
+		}
+		if job.CompletedAt != nil && inRange(*job.CompletedAt, from, to) {
+			g.jobs++
+			if job.StartedAt != nil {
+				g.jobDuration = append(g.jobDuration, job.Duration())
+			}
+			switch job.Conclusion {
+			case jobFailure, jobTimedOut, jobStartFailed:
+				g.failedJobs++
+			}
+		}
+	}
+
+	busy, provisioned := runnerTimes(runner, from, to)
+	g.busy += busy
+	g.provisioned += provisioned
+}
+
+// runnerTimes returns the time the runner was busy and the time it was provisioned within the range.
+func runnerTimes(runner *entities.Runner, from, to time.Time) (busy, provisioned time.Duration) {
+	for _, period := range runnerPeriods(runner) {
+		d := overlap(period.start, period.end, from, to)
+		provisioned += d
+		if period.status == constant.RunnerStatusBusy {
+			busy += d
+		}
+	}
+	return busy, provisioned
+}
+
+type statusPeriod struct {
+	status     constant.RunnerStatus
+	start, end time.Time
+}
+
+// runnerPeriods returns the periods the runner was provisioned, from its status history.
+// A runner is provisioned from its creation until it finishes, fails or terminates.
+func runnerPeriods(runner *entities.Runner) []statusPeriod {
+	history := runner.StatusHistory
+	periods := make([]statusPeriod, 0, len(history))
+	now := time.Now()
+	for i, change := range history {
+		if isFinal(change.Status) {
+			continue
+		}
+
+		end := now
+		if i+1 < len(history) {
+			end = history[i+1].At
+		}
+		periods = append(periods, statusPeriod{status: change.Status, start: change.At, end: end})
+	}
+	return periods
+}
+
+func (g *analyticsGroup) response(key string) *dto.AnalyticsGroup {
+	return &dto.AnalyticsGroup{
+		Key:                key,
+		Runners:            g.runners,
+		FailedRunners:      g.failedRunners,
+		RunnerFailureRate:  ratio(float64(g.failedRunners), float64(g.runners)),
+		Jobs:               g.jobs,
+		FailedJobs:         g.failedJobs,
+		JobFailureRate:     ratio(float64(g.failedJobs), float64(g.jobs)),
+		QueueLatency:       durationStats(g.queueLatency),
+		JobDuration:        durationStats(g.jobDuration),
+		BusySeconds:        g.busy.Seconds(),
+		ProvisionedSeconds: g.provisioned.Seconds(),
+		Utilization:        ratio(g.busy.Seconds(), g.provisioned.Seconds()),
+	}
+}
+
+func durationStats(durations []time.Duration) *dto.DurationStats {
+	stats := &dto.DurationStats{Count: len(durations)}
+	if len(durations) == 0 {
+		return stats
+	}
+
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	stats.Avg = (total / time.Duration(len(durations))).Seconds()
+	stats.P50 = percentile(durations, 50)
+	stats.P90 = percentile(durations, 90)
+	stats.P95 = percentile(durations, 95)
+	stats.P99 = percentile(durations, 99)
+	stats.Max = durations[len(durations)-1].Seconds()
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations, in seconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Seconds()
+}
+
+func isFinal(status constant.RunnerStatus) bool {
+	return status == constant.RunnerStatusFinished ||
+		status == constant.RunnerStatusFailed ||
+		status == constant.RunnerStatusTerminated
+}
+
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+func overlap(start, end, from, to time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
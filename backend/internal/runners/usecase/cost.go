@@ -0,0 +1,153 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	ctrlEntities "runner-manager-backend/internal/ctrls/entities"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/internal/runners/entities"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const costDayFormat = "2006-01-02"
+
+// GetCosts estimates the cost of the runners of the user over the time range from the configured prices.
+// A runner costs its size for the time it was provisioned within the range, discounted on Spot capacity.
+// Grouped by day, the provisioned time of a runner is split at midnight UTC. Archived controllers were billed too.
+func (uc *usecase) GetCosts(ctx context.Context, userID string, query *dto.CostQuery) (*dto.CostResponse, error) {
+	ctrls, err := uc.repo.GetAllCtrlsByUserID(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*dto.CostGroup)
+	counted := make(map[string]map[string]struct{})
+	add := func(key string, runner *entities.Runner, d time.Duration) {
+		if d <= 0 {
+			return
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &dto.CostGroup{Key: key}
+			groups[key] = group
+			counted[key] = make(map[string]struct{})
+		}
+		if _, ok := counted[key][runner.ID.Hex()]; !ok {
+			counted[key][runner.ID.Hex()] = struct{}{}
+			group.Runners++
+		}
+
+		hours := d.Hours()
+		group.RunnerHours += hours
+		group.VCPUHours += hours * runner.VCPU()
+		group.GBHours += hours * runner.MemoryGB()
+		if runner.IsSpot() {
+			group.SpotHours += hours
+		}
+		group.Cost += uc.runnerCost(runner, hours)
+	}
+
+	for _, ctrl := range ctrls {
+		for _, runner := range ctrl.Runners {
+			for _, period := range runnerPeriods(runner) {
+				if query.GroupBy != dto.CostGroupByDay {
+					add(costKey(ctrl, runner, query.GroupBy), runner, overlap(period.start, period.end, query.From, query.To))
+					continue
+				}
+				for day := period.start.UTC().Truncate(24 * time.Hour); day.Before(period.end); day = day.Add(24 * time.Hour) {
+					d := overlap(period.start, period.end, maxTime(day, query.From), minTime(day.Add(24*time.Hour), query.To))
+					add(day.Format(costDayFormat), runner, d)
+				}
+			}
+		}
+	}
+
+	rsp := &dto.CostResponse{
+		From:     query.From.Format(time.RFC3339),
+		To:       query.To.Format(time.RFC3339),
+		GroupBy:  query.GroupBy,
+		Currency: uc.cfg.Pricing.Currency,
+		Groups:   make([]*dto.CostGroup, 0, len(groups)),
+	}
+	for _, group := range groups {
+		rsp.Total += group.Cost
+		rsp.Groups = append(rsp.Groups, group)
+	}
+	sort.Slice(rsp.Groups, func(i, j int) bool {
+		return rsp.Groups[i].Key < rsp.Groups[j].Key
+	})
+
+	return rsp, nil
+}
+
+func (uc *usecase) runnerCost(runner *entities.Runner, hours float64) float64 {
+	pricing := uc.cfg.Pricing
+	cost := hours * (runner.VCPU()*pricing.VCPUHour + runner.MemoryGB()*pricing.GBHour)
+	if runner.IsSpot() {
+		cost *= 1 - pricing.SpotDiscount
+	}
+	return cost
+}
+
+func costKey(ctrl *ctrlEntities.RunnerController, runner *entities.Runner, groupBy string) string {
+	switch groupBy {
+	case dto.CostGroupByController:
+		return ctrl.Name
+	case dto.CostGroupByRunner:
+		return runner.Name
+	case dto.CostGroupByJob:
+		if runner.Job == nil {
+			return unknownGroup
+		}
+		return fmt.Sprintf("%s/%s/%s#%d", runner.Job.Repository, runner.Job.WorkflowName, runner.Job.Name, runner.Job.ID)
+	default:
+		return groupKeys(runner, groupBy)[0]
+	}
+}
+
+// CostsCSV renders the cost groups as CSV, one line per group.
+func CostsCSV(costs *dto.CostResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	records := [][]string{{costs.GroupBy, "runners", "runner_hours", "spot_hours", "vcpu_hours", "gb_hours", "cost", "currency"}}
+	for _, group := range costs.Groups {
+		records = append(records, []string{
+			group.Key,
+			strconv.Itoa(group.Runners),
+			formatFloat(group.RunnerHours),
+			formatFloat(group.SpotHours),
+			formatFloat(group.VCPUHours),
+			formatFloat(group.GBHours),
+			formatFloat(group.Cost),
+			costs.Currency,
+		})
+	}
+
+	if err := w.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"context"
+	"math"
+	"runner-manager-backend/internal/runners/dto"
+	"sort"
+	"time"
+)
+
+// GetForecast derives the hourly demand profile of the pools from the start times of the jobs of the past weeks.
+// Pools are matched by name across the controllers of the user, archived ones included, as a restarted
+// controller registers anew.
+// Jobs that did not start yet count at the time they were queued.
+func (uc *usecase) GetForecast(ctx context.Context, userID string, query *dto.ForecastQuery) (*dto.ForecastResponse, error) {
+	weeks := query.Weeks
+	if weeks == 0 {
+		weeks = dto.DefaultForecastWeeks
+	}
+
+	ctrls, err := uc.repo.GetAllCtrlsByUserID(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Now()
+	days := 7 * weeks
+	from := to.AddDate(0, 0, -days)
+	// starts counts the jobs started in each hour of each of the past days, by pool
+	starts := make(map[string]*[24][]int)
+	for _, ctrl := range ctrls {
+		for _, runner := range ctrl.Runners {
+			if runner.Job == nil || runner.Pool == "" {
+				continue
+			}
+			start := runner.Job.CreatedAt
+			if runner.Job.StartedAt != nil {
+				start = *runner.Job.StartedAt
+			}
+			if !inRange(start, from, to) {
+				continue
+			}
+
+			hours, ok := starts[runner.Pool]
+			if !ok {
+				hours = &[24][]int{}
+				for hour := range hours {
+					hours[hour] = make([]int, days)
+				}
+				starts[runner.Pool] = hours
+			}
+			day := min(int(start.Sub(from)/(24*time.Hour)), days-1)
+			hours[start.UTC().Hour()][day]++
+		}
+	}
+
+	rsp := &dto.ForecastResponse{
+		Weeks: weeks,
+		Pools: make([]*dto.PoolForecast, 0, len(starts)),
+	}
+	for pool, hours := range starts {
+		forecast := &dto.PoolForecast{
+			Pool:  pool,
+			Hours: make([]*dto.HourForecast, 0, len(hours)),
+		}
+		for hour, counts := range hours {
+			total := 0
+			for _, count := range counts {
+				total += count
+			}
+
+			recommended := countPercentile(counts, dto.ForecastPercentile)
+			if maxSize, ok := query.MaxSizes[pool]; ok {
+				recommended = min(recommended, maxSize)
+			}
+			forecast.Hours = append(forecast.Hours, &dto.HourForecast{
+				Hour:         hour,
+				ExpectedJobs: float64(total) / float64(days),
+				Recommended:  recommended,
+			})
+		}
+		rsp.Pools = append(rsp.Pools, forecast)
+	}
+	sort.Slice(rsp.Pools, func(i, j int) bool {
+		return rsp.Pools[i].Pool < rsp.Pools[j].Pool
+	})
+
+	return rsp, nil
+}
+
+// countPercentile returns the nearest-rank percentile of the counts.
+func countPercentile(counts []int, p float64) int {
+	sorted := append([]int(nil), counts...)
+	sort.Ints(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
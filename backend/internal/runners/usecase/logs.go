@@ -0,0 +1,145 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"net/url"
+	ctrlEntities "runner-manager-backend/internal/ctrls/entities"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/pkg/response"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLogLines = 100
+	MaxLogLines     = 10000
+
+	controllerRequestTimeout = 10 * time.Second
+
+	// AdminTokenAudience is the audience of the tokens of the admin API of the controllers.
+	AdminTokenAudience = "controller-admin"
+	adminTokenTTL      = time.Minute
+)
+
+type controllerLogsResponse struct {
+	Runner string `json:"runner"`
+	ARN    string `json:"arn"`
+	Lines  []struct {
+		Timestamp time.Time `json:"timestamp"`
+		Message   string    `json:"message"`
+	} `json:"lines"`
+}
+
+// GetRunnerLogs fetches the last lines of the runner logs from the admin API of its controller.
+// The stored task ARN and pool are forwarded, so the logs of runners the controller already forgot stay available.
+// The request is authenticated with a token signed with the admin key of the controller, so it does not carry
+// any credential of the user.
+func (uc *usecase) GetRunnerLogs(ctx context.Context, userID, runnerID string, lines int) (*dto.RunnerLogsResponse, error) {
+	ctrls, err := uc.repo.GetAllCtrlsByUserID(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ctrl := range ctrls {
+		for _, runner := range ctrl.Runners {
+			if runner.ID.Hex() != runnerID {
+				continue
+			}
+			if ctrl.AdminURL == "" {
+				return nil, response.NotFound(response.ErrNoAdminURL)
+			}
+			if ctrl.AdminKey == "" {
+				return nil, response.NotFound(response.ErrNoAdminKey)
+			}
+			if !ctrlEntities.AdminURLAllowed(ctrl.AdminURL, uc.cfg.App.IsDevelopment()) {
+				return nil, response.BadRequest(response.ErrInsecureAdminURL)
+			}
+
+			query := url.Values{
+				"lines": {strconv.Itoa(lines)},
+				"arn":   {runner.ARN},
+				"pool":  {runner.Pool},
+			}
+			u := fmt.Sprintf("%s/admin/runners/%s/logs?%s", strings.TrimRight(ctrl.AdminURL, "/"), url.PathEscape(runner.Name), query.Encode())
+
+			token, err := adminToken(ctrl)
+			if err != nil {
+				return nil, response.InternalServerError(err)
+			}
+
+			ctrlLogs, err := fetchControllerLogs(ctx, u, token)
+			if err != nil {
+				return nil, err
+			}
+
+			rsp := &dto.RunnerLogsResponse{
+				Id:    runnerID,
+				Name:  runner.Name,
+				ARN:   ctrlLogs.ARN,
+				Lines: make([]*dto.RunnerLogLine, 0, len(ctrlLogs.Lines)),
+			}
+			for _, line := range ctrlLogs.Lines {
+				rsp.Lines = append(rsp.Lines, &dto.RunnerLogLine{
+					Timestamp: line.Timestamp.Format(time.RFC3339Nano),
+					Message:   line.Message,
+				})
+			}
+			return rsp, nil
+		}
+	}
+
+	return nil, response.NotFound(response.ErrRunnerNotFound)
+}
+
+// adminToken signs a short-lived token for the admin API of the controller, which only the controller
+// it was issued for accepts.
+func adminToken(ctrl *ctrlEntities.RunnerController) (string, error) {
+	now := time.Now()
+	claims := jwt.StandardClaims{
+		Subject:   ctrl.ID.Hex(),
+		Audience:  AdminTokenAudience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(adminTokenTTL).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ctrl.AdminKey))
+}
+
+func fetchControllerLogs(ctx context.Context, u, token string) (*controllerLogsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, controllerRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, response.InternalServerError(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, response.GatewayTimeout(err)
+		}
+		return nil, response.BadGateway(err)
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, response.NotFound(errors.New("runner logs not found"))
+	default:
+		return nil, response.BadGateway(fmt.Errorf("controller responded with status %d", rsp.StatusCode))
+	}
+
+	var logs controllerLogsResponse
+	if err = json.NewDecoder(rsp.Body).Decode(&logs); err != nil {
+		return nil, response.BadGateway(err)
+	}
+	return &logs, nil
+}
@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"runner-manager-backend/internal/config"
+	ctrlEntities "runner-manager-backend/internal/ctrls/entities"
+	"runner-manager-backend/internal/runners"
+	"runner-manager-backend/internal/runners/entities"
+	"runner-manager-backend/pkg/response"
+)
+
+const testAdminKey = "8f2d6c1e0b9a47f3a5d2e6c4b1f0a9d38e7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a"
+
+type fakeRepository struct {
+	runners.Repository
+	ctrls []*ctrlEntities.RunnerController
+}
+
+func (f *fakeRepository) GetAllCtrlsByUserID(ctx context.Context, userID string, archived bool) ([]*ctrlEntities.RunnerController, error) {
+	return f.ctrls, nil
+}
+
+// testController serves the logs of the admin API of a controller, for the tokens it would accept.
+func testController(t *testing.T, ctrlID primitive.ObjectID) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims := &jwt.StandardClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+			return []byte(testAdminKey), nil
+		})
+		if err != nil || !token.Valid || claims.Subject != ctrlID.Hex() || !claims.VerifyAudience(AdminTokenAudience, true) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Api-Key") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"runner": "runner-1",
+			"arn":    r.URL.Query().Get("arn"),
+			"lines":  []map[string]string{{"timestamp": "2026-10-19T12:00:00Z", "message": "Listening for Jobs"}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newLogsTest(environment string, ctrl *ctrlEntities.RunnerController) *usecase {
+	cfg := config.Config{App: config.AppConfig{Environment: environment}}
+	return &usecase{repo: &fakeRepository{ctrls: []*ctrlEntities.RunnerController{ctrl}}, cfg: cfg}
+}
+
+func TestGetRunnerLogs(t *testing.T) {
+	runner := &entities.Runner{ID: primitive.NewObjectID(), Name: "runner-1", ARN: "arn:task", Pool: "default"}
+	ctrl := &ctrlEntities.RunnerController{ID: primitive.NewObjectID(), AdminKey: testAdminKey, Runners: []*entities.Runner{runner}}
+	ctrl.AdminURL = testController(t, ctrl.ID).URL
+
+	rsp, err := newLogsTest("development", ctrl).GetRunnerLogs(context.Background(), "user", runner.ID.Hex(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.ARN != "arn:task" || len(rsp.Lines) != 1 || rsp.Lines[0].Message != "Listening for Jobs" {
+		t.Fatalf("unexpected logs: %+v", rsp)
+	}
+
+	// The token of a controller is refused by the others
+	other := *ctrl
+	other.ID = primitive.NewObjectID()
+	other.AdminURL = testController(t, primitive.NewObjectID()).URL
+	if _, err := newLogsTest("development", &other).GetRunnerLogs(context.Background(), "user", runner.ID.Hex(), 10); err == nil {
+		t.Fatal("token accepted by another controller")
+	}
+}
+
+func TestGetRunnerLogsRejected(t *testing.T) {
+	runner := &entities.Runner{ID: primitive.NewObjectID(), Name: "runner-1"}
+	tests := map[string]struct {
+		environment string
+		adminURL    string
+		adminKey    string
+		want        error
+	}{
+		"plain http in production": {"production", "http://ctrl.example.com", testAdminKey, response.ErrInsecureAdminURL},
+		"plain http in staging":    {"staging", "http://ctrl.example.com", testAdminKey, response.ErrInsecureAdminURL},
+		"no admin key":             {"production", "https://ctrl.example.com", "", response.ErrNoAdminKey},
+		"no admin url":             {"production", "", testAdminKey, response.ErrNoAdminURL},
+	}
+
+	for name, tt := range tests {
+		ctrl := &ctrlEntities.RunnerController{ID: primitive.NewObjectID(), AdminURL: tt.adminURL, AdminKey: tt.adminKey, Runners: []*entities.Runner{runner}}
+		_, err := newLogsTest(tt.environment, ctrl).GetRunnerLogs(context.Background(), "user", runner.ID.Hex(), 10)
+		if err == nil || !response.Equals(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package usecase
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"runner-manager-backend/internal/infrastructure/logs"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/internal/runners/entities"
+	"time"
+)
+
+const (
+	// Ranges up to these sizes are served from raw points and 1-minute rollups, larger ones from 1-hour rollups.
+	maxRawRange    = 6 * time.Hour
+	maxMinuteRange = 7 * 24 * time.Hour
+)
+
+// newMetrics converts a scraped point sent by the controller, dropping the values that are not numbers.
+func newMetrics(runnerID primitive.ObjectID, metric map[string]interface{}) *entities.Metrics {
+	timestamp, ok := metric["timestamp"].(float64)
+	if !ok {
+		return nil
+	}
+
+	values := make(map[string]float64, len(metric))
+	for k, v := range metric {
+		if value, ok := v.(float64); ok && k != "timestamp" {
+			values[k] = value
+		}
+	}
+
+	return &entities.Metrics{
+		Timestamp: time.Unix(int64(timestamp), 0),
+		Metadata:  entities.MetricsMetadata{RunnerID: runnerID},
+		Values:    values,
+	}
+}
+
+// GetRunnerMetrics returns the metrics series of a runner of the user.
+func (uc *usecase) GetRunnerMetrics(ctx context.Context, userID, runnerID string, query *dto.MetricsQuery) (*dto.MetricsResponse, error) {
+	runner, err := uc.repo.GetRunnerByID(ctx, userID, runnerID)
+	if err != nil {
+		return nil, err
+	}
+	return uc.queryMetrics(ctx, []*entities.Runner{runner}, query)
+}
+
+// GetCtrlMetrics returns the metrics series of all the runners of a controller of the user.
+func (uc *usecase) GetCtrlMetrics(ctx context.Context, userID, ctrlID string, query *dto.MetricsQuery) (*dto.MetricsResponse, error) {
+	ctrlRunners, err := uc.repo.GetRunnersByCtrlID(ctx, userID, ctrlID)
+	if err != nil {
+		return nil, err
+	}
+	return uc.queryMetrics(ctx, ctrlRunners, query)
+}
+
+// queryMetrics aggregates the metrics of the runners over steps aligned on the Unix epoch, so the
+// series of consecutive ranges line up. Only complete steps are returned: the range ends at the
+// start of the step in progress, which is where the next incremental query resumes.
+func (uc *usecase) queryMetrics(ctx context.Context, queryRunners []*entities.Runner, query *dto.MetricsQuery) (*dto.MetricsResponse, error) {
+	res := uc.resolutionFor(query.From, query.To)
+
+	step := query.Interval()
+	if step == 0 {
+		step = autoStep(query.To.Sub(query.From))
+	}
+	step = max(step, res.Step())
+
+	from := alignTime(query.From, step)
+	to := alignTime(query.To, step)
+
+	rsp := &dto.MetricsResponse{
+		From:        from.UTC().Format(time.RFC3339),
+		To:          to.UTC().Format(time.RFC3339),
+		StepSeconds: step.Seconds(),
+		Resolution:  string(res),
+		Timestamps:  make([]int64, 0, int(to.Sub(from)/step)),
+		Runners:     make([]*dto.RunnerMetricsSeries, 0, len(queryRunners)),
+	}
+	for t := from; t.Before(to); t = t.Add(step) {
+		rsp.Timestamps = append(rsp.Timestamps, t.Unix())
+	}
+
+	runnerIDs := make([]primitive.ObjectID, 0, len(queryRunners))
+	series := make(map[primitive.ObjectID]*dto.RunnerMetricsSeries, len(queryRunners))
+	for _, runner := range queryRunners {
+		runnerIDs = append(runnerIDs, runner.ID)
+		series[runner.ID] = &dto.RunnerMetricsSeries{
+			Id:     runner.ID.Hex(),
+			Name:   runner.Name,
+			Series: make(map[string][]*float64),
+		}
+		rsp.Runners = append(rsp.Runners, series[runner.ID])
+	}
+
+	if len(rsp.Timestamps) == 0 || len(runnerIDs) == 0 {
+		return rsp, nil
+	}
+
+	buckets, err := uc.repo.AggregateMetrics(ctx, res, runnerIDs, from, to, step, query.FieldList())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bucket := range buckets {
+		s, ok := series[bucket.RunnerID]
+		if !ok {
+			continue
+		}
+		i := int(bucket.Timestamp.Sub(from) / step)
+		if i < 0 || i >= len(rsp.Timestamps) {
+			continue
+		}
+
+		values, ok := s.Series[bucket.Field]
+		if !ok {
+			values = make([]*float64, len(rsp.Timestamps))
+			s.Series[bucket.Field] = values
+		}
+		value := bucket.Value
+		values[i] = &value
+	}
+
+	return rsp, nil
+}
+
+// autoStep spreads the range over about DefaultMetricsPoints points, in whole seconds.
+func autoStep(rng time.Duration) time.Duration {
+	step := (rng / dto.DefaultMetricsPoints).Round(time.Second)
+	return max(step, dto.MinMetricsStep)
+}
+
+// alignTime rounds t down to a multiple of step since the Unix epoch.
+func alignTime(t time.Time, step time.Duration) time.Time {
+	ms := t.UnixMilli()
+	return time.UnixMilli(ms - ms%step.Milliseconds()).UTC()
+}
+
+// resolutionFor picks the coarsest resolution that still gives a useful number of points for the range,
+// falling back to the rollups once the raw points of the range have expired.
+func (uc *usecase) resolutionFor(from, to time.Time) entities.Resolution {
+	switch rng := to.Sub(from); {
+	case rng > maxMinuteRange || time.Since(from) > uc.cfg.Metrics.MinuteRetention:
+		return entities.ResolutionHour
+	case rng > maxRawRange || time.Since(from) > uc.cfg.Metrics.RawRetention:
+		return entities.ResolutionMinute
+	default:
+		return entities.ResolutionRaw
+	}
+}
+
+// RollupMetrics aggregates the raw points into the 1-minute and 1-hour rollups of the buckets saved to since
+// they were last rolled up, once they are over. A bucket that receives late points is rolled up again.
+func (uc *usecase) RollupMetrics(ctx context.Context) error {
+	now := time.Now().UTC()
+	for _, res := range []entities.Resolution{entities.ResolutionMinute, entities.ResolutionHour} {
+		step := res.Step()
+
+		pending, err := uc.repo.GetPendingRollups(ctx, res, now.Truncate(step))
+		if err != nil {
+			return err
+		}
+
+		// The raw points of the buckets past the raw retention are partly gone, so their rollups are kept as is
+		expired := now.Add(-uc.cfg.Metrics.RawRetention)
+		buckets := make(map[time.Time][]primitive.ObjectID)
+		for _, p := range pending {
+			if p.ID.Bucket.Before(expired) {
+				continue
+			}
+			buckets[p.ID.Bucket] = append(buckets[p.ID.Bucket], p.ID.RunnerID)
+		}
+
+		total := 0
+		for bucket, runnerIDs := range buckets {
+			n, err := uc.repo.RollupMetrics(ctx, res, runnerIDs, bucket, bucket.Add(step))
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+
+		if err = uc.repo.DeletePendingRollups(ctx, pending); err != nil {
+			return err
+		}
+		if total > 0 {
+			logs.InfoF("Rolled up %d %s metrics in %d buckets", total, res, len(buckets))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/internal/runners/entities"
+	"runner-manager-backend/pkg/response"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels of the series exposed through the Prometheus HTTP API. The stored metric names are the
+// __name__ of the series, and the runner and its controller are labels.
+const (
+	promLabelName       = "__name__"
+	promLabelRunner     = "runner"
+	promLabelRunnerID   = "runner_id"
+	promLabelController = "controller"
+	promLabelCtrlID     = "ctrl_id"
+	promLabelPool       = "pool"
+)
+
+// labelMatcher is a matcher of a series selector such as {runner=~"web-.*"}.
+type labelMatcher struct {
+	name  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (m *labelMatcher) matches(value string) bool {
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// runnerSeries is a runner along with its labels.
+type runnerSeries struct {
+	id     primitive.ObjectID
+	labels map[string]string
+}
+
+// QueryRange evaluates a series selector over a time range, the only kind of PromQL expression supported.
+// Each point is the average of the values reported in the step starting at its timestamp.
+func (uc *usecase) QueryRange(ctx context.Context, userID string, query *dto.PromQueryRangeQuery) (*dto.PromMatrix, error) {
+	matchers, err := parseSelector(query.Query)
+	if err != nil {
+		return nil, response.BadRequest(err)
+	}
+
+	userRunners, err := uc.matchRunners(ctx, userID, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &dto.PromMatrix{ResultType: dto.PromResultMatrix, Result: make([]*dto.PromSeries, 0)}
+	if len(userRunners) == 0 {
+		return rsp, nil
+	}
+
+	// The rollups have no points between their steps, so the step is at least theirs.
+	res := uc.resolutionFor(query.StartTime, query.EndTime)
+	step := max(query.Interval, res.Step())
+
+	var fields []string
+	for _, m := range matchers {
+		if m.name == promLabelName && m.op == "=" {
+			fields = []string{m.value}
+		}
+	}
+
+	runnerIDs := make([]primitive.ObjectID, 0, len(userRunners))
+	for _, runner := range userRunners {
+		runnerIDs = append(runnerIDs, runner.id)
+	}
+
+	buckets, err := uc.repo.AggregateMetrics(ctx, res, runnerIDs, query.StartTime, query.EndTime.Add(step), step, fields)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Timestamp.Before(buckets[j].Timestamp)
+	})
+
+	labels := make(map[primitive.ObjectID]map[string]string, len(userRunners))
+	for _, runner := range userRunners {
+		labels[runner.id] = runner.labels
+	}
+
+	series := make(map[entities.MetricsSeries]*dto.PromSeries)
+	for _, bucket := range buckets {
+		key := entities.MetricsSeries{RunnerID: bucket.RunnerID, Field: bucket.Field}
+		s, ok := series[key]
+		if !ok {
+			metric := seriesLabels(labels[bucket.RunnerID], bucket.Field)
+			if !matchLabels(matchers, metric) {
+				continue
+			}
+			s = &dto.PromSeries{Metric: metric}
+			series[key] = s
+			rsp.Result = append(rsp.Result, s)
+		}
+		s.Values = append(s.Values, [2]interface{}{
+			promTime(bucket.Timestamp),
+			strconv.FormatFloat(bucket.Value, 'f', -1, 64),
+		})
+	}
+
+	return rsp, nil
+}
+
+// GetSeries returns the label sets of the series matching any of the selectors.
+func (uc *usecase) GetSeries(ctx context.Context, userID string, query *dto.PromSeriesQuery) ([]map[string]string, error) {
+	selectors := make([][]*labelMatcher, 0, len(query.Match))
+	for _, match := range query.Match {
+		matchers, err := parseSelector(match)
+		if err != nil {
+			return nil, response.BadRequest(err)
+		}
+		selectors = append(selectors, matchers)
+	}
+
+	userRunners, err := uc.matchRunners(ctx, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := make([]map[string]string, 0)
+	if len(userRunners) == 0 {
+		return rsp, nil
+	}
+
+	labels := make(map[primitive.ObjectID]map[string]string, len(userRunners))
+	runnerIDs := make([]primitive.ObjectID, 0, len(userRunners))
+	for _, runner := range userRunners {
+		labels[runner.id] = runner.labels
+		runnerIDs = append(runnerIDs, runner.id)
+	}
+
+	series, err := uc.repo.GetMetricsSeries(ctx, uc.resolutionFor(query.StartTime, query.EndTime), runnerIDs, query.StartTime, query.EndTime)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range series {
+		metric := seriesLabels(labels[s.RunnerID], s.Field)
+		for _, matchers := range selectors {
+			if matchLabels(matchers, metric) {
+				rsp = append(rsp, metric)
+				break
+			}
+		}
+	}
+
+	sort.Slice(rsp, func(i, j int) bool {
+		if rsp[i][promLabelName] != rsp[j][promLabelName] {
+			return rsp[i][promLabelName] < rsp[j][promLabelName]
+		}
+		return rsp[i][promLabelRunnerID] < rsp[j][promLabelRunnerID]
+	})
+	return rsp, nil
+}
+
+// matchRunners returns the runners of the user whose labels match, ignoring the matchers of the metric name.
+func (uc *usecase) matchRunners(ctx context.Context, userID string, matchers []*labelMatcher) ([]*runnerSeries, error) {
+	ctrls, err := uc.repo.GetAllCtrlsByUserID(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*runnerSeries
+	for _, ctrl := range ctrls {
+		for _, runner := range ctrl.Runners {
+			labels := map[string]string{
+				promLabelRunner:     runner.Name,
+				promLabelRunnerID:   runner.ID.Hex(),
+				promLabelController: ctrl.Name,
+				promLabelCtrlID:     ctrl.ID.Hex(),
+				promLabelPool:       runner.Pool,
+			}
+
+			ok := true
+			for _, m := range matchers {
+				if m.name != promLabelName && !m.matches(labels[m.name]) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				matched = append(matched, &runnerSeries{id: runner.ID, labels: labels})
+			}
+		}
+	}
+	return matched, nil
+}
+
+func matchLabels(matchers []*labelMatcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.matches(labels[m.name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesLabels returns the labels of the series stored under key for a runner with the given labels.
+func seriesLabels(labels map[string]string, key string) map[string]string {
+	name, keyLabels := entities.ParseSeriesKey(key)
+
+	metric := make(map[string]string, len(labels)+len(keyLabels)+1)
+	for k, v := range keyLabels {
+		metric[k] = v
+	}
+	for k, v := range labels {
+		metric[k] = v
+	}
+	metric[promLabelName] = name
+	return metric
+}
+
+// parseSelector parses a series selector: a metric name, label matchers in braces, or both.
+func parseSelector(selector string) ([]*labelMatcher, error) {
+	selector = strings.TrimSpace(selector)
+
+	name := selector
+	var body string
+	if i := strings.IndexByte(selector, '{'); i >= 0 {
+		if !strings.HasSuffix(selector, "}") {
+			return nil, fmt.Errorf("unclosed selector %q", selector)
+		}
+		name = strings.TrimSpace(selector[:i])
+		body = selector[i+1 : len(selector)-1]
+	}
+
+	var matchers []*labelMatcher
+	if name != "" {
+		if !isLabelName(name, true) {
+			return nil, fmt.Errorf("only series selectors are supported, got %q", selector)
+		}
+		matchers = append(matchers, &labelMatcher{name: promLabelName, op: "=", value: name})
+	}
+
+	for body = strings.TrimSpace(body); body != ""; {
+		m, rest, err := parseMatcher(body)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+
+		body = strings.TrimSpace(rest)
+		if body == "" {
+			break
+		}
+		if body[0] != ',' {
+			return nil, fmt.Errorf("expected , in selector %q", selector)
+		}
+		body = strings.TrimSpace(body[1:])
+	}
+
+	if len(matchers) == 0 {
+		return nil, errors.New("selector must contain at least one matcher")
+	}
+	return matchers, nil
+}
+
+// parseMatcher parses the label matcher at the start of s and returns the rest of s.
+func parseMatcher(s string) (*labelMatcher, string, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return nil, "", fmt.Errorf("invalid label matcher %q", s)
+	}
+
+	m := &labelMatcher{name: strings.TrimSpace(s[:i])}
+	if !isLabelName(m.name, false) {
+		return nil, "", fmt.Errorf("invalid label name %q", m.name)
+	}
+
+	s = s[i:]
+	for _, op := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(s, op) {
+			m.op = op
+			break
+		}
+	}
+	if m.op == "" {
+		return nil, "", fmt.Errorf("invalid operator in %q", s)
+	}
+	s = strings.TrimSpace(s[len(m.op):])
+
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid label value in %q", s)
+	}
+	if m.value, err = strconv.Unquote(quoted); err != nil {
+		return nil, "", err
+	}
+
+	if m.op == "=~" || m.op == "!~" {
+		// Prometheus regular expressions are fully anchored.
+		if m.re, err = regexp.Compile("^(?:" + m.value + ")$"); err != nil {
+			return nil, "", err
+		}
+	}
+	return m, s[len(quoted):], nil
+}
+
+func isLabelName(name string, metric bool) bool {
+	for i, r := range name {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		case r == ':' && metric:
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// promTime formats a time as the Unix seconds of the Prometheus HTTP API.
+func promTime(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
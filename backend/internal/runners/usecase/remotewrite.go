@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"runner-manager-backend/internal/infrastructure/logs"
+	"runner-manager-backend/internal/runners/dto"
+	"runner-manager-backend/internal/runners/entities"
+	"runner-manager-backend/pkg/remotewrite"
+	"time"
+)
+
+// remoteWriteDroppedLabels identify the runner of a series or its scrape target, so they are not
+// part of the stored series key.
+var remoteWriteDroppedLabels = map[string]struct{}{
+	promLabelName:       {},
+	promLabelRunner:     {},
+	promLabelRunnerID:   {},
+	promLabelController: {},
+	promLabelCtrlID:     {},
+	promLabelPool:       {},
+	"job":               {},
+	"instance":          {},
+}
+
+// RemoteWrite stores the samples of a remote-write request. Series are mapped to the runners of the
+// user by their runner_id label, or else by their runner label, and restricted to the runners of
+// the controller when ctrlID is set. Series of unknown runners and non-finite samples, such as the
+// staleness markers, are dropped.
+func (uc *usecase) RemoteWrite(ctx context.Context, userID, ctrlID string, req *remotewrite.WriteRequest) (*dto.RemoteWriteResponse, error) {
+	runnerIDs := make([]primitive.ObjectID, 0)
+	names := make([]string, 0)
+	for _, ts := range req.Timeseries {
+		if id, err := primitive.ObjectIDFromHex(ts.Get(promLabelRunnerID)); err == nil {
+			runnerIDs = append(runnerIDs, id)
+		} else if name := ts.Get(promLabelRunner); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	rsp := &dto.RemoteWriteResponse{}
+	if len(runnerIDs) == 0 && len(names) == 0 {
+		rsp.DroppedSeries = len(req.Timeseries)
+		return rsp, nil
+	}
+
+	found, err := uc.repo.FindRunners(ctx, userID, ctrlID, runnerIDs, names)
+	if err != nil {
+		return nil, err
+	}
+
+	// Runners are sorted oldest first, so a name reused by another controller maps to the latest runner.
+	byID := make(map[string]primitive.ObjectID, len(found))
+	byName := make(map[string]primitive.ObjectID, len(found))
+	for _, runner := range found {
+		byID[runner.ID.Hex()] = runner.ID
+		byName[runner.Name] = runner.ID
+	}
+
+	type point struct {
+		runnerID  primitive.ObjectID
+		timestamp int64
+	}
+	points := make(map[point]*entities.Metrics)
+	var metrics []*entities.Metrics
+
+	for _, ts := range req.Timeseries {
+		runnerID, ok := byID[ts.Get(promLabelRunnerID)]
+		if !ok {
+			runnerID, ok = byName[ts.Get(promLabelRunner)]
+		}
+		name := ts.Get(promLabelName)
+		if !ok || name == "" {
+			rsp.DroppedSeries++
+			continue
+		}
+
+		labels := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if _, drop := remoteWriteDroppedLabels[l.Name]; !drop {
+				labels[l.Name] = l.Value
+			}
+		}
+		key := entities.SeriesKey(name, labels)
+
+		for _, sample := range ts.Samples {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				rsp.DroppedSamples++
+				continue
+			}
+
+			p := point{runnerID, sample.Timestamp}
+			m, ok := points[p]
+			if !ok {
+				m = &entities.Metrics{
+					Timestamp: time.UnixMilli(sample.Timestamp),
+					Metadata:  entities.MetricsMetadata{RunnerID: runnerID},
+					Values:    make(map[string]float64),
+				}
+				points[p] = m
+				metrics = append(metrics, m)
+			}
+			m.Values[key] = sample.Value
+			rsp.Samples++
+		}
+	}
+
+	if err = uc.repo.SaveMetrics(ctx, metrics); err != nil {
+		return nil, err
+	}
+
+	if rsp.DroppedSeries > 0 {
+		logs.InfoF("Dropped %d remote-write series of user %s without a known runner", rsp.DroppedSeries, userID)
+	}
+	return rsp, nil
+}
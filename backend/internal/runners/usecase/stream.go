@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"context"
+	"github.com/golang-jwt/jwt"
+	"runner-manager-backend/internal/middleware"
+	"runner-manager-backend/internal/runners/dto"
+	"time"
+)
+
+// StreamTokenTTL is the lifetime of the tokens of the event stream. They are sent in the query
+// string, where they may be logged, so they only live long enough to open the stream. The stream
+// sends fresh ones to reconnect with.
+const StreamTokenTTL = time.Minute
+
+// NewStreamToken issues a short-lived token of the user to open the event stream with. Its audience
+// keeps it from being accepted by any other route.
+func (uc *usecase) NewStreamToken(ctx context.Context, data *middleware.Data) (*dto.StreamTokenResponse, error) {
+	claims := middleware.PayloadToken{
+		Data: &middleware.Data{
+			UserID: data.UserID,
+			Email:  data.Email,
+		},
+		StandardClaims: jwt.StandardClaims{
+			Audience:  middleware.StreamAudience,
+			ExpiresAt: time.Now().Add(StreamTokenTTL).Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(uc.cfg.JWT.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.StreamTokenResponse{AccessToken: tokenString, ExpiredAt: int64(StreamTokenTTL.Seconds())}, nil
+}
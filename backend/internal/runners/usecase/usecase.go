@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"runner-manager-backend/internal/config"
+	ctrlEntities "runner-manager-backend/internal/ctrls/entities"
 	"runner-manager-backend/internal/runners"
 	"runner-manager-backend/internal/runners/dto"
 	"runner-manager-backend/internal/runners/entities"
@@ -21,19 +22,24 @@ func NewUseCase(usersRepo users.Repository, repo runners.Repository, cfg config.
 	return &usecase{usersRepo, repo, cfg}
 }
 
-func (uc *usecase) UpdateRunners(ctx context.Context, userID, ctrlID string, payload *dto.UpdateRunnersRequest) ([]*dto.RunnerControllerWSResponse, error) {
+func (uc *usecase) UpdateRunners(ctx context.Context, userID, ctrlID string, payload *dto.UpdateRunnersRequest) error {
 	r := make([]*entities.Runner, 0, len(payload.Runners))
 	for _, runner := range payload.Runners {
 		r = append(r, entities.NewRunner(&runner))
 	}
 
+	// Every push is a heartbeat, even without runners.
+	if err := uc.repo.SeenCtrl(ctx, userID, ctrlID); err != nil {
+		return err
+	}
+
 	if len(payload.Runners) == 0 {
-		return []*dto.RunnerControllerWSResponse{}, nil
+		return nil
 	}
 
-	ctrls, runnerMap, err := uc.repo.UpdateRunners(ctx, userID, ctrlID, r)
+	runnerMap, err := uc.repo.UpdateRunners(ctx, userID, ctrlID, r)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for _, runner := range payload.Runners {
@@ -41,45 +47,22 @@ func (uc *usecase) UpdateRunners(ctx context.Context, userID, ctrlID string, pay
 
 		runnerID := runnerMap[runner.Name].ID
 		for _, metric := range runner.Metrics {
-			if timestamp, ok := metric["timestamp"]; ok {
-				delete(metric, "timestamp")
-				metric["runner_id"] = runnerID
-				metrics = append(metrics, &entities.Metrics{
-					Timestamp: time.Unix(int64(timestamp.(float64)), 0),
-					Metadata:  metric,
-				})
+			if m := newMetrics(runnerID, metric); m != nil {
+				metrics = append(metrics, m)
 			}
 		}
 
 		err = uc.repo.SaveMetrics(ctx, metrics)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	rsp := make([]*dto.RunnerControllerWSResponse, 0, len(ctrls))
-	for _, ctrl := range ctrls {
-		runnersWSResponse := make([]*dto.RunnerWSResponse, 0, len(ctrl.Runners))
-		for _, runner := range ctrl.Runners {
-			runnersWSResponse = append(runnersWSResponse, &dto.RunnerWSResponse{
-				Id:          runner.ID.Hex(),
-				Name:        runner.Name,
-				PrivateIPv4: runner.PrivateIPv4,
-				Status:      runner.Status,
-			})
-		}
-		rsp = append(rsp, &dto.RunnerControllerWSResponse{
-			Id:                ctrl.ID.Hex(),
-			Name:              ctrl.Name,
-			RunnersWSResponse: runnersWSResponse,
-		})
-	}
-
-	return rsp, nil
+	return nil
 }
 
 func (uc *usecase) GetAllCtrlsByUserID(ctx context.Context, userID string) ([]*dto.RunnerControllerWSResponse, error) {
-	ctrls, err := uc.repo.GetAllCtrlsByUserID(ctx, userID)
+	ctrls, err := uc.repo.GetAllCtrlsByUserID(ctx, userID, false)
 	if err != nil {
 		return nil, err
 	}
@@ -91,42 +74,57 @@ func (uc *usecase) GetAllCtrlsByUserID(ctx context.Context, userID string) ([]*d
 			runnersWSResponse = append(runnersWSResponse, &dto.RunnerWSResponse{
 				Id:          runner.ID.Hex(),
 				Name:        runner.Name,
+				Pool:        runner.Pool,
+				Labels:      runner.Labels,
+				ARN:         runner.ARN,
 				PrivateIPv4: runner.PrivateIPv4,
 				Status:      runner.Status,
+				StopReason:  runner.StopReason,
+				Job:         newJobResponse(runner.Job),
 			})
 		}
-		rsp = append(rsp, &dto.RunnerControllerWSResponse{
-			Id:                ctrl.ID.Hex(),
-			Name:              ctrl.Name,
-			RunnersWSResponse: runnersWSResponse,
-		})
+		rsp = append(rsp, newCtrlWSResponse(ctrl, runnersWSResponse))
 	}
 	return rsp, nil
 }
 
-func (uc *usecase) GetAllMetricsByCtrlID(ctx context.Context, userID, ctrlID string) (*dto.MetricsCtrlWSResponse, error) {
-	metrics, err := uc.repo.GetAllMetricsByCtrlID(ctx, userID, ctrlID)
-	if err != nil {
-		return nil, err
+func newCtrlWSResponse(ctrl *ctrlEntities.RunnerController, runners []*dto.RunnerWSResponse) *dto.RunnerControllerWSResponse {
+	rsp := &dto.RunnerControllerWSResponse{
+		Id:                ctrl.ID.Hex(),
+		Name:              ctrl.Name,
+		Version:           ctrl.Version,
+		Status:            ctrl.CurrentStatus(),
+		RunnersWSResponse: runners,
 	}
-
-	r := make([]*dto.MetricsRunnerWSResponse, 0, 1)
-	for runnerName, m := range metrics {
-		runnerMetrics := make([]*dto.MetricsWSResponse, 0, len(m))
-		for _, metric := range m {
-			runnerMetrics = append(runnerMetrics, &dto.MetricsWSResponse{
-				Timestamp: metric.Timestamp.Format(time.RFC3339),
-				Metadata:  metric.Metadata,
-			})
-		}
-		r = append(r, &dto.MetricsRunnerWSResponse{
-			Name:          runnerName,
-			RunnerMetrics: runnerMetrics,
-		})
+	if !ctrl.LastSeenAt.IsZero() {
+		rsp.LastSeenAt = &ctrl.LastSeenAt
 	}
-	res := &dto.MetricsCtrlWSResponse{
-		RunnerMetrics: r,
+	return rsp
+}
+
+func newJobResponse(job *entities.Job) *dto.JobResponse {
+	if job == nil {
+		return nil
 	}
 
-	return res, nil
+	rsp := &dto.JobResponse{
+		ID:               job.ID,
+		RunID:            job.RunID,
+		Name:             job.Name,
+		WorkflowName:     job.WorkflowName,
+		Repository:       job.Repository,
+		HeadBranch:       job.HeadBranch,
+		HeadSHA:          job.HeadSHA,
+		Conclusion:       job.Conclusion,
+		CreatedAt:        job.CreatedAt.Format(time.RFC3339),
+		QueueWaitSeconds: job.QueueWait().Seconds(),
+		DurationSeconds:  job.Duration().Seconds(),
+	}
+	if job.StartedAt != nil {
+		rsp.StartedAt = job.StartedAt.Format(time.RFC3339)
+	}
+	if job.CompletedAt != nil {
+		rsp.CompletedAt = job.CompletedAt.Format(time.RFC3339)
+	}
+	return rsp
 }
@@ -2,7 +2,6 @@ package entities
 
 import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"runner-manager-backend/internal/ctrls/entities"
 	"runner-manager-backend/internal/users/dto"
 	"time"
 )
@@ -15,16 +14,13 @@ type User struct {
 	ApiKey    string             `bson:"api_key"`
 	CreatedAt time.Time          `bson:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at"`
-
-	RunnerController []*entities.RunnerController `bson:"ctrls"`
 }
 
 func NewUser(data *dto.CreateUserRequest) *User {
 	return &User{
-		Username:         data.Username,
-		Email:            data.Email,
-		Password:         data.Password,
-		RunnerController: make([]*entities.RunnerController, 0),
-		CreatedAt:        time.Now(),
+		Username:  data.Username,
+		Email:     data.Email,
+		Password:  data.Password,
+		CreatedAt: time.Now(),
 	}
 }
@@ -10,3 +10,42 @@ const (
 	RunnerStatusFinished   RunnerStatus = "finished"
 	RunnerStatusTerminated RunnerStatus = "terminated"
 )
+
+// CtrlStatus is online while the controller pushes its runners or heartbeats, offline after it stopped.
+// Archived and deleted controllers are only reported as such in the API and the WebSocket events.
+type CtrlStatus string
+
+const (
+	CtrlStatusOnline   CtrlStatus = "online"
+	CtrlStatusOffline  CtrlStatus = "offline"
+	CtrlStatusArchived CtrlStatus = "archived"
+	CtrlStatusDeleted  CtrlStatus = "deleted"
+)
+
+type RunnerEventType string
+
+const (
+	RunnerEventWebhookReceived RunnerEventType = "webhook_received"
+	RunnerEventLaunched        RunnerEventType = "runner_launched"
+	RunnerEventLaunchRetried   RunnerEventType = "launch_retried"
+	RunnerEventLaunchFailed    RunnerEventType = "launch_failed"
+	RunnerEventStatusChanged   RunnerEventType = "status_changed"
+	RunnerEventTaskStopped     RunnerEventType = "task_stopped"
+	RunnerEventSpotInterrupted RunnerEventType = "spot_interrupted"
+	RunnerEventStuck           RunnerEventType = "stuck"
+	RunnerEventDeleted         RunnerEventType = "runner_deleted"
+	RunnerEventWarmClaimed     RunnerEventType = "warm_claimed"
+)
+
+var RunnerEventTypes = []interface{}{
+	RunnerEventWebhookReceived,
+	RunnerEventLaunched,
+	RunnerEventLaunchRetried,
+	RunnerEventLaunchFailed,
+	RunnerEventStatusChanged,
+	RunnerEventTaskStopped,
+	RunnerEventSpotInterrupted,
+	RunnerEventStuck,
+	RunnerEventDeleted,
+	RunnerEventWarmClaimed,
+}
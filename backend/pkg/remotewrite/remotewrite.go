@@ -0,0 +1,191 @@
+// Package remotewrite decodes the requests of the Prometheus remote-write protocol (version 1):
+// a snappy-compressed prometheus.WriteRequest protobuf message.
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+)
+
+var (
+	// ErrUnsupportedVersion is returned for remote-write 2.0 requests, which use another message.
+	ErrUnsupportedVersion = errors.New("only remote-write 1.0 (prometheus.WriteRequest) is supported")
+	// ErrTooLarge is returned for requests that decompress to more than the maximum size.
+	ErrTooLarge = errors.New("decompressed remote-write request is too large")
+)
+
+// WriteRequest holds the time series of a request. Exemplars, histograms and metadata are skipped.
+type WriteRequest struct {
+	Timeseries []*TimeSeries
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value at a timestamp in milliseconds since the Unix epoch.
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// Get returns the value of the label, or "" when the series does not have it.
+func (ts *TimeSeries) Get(name string) string {
+	for _, l := range ts.Labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// Decode decompresses and unmarshals the body of a remote-write request. The decompressed size is read
+// from the snappy header and checked against maxSize before anything is allocated.
+func Decode(body []byte, maxSize int) (*WriteRequest, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if size > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrTooLarge, size, maxSize)
+	}
+
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+
+	req := &WriteRequest{}
+	err = parseMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		// timeseries = 1
+		if num != 1 {
+			return nil
+		}
+		ts, err := parseTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		req.Timeseries = append(req.Timeseries, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func parseTimeSeries(data []byte) (*TimeSeries, error) {
+	ts := &TimeSeries{}
+	err := parseMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch num {
+		// labels = 1
+		case 1:
+			l, err := parseLabel(value)
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		// samples = 2
+		case 2:
+			s, err := parseSample(value)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func parseLabel(data []byte) (Label, error) {
+	var l Label
+	err := parseMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch num {
+		// name = 1
+		case 1:
+			l.Name = string(value)
+		// value = 2
+		case 2:
+			l.Value = string(value)
+		}
+		return nil
+	})
+	return l, err
+}
+
+func parseSample(data []byte) (Sample, error) {
+	var s Sample
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return s, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		// value = 1
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.Value = math.Float64frombits(v)
+			data = data[n:]
+		// timestamp = 2
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.Timestamp = int64(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return s, nil
+}
+
+// parseMessage calls fn with the length-delimited fields of a message and skips the others.
+func parseMessage(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package remotewrite
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+// The fixtures are snappy-compressed prompb.WriteRequest messages, marshaled with
+// github.com/prometheus/prometheus/prompb v0.53.3 as Prometheus sends them:
+//   - write_request.bin holds a counter with two samples, a gauge with an exemplar and an infinite
+//     sample, a native histogram without samples, and the metadata of the counter.
+//   - empty.bin is an empty WriteRequest.
+
+const maxSize = 1 << 20
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestDecodeFixture(t *testing.T) {
+	req, err := Decode(readFixture(t, "write_request.bin"), maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &WriteRequest{Timeseries: []*TimeSeries{
+		{
+			Labels: []Label{
+				{Name: "__name__", Value: "ecs_cpu_seconds_total"},
+				{Name: "cpu", Value: "0"},
+				{Name: "runner", Value: "runner-1"},
+			},
+			Samples: []Sample{
+				{Value: 12.5, Timestamp: 1700000000000},
+				{Value: 13.25, Timestamp: 1700000015000},
+			},
+		},
+		{
+			Labels: []Label{
+				{Name: "__name__", Value: "ecs_memory_bytes"},
+				{Name: "runner_id", Value: "65f0c2a1b3d4e5f601234567"},
+			},
+			Samples: []Sample{
+				{Value: 524288000, Timestamp: 1700000000000},
+				{Value: math.Inf(1), Timestamp: 1700000015000},
+			},
+		},
+		{
+			Labels: []Label{
+				{Name: "__name__", Value: "job_duration_seconds"},
+				{Name: "runner", Value: "runner-1"},
+			},
+		},
+	}}
+	if !reflect.DeepEqual(req, want) {
+		t.Fatalf("got %+v, want %+v", req.Timeseries, want.Timeseries)
+	}
+
+	if got := req.Timeseries[1].Get("runner_id"); got != "65f0c2a1b3d4e5f601234567" {
+		t.Errorf("Get(runner_id) = %q", got)
+	}
+	if got := req.Timeseries[1].Get("runner"); got != "" {
+		t.Errorf("Get(runner) = %q, want empty", got)
+	}
+}
+
+func TestDecodeEmptyFixture(t *testing.T) {
+	req, err := Decode(readFixture(t, "empty.bin"), maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Timeseries) != 0 {
+		t.Fatalf("got %d series, want none", len(req.Timeseries))
+	}
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	fixture := readFixture(t, "write_request.bin")
+	size, err := snappy.DecodedLen(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decode(fixture, size); err != nil {
+		t.Errorf("request of the maximum size: %s", err)
+	}
+	if _, err := Decode(fixture, size-1); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("request over the maximum size: got %v, want ErrTooLarge", err)
+	}
+
+	// A header claiming 1 GiB is rejected before decompressing anything
+	bomb := binary.AppendUvarint(nil, 1<<30)
+	bomb = append(bomb, 0x00)
+	if _, err := Decode(bomb, maxSize); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("oversized header: got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	fixture := readFixture(t, "write_request.bin")
+	tests := map[string][]byte{
+		"not snappy":         {0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"truncated snappy":   fixture[:len(fixture)/2],
+		"truncated protobuf": snappy.Encode(nil, []byte{0x0a, 0x10, 0x0a}),
+	}
+
+	for name, body := range tests {
+		if _, err := Decode(body, maxSize); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
@@ -15,6 +15,11 @@ var (
 	ErrFailedGenerateJWT = errors.New("failed generate access token")
 	ErrInvalidIsActive   = errors.New("invalid is_active")
 	ErrStatusValue       = errors.New("status should be 0 or 1")
+	ErrRunnerNotFound    = errors.New("runner not found")
+	ErrCtrlNotFound      = errors.New("controller not found")
+	ErrNoAdminURL        = errors.New("controller has no admin url")
+	ErrNoAdminKey        = errors.New("controller has no admin key, it must be upgraded to serve logs")
+	ErrInsecureAdminURL  = errors.New("admin url must use https")
 
 	ErrFailedGetTokenInformation = errors.New("failed to get token information")
 )
@@ -88,3 +93,11 @@ func GatewayTimeout(err error) error {
 		Err:     err,
 	}
 }
+
+func BadGateway(err error) error {
+	return &AppError{
+		Code:    http.StatusBadGateway,
+		Message: "bad_gateway",
+		Err:     err,
+	}
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"log"
+	"os"
 	"runner-controller-ecs/internal/delivery"
 	"runner-controller-ecs/internal/delivery/http"
 	"runner-controller-ecs/internal/delivery/reconciler"
 	"runner-controller-ecs/internal/domain/model"
 	"runner-controller-ecs/internal/infrastructure/logs"
 	"runner-controller-ecs/internal/tools"
+	"runner-controller-ecs/internal/usecase"
 	"runner-controller-ecs/internal/usecase/aws"
 	"runner-controller-ecs/internal/usecase/broker"
 	"runner-controller-ecs/internal/usecase/credentials"
+	"runner-controller-ecs/internal/usecase/docker"
+	"runner-controller-ecs/internal/usecase/pools"
+	"runner-controller-ecs/internal/usecase/secrets"
 )
 
 func main() {
@@ -19,11 +25,29 @@ func main() {
 	webhookRequest := broker.NewBroker[model.WorkflowJobWebhook]()
 	go webhookRequest.Start()
 
-	credentialsUC := credentials.NewCredentialUC()
-	awsUC := aws.NewAWSUC(credentialsUC)
+	secretStoreUC, err := secrets.NewSecretStoreUC()
+	if err != nil {
+		log.Fatal(err)
+	}
+	credentialsUC := credentials.NewCredentialUC(secretStoreUC)
+	poolUC := pools.NewPoolUC()
 
-	r := reconciler.NewReconciler(awsUC, webhookRequest)
+	var providerUC usecase.IProviderUC
+	switch provider := os.Getenv("PROVIDER"); provider {
+	case "", "ecs":
+		// The fake ARNs of file secrets cannot be resolved by ECS when injecting them into the runners
+		if secrets.Provider() == secrets.ProviderFile {
+			log.Fatalf("Secrets provider %s is not supported with the ECS provider", secrets.ProviderFile)
+		}
+		providerUC = aws.NewAWSUC(credentialsUC, poolUC)
+	case "docker":
+		providerUC = docker.NewDockerUC(credentialsUC, poolUC)
+	default:
+		log.Fatalf("Unsupported runner provider %s", provider)
+	}
 
-	http.StartWebhookServer(webhookRequest)
+	r := reconciler.NewReconciler(providerUC, poolUC, credentialsUC, webhookRequest)
+
+	http.StartWebhookServer(webhookRequest, http.NewAdminHandlers(r, providerUC))
 	delivery.StartReconcileLoop(r)
 }
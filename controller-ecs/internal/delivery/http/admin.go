@@ -0,0 +1,115 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runner-controller-ecs/internal/delivery"
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/infrastructure/logs"
+	"runner-controller-ecs/internal/usecase"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// AdminAudience is the audience of the tokens the backend signs for the admin API.
+const AdminAudience = "controller-admin"
+
+// AdminHandlers serves the admin API used by the backend, authenticated with short-lived tokens
+// signed with the admin key the controller registered with.
+type AdminHandlers struct {
+	reconciler delivery.Reconciler
+	providerUC usecase.IProviderUC
+}
+
+func NewAdminHandlers(reconciler delivery.Reconciler, providerUC usecase.IProviderUC) *AdminHandlers {
+	return &AdminHandlers{
+		reconciler: reconciler,
+		providerUC: providerUC,
+	}
+}
+
+func (h *AdminHandlers) AdminRoutes(router *gin.RouterGroup) {
+	router.Use(h.TokenMiddleware())
+	router.GET("/runners/:name/logs", h.RunnerLogs)
+}
+
+// TokenMiddleware accepts the bearer tokens signed with the admin key, for the admin audience and
+// the ID of the controller, so that a token cannot be replayed against another controller.
+func (h *AdminHandlers) TokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctrlID, key, ok := h.reconciler.AdminKey()
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Controller not registered"})
+			return
+		}
+
+		tokenString, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+			return
+		}
+
+		claims := &jwt.StandardClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+			return []byte(key), nil
+		})
+		if err != nil || !token.Valid || claims.Subject != ctrlID ||
+			!claims.VerifyAudience(AdminAudience, true) || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RunnerLogs returns the last lines of the runner logs. Runners no longer tracked by the controller
+// can still be looked up with the task ARN and pool stored by the backend.
+func (h *AdminHandlers) RunnerLogs(c *gin.Context) {
+	name := c.Param("name")
+
+	lines := model.DefaultLogLines
+	if value := c.Query("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > model.MaxLogLines {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lines must be between 1 and " + strconv.Itoa(model.MaxLogLines)})
+			return
+		}
+		lines = n
+	}
+
+	runner, ok := h.reconciler.GetRunner(name)
+	if !ok {
+		if c.Query("arn") == "" || c.Query("pool") == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Runner not found"})
+			return
+		}
+		runner = &model.Runner{
+			Name: name,
+			ARN:  c.Query("arn"),
+			Pool: c.Query("pool"),
+		}
+	}
+
+	res, err := h.providerUC.RunnerLogs(runner, lines)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logs.Error(err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch runner logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runner": runner.Name, "arn": runner.ARN, "lines": res})
+}
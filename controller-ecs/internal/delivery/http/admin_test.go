@@ -0,0 +1,129 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runner-controller-ecs/internal/delivery"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	testCtrlID   = "65f0c2a1b3d4e5f600000002"
+	testAdminKey = "8f2d6c1e0b9a47f3a5d2e6c4b1f0a9d38e7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a"
+)
+
+type fakeReconciler struct {
+	delivery.Reconciler
+	registered bool
+}
+
+func (f *fakeReconciler) AdminKey() (string, string, bool) {
+	if !f.registered {
+		return "", "", false
+	}
+	return testCtrlID, testAdminKey, true
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.StandardClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestTokenMiddleware(t *testing.T) {
+	valid := jwt.StandardClaims{
+		Subject:   testCtrlID,
+		Audience:  AdminAudience,
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}
+	withClaims := func(update func(*jwt.StandardClaims)) jwt.StandardClaims {
+		claims := valid
+		update(&claims)
+		return claims
+	}
+
+	tests := map[string]struct {
+		registered bool
+		header     string
+		want       int
+	}{
+		"valid token": {
+			registered: true,
+			header:     "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testAdminKey), valid),
+			want:       http.StatusOK,
+		},
+		"not registered": {
+			header: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testAdminKey), valid),
+			want:   http.StatusServiceUnavailable,
+		},
+		"missing token": {
+			registered: true,
+			want:       http.StatusUnauthorized,
+		},
+		"api key": {
+			registered: true,
+			header:     testAdminKey,
+			want:       http.StatusUnauthorized,
+		},
+		"other key": {
+			registered: true,
+			header:     "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte("other"), valid),
+			want:       http.StatusUnauthorized,
+		},
+		"other controller": {
+			registered: true,
+			header: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testAdminKey),
+				withClaims(func(c *jwt.StandardClaims) { c.Subject = "65f0c2a1b3d4e5f600000003" })),
+			want: http.StatusUnauthorized,
+		},
+		"other audience": {
+			registered: true,
+			header: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testAdminKey),
+				withClaims(func(c *jwt.StandardClaims) { c.Audience = "stream" })),
+			want: http.StatusUnauthorized,
+		},
+		"expired": {
+			registered: true,
+			header: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testAdminKey),
+				withClaims(func(c *jwt.StandardClaims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() })),
+			want: http.StatusUnauthorized,
+		},
+		"no expiry": {
+			registered: true,
+			header: "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte(testAdminKey),
+				withClaims(func(c *jwt.StandardClaims) { c.ExpiresAt = 0 })),
+			want: http.StatusUnauthorized,
+		},
+		"unsigned": {
+			registered: true,
+			header:     "Bearer " + signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid),
+			want:       http.StatusUnauthorized,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for name, tt := range tests {
+		h := NewAdminHandlers(&fakeReconciler{registered: tt.registered}, nil)
+		router := gin.New()
+		router.GET("/admin", h.TokenMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", name, rec.Code, tt.want)
+		}
+	}
+}
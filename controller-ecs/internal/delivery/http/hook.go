@@ -37,7 +37,7 @@ func LoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
-func StartWebhookServer(broker *broker.Broker[model.WorkflowJobWebhook]) {
+func StartWebhookServer(broker *broker.Broker[model.WorkflowJobWebhook], admin *AdminHandlers) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 
@@ -58,6 +58,8 @@ func StartWebhookServer(broker *broker.Broker[model.WorkflowJobWebhook]) {
 		c.JSON(http.StatusOK, gin.H{"message": "Webhook received successfully"})
 	})
 
+	admin.AdminRoutes(router.Group("/admin"))
+
 	// Run the HTTP server in a Goroutine
 	go func() {
 		if err := router.Run(fmt.Sprintf(":%d", PORT)); err != nil {
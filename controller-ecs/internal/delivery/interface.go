@@ -13,6 +13,8 @@ type Reconciler interface {
 	Init() error
 	Reconcile(brokerChannel chan model.WorkflowJobWebhook) error
 	SubscribeBroker() chan model.WorkflowJobWebhook
+	GetRunner(name string) (*model.Runner, bool)
+	AdminKey() (ctrlID, key string, ok bool)
 }
 
 func StartReconcileLoop(r Reconciler) {
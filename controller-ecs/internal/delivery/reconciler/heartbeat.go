@@ -0,0 +1,30 @@
+package reconciler
+
+import (
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/tools"
+	"time"
+)
+
+// HeartbeatInterval is how often the controller reports that it is alive, along with its version,
+// on top of the runners it pushes.
+const HeartbeatInterval = 30 * time.Second
+
+// Heartbeat keeps the controller online on the backend and records its version, at most every HeartbeatInterval.
+func (c *Reconciler) Heartbeat() error {
+	if time.Since(c.heartbeatAt) < HeartbeatInterval {
+		return nil
+	}
+
+	creds, err := c.credentialsUC.GetCredentials()
+	if err != nil {
+		return err
+	}
+
+	err = c.postBackend(creds.BackendURL+"/api/ctrl/heartbeat", &model.HeartbeatRequest{Version: tools.Version()})
+	if err != nil {
+		return err
+	}
+	c.heartbeatAt = time.Now()
+	return nil
+}
@@ -0,0 +1,133 @@
+package reconciler
+
+import (
+	"errors"
+	"fmt"
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/infrastructure/logs"
+	"runner-controller-ecs/internal/tools"
+	"time"
+)
+
+// launchRunner registers a new runner of the pool with the given labels for the workflow job,
+// none for warm runners, and creates its task in the background. Must be called with c.mu held.
+// The runner is sent to the backend by the next SendRunners.
+func (c *Reconciler) launchRunner(pool string, labels []string, job model.Job) *model.Runner {
+	newRunner := &model.Runner{
+		Name:        "linux-" + tools.RandString(6),
+		Pool:        pool,
+		Labels:      labels,
+		Job:         job,
+		Status:      model.RunnerStatusCreating,
+		PrivateIPv4: "0.0.0.0",
+		Metrics:     map[string]float64{},
+		UpdatedAt:   time.Now(),
+	}
+	c.runners[newRunner.Name] = newRunner
+
+	go c.createRunner(*newRunner)
+	return newRunner
+}
+
+// createRunner creates the task of the runner, retrying with the backoff of the pool.
+// After a capacity error the next attempt uses the fallback placement of the pool.
+// Fatal errors and the last failed attempt mark the runner failed with the error as reason.
+func (c *Reconciler) createRunner(runner model.Runner) {
+	pool, err := c.poolUC.GetPool(runner.Pool)
+	if err != nil {
+		c.failLaunch(&runner, fmt.Errorf("%w: %w", domain.ErrFatal, err))
+		return
+	}
+
+	for {
+		created, err := c.providerUC.CreateRunner(&runner)
+		if err == nil {
+			c.launched(created)
+			return
+		}
+
+		runner.Attempts++
+		if errors.Is(err, domain.ErrFatal) || runner.Attempts >= pool.Retry.MaxAttempts {
+			c.failLaunch(&runner, err)
+			return
+		}
+		if errors.Is(err, domain.ErrCapacity) {
+			runner.Fallback = true
+		}
+
+		delay := pool.Retry.Backoff(runner.Attempts)
+		c.retried(&runner, fmt.Sprintf("attempt %d/%d failed, retrying in %s: %s",
+			runner.Attempts, pool.Retry.MaxAttempts, delay, err))
+		time.Sleep(delay)
+
+		if !c.stillCreating(runner.Name) {
+			logs.InfoF("Runner %s is no longer creating, giving up its launch", runner.Name)
+			return
+		}
+	}
+}
+
+// launched copies the launched task to the tracked runner. A task launched for a runner
+// that meanwhile stopped being created, e.g. after exceeding its provisioning limit, is stopped.
+func (c *Reconciler) launched(created *model.Runner) {
+	c.mu.Lock()
+	runner, ok := c.runners[created.Name]
+	if !ok || runner.Status != model.RunnerStatusCreating {
+		c.mu.Unlock()
+		logs.InfoF("Runner %s was launched after it stopped being created, stopping it", created.Name)
+		if err := c.providerUC.StopRunner(created, "runner was given up while launching"); err != nil {
+			logs.ErrorF("Failed to stop runner %s: %s", created.Name, err)
+		}
+		return
+	}
+
+	runner.ARN = created.ARN
+	runner.PrivateIPv4 = created.PrivateIPv4
+	runner.Attempts = created.Attempts
+	runner.Fallback = created.Fallback
+	runner.CPU = created.CPU
+	runner.Memory = created.Memory
+	runner.CapacityProvider = created.CapacityProvider
+	c.eventUC.Emit(model.NewRunnerEvent(model.RunnerEventLaunched, runner, ""))
+	c.setStatus(runner, created.Status, "launched")
+	c.mu.Unlock()
+
+	if err := c.SendRunners(); err != nil {
+		logs.ErrorF("Error sending launched runner: %s", err)
+	}
+}
+
+// failLaunch marks the runner failed with the launch error as reason.
+func (c *Reconciler) failLaunch(failed *model.Runner, err error) {
+	reason := fmt.Sprintf("launch failed after %d attempts: %s", failed.Attempts, err)
+	c.eventUC.Emit(model.NewRunnerEvent(model.RunnerEventLaunchFailed, failed, reason))
+
+	c.mu.Lock()
+	runner, ok := c.runners[failed.Name]
+	if !ok || runner.Status != model.RunnerStatusCreating {
+		c.mu.Unlock()
+		return
+	}
+	runner.Attempts = failed.Attempts
+	runner.StopReason = reason
+	c.setStatus(runner, model.RunnerStatusFailed, "launch failed")
+	c.mu.Unlock()
+
+	if err := c.SendRunners(); err != nil {
+		logs.ErrorF("Error sending failed runner: %s", err)
+	}
+}
+
+// retried emits the failed launch attempt of the runner.
+func (c *Reconciler) retried(runner *model.Runner, reason string) {
+	c.eventUC.Emit(model.NewRunnerEvent(model.RunnerEventLaunchRetried, runner, reason))
+}
+
+func (c *Reconciler) stillCreating(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	runner, ok := c.runners[name]
+	return ok && runner.Status == model.RunnerStatusCreating
+}
@@ -0,0 +1,82 @@
+package reconciler
+
+import (
+	"fmt"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/infrastructure/logs"
+	"time"
+)
+
+// runnerStop is a runner to stop with the reason why, copied under c.mu so that its task is stopped without it.
+type runnerStop struct {
+	runner model.Runner
+	reason string
+}
+
+// EnforceLimits stops the runners that stayed creating, ready or busy longer than their pool allows,
+// so that runners which never came up, never picked up a job or outlived their job do not live forever.
+func (c *Reconciler) EnforceLimits() {
+	c.mu.Lock()
+	stuck := make([]runnerStop, 0)
+	for _, runner := range c.runners {
+		// Idle warm runners are scaled by the warm pool instead
+		if runner.UpdatedAt.IsZero() || (runner.Status == model.RunnerStatusReady && runner.IsIdleWarm()) {
+			continue
+		}
+
+		pool, err := c.poolUC.GetPool(runner.Pool)
+		if err != nil {
+			logs.ErrorF("Failed to get pool %s of runner %s: %s", runner.Pool, runner.Name, err)
+			continue
+		}
+
+		limit := pool.Limit(runner.Status)
+		elapsed := time.Since(runner.UpdatedAt)
+		if limit == 0 || elapsed < limit {
+			continue
+		}
+
+		reason := fmt.Sprintf("%s for %s, exceeding the limit of %s of pool %s",
+			runner.Status, elapsed.Round(time.Second), limit, pool.Name)
+		stuck = append(stuck, runnerStop{runner: *runner, reason: reason})
+	}
+	c.mu.Unlock()
+
+	c.stopRunners(stuck, c.markStuck)
+}
+
+// markStuck emits a stuck event and marks the stopped runner failed.
+func (c *Reconciler) markStuck(runner *model.Runner, reason string) {
+	c.eventUC.Emit(model.NewRunnerEvent(model.RunnerEventStuck, runner, reason))
+
+	runner.StopReason = reason
+	runner.Metrics = map[string]float64{}
+	c.setStatus(runner, model.RunnerStatusFailed, "stuck")
+}
+
+// stopRunners stops the tasks of the runners without holding c.mu, then calls mark with c.mu held for each
+// runner stopped that did not change meanwhile. If a task cannot be stopped, the runner is left as is and
+// retried on the next reconciliation.
+func (c *Reconciler) stopRunners(stops []runnerStop, mark func(runner *model.Runner, reason string)) {
+	stopped := make([]runnerStop, 0, len(stops))
+	for _, stop := range stops {
+		if stop.runner.ARN != "" {
+			if err := c.providerUC.StopRunner(&stop.runner, stop.reason); err != nil {
+				logs.ErrorF("Failed to stop runner %s: %s", stop.runner.Name, err)
+				continue
+			}
+		}
+		stopped = append(stopped, stop)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, stop := range stopped {
+		runner, ok := c.runners[stop.runner.Name]
+		if !ok || runner.Status != stop.runner.Status || !runner.UpdatedAt.Equal(stop.runner.UpdatedAt) {
+			continue
+		}
+		mark(runner, stop.reason)
+	}
+}
@@ -8,36 +8,56 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"runner-controller-ecs/internal/delivery"
 	"runner-controller-ecs/internal/domain/model"
 	"runner-controller-ecs/internal/infrastructure/logs"
 	"runner-controller-ecs/internal/tools"
 	"runner-controller-ecs/internal/usecase"
 	"runner-controller-ecs/internal/usecase/broker"
-	"runner-controller-ecs/internal/usecase/credentials"
+	"runner-controller-ecs/internal/usecase/events"
 	gh "runner-controller-ecs/internal/usecase/github"
 	"runner-controller-ecs/internal/usecase/prometheus"
-	"syscall"
+	"runner-controller-ecs/internal/usecase/scraper"
+	"sync"
 	"time"
 )
 
 type Reconciler struct {
-	awsUC         usecase.IAWSUC
+	providerUC    usecase.IProviderUC
+	poolUC        usecase.IPoolUC
 	credentialsUC usecase.ICredentialUC
 	promUC        usecase.IPrometheusUC
+	scraperUC     usecase.IScraperUC
+	eventUC       usecase.IEventUC
 	name          string
 
 	broker *broker.Broker[model.WorkflowJobWebhook]
 
+	// mu guards runners, which are also updated by the launches running in the background.
+	// It is not held while talking to the provider, the runners or the backend.
+	mu      sync.Mutex
 	runners map[string]*model.Runner
 	jwt     string
+
+	// ctrlID and adminKey are set once registered. The backend signs the tokens of the admin API
+	// with the admin key, which is generated for each registration and never sent back.
+	ctrlID   string
+	adminKey string
+
+	forecast          *model.Forecast
+	forecastFetchedAt time.Time
+	heartbeatAt       time.Time
 }
 
-func NewReconciler(awsUC usecase.IAWSUC, broker *broker.Broker[model.WorkflowJobWebhook]) delivery.Reconciler {
+func NewReconciler(providerUC usecase.IProviderUC, poolUC usecase.IPoolUC, credentialsUC usecase.ICredentialUC, broker *broker.Broker[model.WorkflowJobWebhook]) delivery.Reconciler {
 	return &Reconciler{
-		broker:  broker,
-		awsUC:   awsUC,
-		runners: make(map[string]*model.Runner),
+		broker:        broker,
+		providerUC:    providerUC,
+		poolUC:        poolUC,
+		credentialsUC: credentialsUC,
+		eventUC:       events.NewEventUC(),
+		runners:       make(map[string]*model.Runner),
 	}
 }
 
@@ -50,23 +70,72 @@ func (c *Reconciler) SubscribeBroker() chan model.WorkflowJobWebhook {
 	return c.broker.Subscribe()
 }
 
+// GetRunner returns the runner tracked by the controller with the given name.
+func (c *Reconciler) GetRunner(name string) (*model.Runner, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	runner, ok := c.runners[name]
+	if !ok {
+		return nil, false
+	}
+	res := *runner
+	return &res, true
+}
+
+// AdminKey returns the ID the controller registered with and the key the tokens of the admin API are
+// signed with, or false until the controller is registered.
+func (c *Reconciler) AdminKey() (ctrlID, key string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ctrlID, c.adminKey, c.ctrlID != ""
+}
+
 func (c *Reconciler) Init() error {
 	c.name = "controller-" + tools.RandString(6)
 	c.runners = make(map[string]*model.Runner)
-	c.credentialsUC = credentials.NewCredentialUC()
 	c.promUC = prometheus.NewPrometheusUC()
+	c.scraperUC = scraper.NewScraperUC(c.promUC)
 
-	logs.InfoF("Controller name: %s", c.name)
+	logs.InfoF("Controller name: %s, version %s", c.name, tools.Version())
+
+	pools, err := c.poolUC.GetPools()
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools {
+		logs.InfoF("Serving pool %s for labels %v", pool.Name, pool.Labels)
+	}
 
 	creds, err := c.credentialsUC.GetCredentials()
 	if err != nil {
 		return err
 	}
 
+	// The public IP is needed to advertise the admin API
+	err = c.providerUC.Init()
+	if err != nil {
+		return err
+	}
+
+	adminURL := os.Getenv("ADMIN_URL")
+	if adminURL == "" {
+		adminURL = fmt.Sprintf("http://%s", c.providerUC.GetPublicIP())
+	}
+
+	adminKey, err := tools.RandomHex(32)
+	if err != nil {
+		return err
+	}
+
 	// Define the POST data
 	var jsonStr = map[string]interface{}{
-		"name":    c.name,
-		"api_key": creds.ApiKey,
+		"name":      c.name,
+		"api_key":   creds.ApiKey,
+		"admin_url": adminURL,
+		"admin_key": adminKey,
+		"version":   tools.Version(),
 	}
 
 	jsonData, err := json.Marshal(jsonStr)
@@ -84,7 +153,7 @@ func (c *Reconciler) Init() error {
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		logs.Error(errors.New(fmt.Sprintf("error: %s", response.StatusCode)))
+		logs.Error(fmt.Errorf("unexpected status code %d", response.StatusCode))
 		return nil
 	}
 
@@ -111,14 +180,24 @@ func (c *Reconciler) Init() error {
 		return nil
 	}
 
-	_, err = c.awsUC.GetTaskMetadata()
+	c.mu.Lock()
+	c.ctrlID = rsp.Data.CtrlID
+	c.adminKey = adminKey
+	c.mu.Unlock()
+
+	existing, err := c.providerUC.ListRunners()
 	if err != nil {
 		return err
 	}
+	for _, task := range existing {
+		if !task.IsStopped() {
+			logs.InfoF("Found runner %s (%s) not managed by this controller", task.Name, task.ARN)
+		}
+	}
 
 	githubUC := gh.NewGithubUC(c.credentialsUC)
 
-	_, err = githubUC.GetWebhook(c.awsUC.GetPublicIP())
+	_, err = githubUC.GetWebhook(c.providerUC.GetPublicIP())
 	if err != nil {
 		return err
 	}
@@ -129,70 +208,10 @@ func (c *Reconciler) Init() error {
 func (c *Reconciler) Reconcile(brokerChannel chan model.WorkflowJobWebhook) error {
 	select {
 	case data := <-brokerChannel:
-		if data.Action == "" || data.Job == nil {
-			logs.Info("Webhook received, but no action or job data found. Skipping...")
+		if !c.handleWebhook(data) {
 			return nil
 		}
 
-		logs.InfoF("Received webhook data: %v", data)
-
-		switch data.Action {
-		case "queued":
-			for _, label := range data.Job.Labels {
-				if label == "self-hosted" {
-					newRunner := &model.Runner{
-						Name:        "linux-" + tools.RandString(6),
-						Status:      model.RunnerStatusCreating,
-						PrivateIPv4: "0.0.0.0",
-						Metrics:     map[string]float64{},
-					}
-					c.runners[newRunner.Name] = newRunner
-					err := c.SendRunners()
-					if err != nil {
-						logs.ErrorF("Error sending initial runner: %w", err)
-					}
-					go func() {
-						runner, err := c.awsUC.CreateRunner(newRunner)
-						if err != nil {
-							logs.Error(err)
-						}
-						err = c.SendRunners()
-						if err != nil {
-							logs.ErrorF("Error sending idle runner: %w", err)
-						}
-						logs.InfoF("%v", runner)
-
-					}()
-				}
-			}
-		default:
-			logs.InfoF("Runner assigned to job: '%s'", data.Job.RunnerName)
-			if _, ok := c.runners[data.Job.RunnerName]; !ok {
-				logs.InfoF("Runner %s not found. Skipping...", data.Job.RunnerName)
-				return nil
-			}
-			fallthrough
-		case "in_progress":
-			if _, ok := c.runners[data.Job.RunnerName]; !ok {
-				return nil
-			}
-			c.runners[data.Job.RunnerName].Status = model.RunnerStatusBusy
-			c.runners[data.Job.RunnerName].UpdatedAt = time.Now()
-		case "completed":
-			if _, ok := c.runners[data.Job.RunnerName]; !ok {
-				return nil
-			}
-			c.runners[data.Job.RunnerName].Status = model.RunnerStatusFinished
-			c.runners[data.Job.RunnerName].Metrics = map[string]float64{}
-			c.runners[data.Job.RunnerName].UpdatedAt = time.Now()
-		case "failed":
-			if _, ok := c.runners[data.Job.RunnerName]; !ok {
-				return nil
-			}
-			c.runners[data.Job.RunnerName].Status = model.RunnerStatusFailed
-			c.runners[data.Job.RunnerName].UpdatedAt = time.Now()
-		}
-
 		err := c.FetchMetrics()
 		if err != nil {
 			return err
@@ -209,11 +228,108 @@ func (c *Reconciler) Reconcile(brokerChannel chan model.WorkflowJobWebhook) erro
 		}
 	}
 
-	return nil
+	return c.SendEvents()
+}
+
+// handleWebhook applies the workflow job webhook to the runners. It returns false if the webhook is skipped.
+func (c *Reconciler) handleWebhook(data model.WorkflowJobWebhook) bool {
+	if data.Action == "" || data.Job == nil {
+		logs.Info("Webhook received, but no action or job data found. Skipping...")
+		return false
+	}
+
+	c.eventUC.Emit(&model.RunnerEvent{
+		Type:   model.RunnerEventWebhookReceived,
+		Runner: data.Job.RunnerName,
+		JobID:  data.Job.ID,
+		RunID:  data.Job.RunID,
+		Reason: data.Action,
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch data.Action {
+	case "queued":
+		pool, err := c.poolUC.MatchPool(data.Job.Labels)
+		if err != nil {
+			logs.InfoF("Job with labels %v not served: %s. Skipping...", data.Job.Labels, err)
+			return false
+		}
+		if warm := c.idleWarmRunner(pool.Name); warm != nil {
+			// The job is expected to be picked up by the warm runner, which is replaced by the warm pool
+			warm.Claim(data.JobContext())
+			c.eventUC.Emit(model.NewRunnerEvent(model.RunnerEventWarmClaimed, warm, ""))
+			break
+		}
+		c.launchRunner(pool.Name, data.Job.Labels, data.JobContext())
+	default:
+		logs.InfoF("Runner assigned to job: '%s'", data.Job.RunnerName)
+		if _, ok := c.runners[data.Job.RunnerName]; !ok {
+			logs.InfoF("Runner %s not found. Skipping...", data.Job.RunnerName)
+			return false
+		}
+		fallthrough
+	case "in_progress":
+		runner, ok := c.runners[data.Job.RunnerName]
+		if !ok {
+			return false
+		}
+		// The runner may pick up another job than the one it was launched for
+		runner.Job = data.JobContext()
+		c.setStatus(runner, model.RunnerStatusBusy, "job started")
+	case "completed":
+		runner, ok := c.runners[data.Job.RunnerName]
+		if !ok {
+			return false
+		}
+		runner.Job = data.JobContext()
+		runner.Metrics = map[string]float64{}
+		c.setStatus(runner, model.RunnerStatusFinished, "job completed")
+	case "failed":
+		runner, ok := c.runners[data.Job.RunnerName]
+		if !ok {
+			return false
+		}
+		c.setStatus(runner, model.RunnerStatusFailed, "job failed")
+	}
+
+	return true
+}
+
+// setStatus changes the status of the runner and emits the transition.
+func (c *Reconciler) setStatus(runner *model.Runner, status model.RunnerStatus, reason string) {
+	if runner.Status == status {
+		return
+	}
+
+	previous := runner.Status
+	runner.SetStatus(status)
+
+	event := model.NewRunnerEvent(model.RunnerEventStatusChanged, runner, reason)
+	event.PreviousStatus = previous
+	c.eventUC.Emit(event)
 }
 
 func (c *Reconciler) reconcileDefault() error {
-	err := c.FetchMetrics()
+	if err := c.Heartbeat(); err != nil {
+		logs.ErrorF("Failed to send the heartbeat: %s", err)
+	}
+
+	err := c.SyncTasks()
+	if err != nil {
+		return err
+	}
+
+	c.EnforceLimits()
+
+	err = c.FetchForecast()
+	if err != nil {
+		logs.ErrorF("Failed to fetch the demand forecast: %s", err)
+	}
+	c.ScaleWarmPools()
+
+	err = c.FetchMetrics()
 	if err != nil {
 		return err
 	}
@@ -226,8 +342,132 @@ func (c *Reconciler) reconcileDefault() error {
 	return nil
 }
 
+// SyncTasks reconciles runners with the state of their tasks. Creating runners are ready once
+// their task runs, runners whose task has stopped are finished, and runners lost to a Spot
+// interruption before picking up their job are marked failed and relaunched, as the job is still queued.
+func (c *Reconciler) SyncTasks() error {
+	c.mu.Lock()
+	active := make([]*model.Runner, 0, len(c.runners))
+	for _, runner := range c.runners {
+		if runner.ARN == "" {
+			continue
+		}
+		switch runner.Status {
+		case model.RunnerStatusCreating, model.RunnerStatusReady, model.RunnerStatusBusy:
+			snapshot := *runner
+			active = append(active, &snapshot)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(active) == 0 {
+		return nil
+	}
+
+	tasks, err := c.providerUC.DescribeRunners(active)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, described := range active {
+		task, ok := tasks[described.ARN]
+		if !ok {
+			continue
+		}
+		// The runner may have changed while its task was described, it is synced again next time
+		runner, ok := c.runners[described.Name]
+		if !ok || runner.ARN != described.ARN || runner.Status != described.Status {
+			continue
+		}
+
+		if task.CapacityProvider != "" {
+			runner.CapacityProvider = task.CapacityProvider
+		}
+		if task.PrivateIPv4 != "" {
+			runner.PrivateIPv4 = task.PrivateIPv4
+		}
+		if runner.Status == model.RunnerStatusCreating && task.IsRunning() {
+			c.setStatus(runner, model.RunnerStatusReady, "task running")
+			continue
+		}
+		if !task.IsStopped() {
+			continue
+		}
+
+		runner.StopReason = task.StoppedReason
+		runner.Metrics = map[string]float64{}
+
+		if !task.IsSpotInterruption() {
+			c.eventUC.Emit(model.NewRunnerEvent(model.RunnerEventTaskStopped, runner, task.StoppedReason))
+			if runner.Status == model.RunnerStatusCreating {
+				c.setStatus(runner, model.RunnerStatusFailed, "task stopped before running")
+			} else {
+				c.setStatus(runner, model.RunnerStatusFinished, "task stopped")
+			}
+			continue
+		}
+
+		c.eventUC.Emit(model.NewRunnerEvent(model.RunnerEventSpotInterrupted, runner,
+			fmt.Sprintf("%s: %s", task.CapacityProvider, task.StoppedReason)))
+		// Idle warm runners are replaced by the warm pool, the others still have a job queued
+		wasIdle := runner.Status == model.RunnerStatusReady || runner.Status == model.RunnerStatusCreating
+		wasIdleWarm := runner.IsIdleWarm()
+		c.setStatus(runner, model.RunnerStatusFailed, "spot interruption")
+		if wasIdle && !wasIdleWarm {
+			logs.InfoF("Relaunching runner for the job still queued on %s", runner.Name)
+			c.launchRunner(runner.Pool, runner.Labels, runner.Job)
+		}
+	}
+
+	return nil
+}
+
 func (c *Reconciler) FetchMetrics() error {
-	readers := make(map[string]io.Reader)
+	targets := c.scrapeTargets()
+	if len(targets) == 0 {
+		return nil
+	}
+
+	results := c.scraperUC.Scrape(context.Background(), targets)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, res := range results {
+		runner, ok := c.runners[name]
+		if !ok || (runner.Status != model.RunnerStatusReady && runner.Status != model.RunnerStatusBusy) {
+			continue
+		}
+
+		if runner.Health != res.Health {
+			logs.InfoF("Runner %s health changed: %s -> %s", name, runner.Health, res.Health)
+			runner.Health = res.Health
+		}
+
+		switch res.Health {
+		case model.TargetHealthUp:
+			if res.Err != nil {
+				logs.ErrorF("Failed to parse metrics of runner %s: %s", name, res.Err)
+				continue
+			}
+			runner.Metrics = res.Metrics
+		case model.TargetHealthDown:
+			logs.InfoF("Failed to fetch metrics of runner %s (%d consecutive failures): %s", name, res.Failures, res.Err)
+		}
+	}
+
+	return nil
+}
+
+// scrapeTargets garbage collects the stopped runners and returns the metrics endpoints of the running ones.
+func (c *Reconciler) scrapeTargets() []*model.ScrapeTarget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	targets := make([]*model.ScrapeTarget, 0, len(c.runners))
 	for name, runner := range c.runners {
 		if runner == nil {
 			logs.Info("Runner is nil. Skipping...")
@@ -237,8 +477,7 @@ func (c *Reconciler) FetchMetrics() error {
 			//logs.InfoF("Runner %s is in status %s. Skipping...", runner.Name, runner.Status)
 			if runner.UpdatedAt != (time.Time{}) && runner.UpdatedAt.Add(CompletedDeregTimeout).Before(time.Now()) {
 				runner.Metrics = map[string]float64{}
-				runner.Status = model.RunnerStatusTerminated
-				logs.InfoF("Runner %s terminated", runner.Name)
+				c.setStatus(runner, model.RunnerStatusTerminated, "garbage collected")
 			}
 
 			continue
@@ -246,71 +485,27 @@ func (c *Reconciler) FetchMetrics() error {
 		if runner.Status == model.RunnerStatusTerminated {
 			if runner.UpdatedAt != (time.Time{}) && runner.UpdatedAt.Add(TerminatedDeregTimeout).Before(time.Now()) {
 				delete(c.runners, name)
-				logs.InfoF("Runner %s deleted", runner.Name)
+				c.eventUC.Emit(model.NewRunnerEvent(model.RunnerEventDeleted, runner, "garbage collected"))
 			}
 			continue
 		}
-		cli := http.DefaultClient
-		ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
-		defer cancel()
-
-		logs.InfoF("Fetching metrics from runner %s with status %s", runner.PrivateIPv4, runner.Status)
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s:9779/metrics", runner.PrivateIPv4), nil)
-		if err != nil {
-			return err
-		}
-
-		res, err := cli.Do(req.WithContext(ctx))
-		if err != nil {
-			switch {
-			case errors.Is(err, context.DeadlineExceeded):
-				if _, ok := c.runners[name]; !ok {
-					return nil
-				}
-				c.runners[name].Status = model.RunnerStatusReady
-				logs.InfoF("Metrics request timeout %s", runner.Name)
-				continue
-			case errors.Is(err, syscall.ECONNREFUSED):
-				//logs.InfoF("Runner %s is not ready yet. Skipping...", runner.Name)
-				continue
-			case errors.Is(err, syscall.EHOSTUNREACH):
-				if _, ok := c.runners[name]; !ok {
-					return nil
-				}
-				c.runners[name].Status = model.RunnerStatusFinished
-				logs.InfoF("Runner %s terminated", runner.Name)
-				continue
-			default:
-				logs.ErrorF("error making http request: %s", err)
-				continue
-			}
-		}
-		readers[name] = res.Body
-	}
-
-	toMap, err := c.promUC.ConvertToMap(readers)
-	if err != nil {
-		return err
-	}
-
-	if len(toMap) == 0 {
-		return nil
-	}
-
-	//logs.InfoF("Received metrics")
-
-	for k, v := range toMap {
-		if _, ok := c.runners[k]; !ok {
+		if runner.Status == model.RunnerStatusCreating {
+			// The task has no private IP until it is provisioned
 			continue
 		}
-		if c.runners[k].Status == model.RunnerStatusFinished || c.runners[k].Status == model.RunnerStatusTerminated {
-			c.runners[k].Metrics = map[string]float64{}
+
+		endpoint := c.providerUC.MetricsEndpoint(runner)
+		if endpoint == "" {
 			continue
 		}
-		c.runners[k].Metrics = v
+
+		targets = append(targets, &model.ScrapeTarget{
+			Name: name,
+			URL:  endpoint,
+		})
 	}
 
-	return nil
+	return targets
 }
 
 func (c *Reconciler) SendRunners() error {
@@ -320,6 +515,7 @@ func (c *Reconciler) SendRunners() error {
 	}
 	url := creds.BackendURL
 
+	c.mu.Lock()
 	rq := &model.ControllerRequest{
 		Name:    c.name,
 		Runners: make([]*model.RequestRunner, 0, len(c.runners)),
@@ -332,37 +528,81 @@ func (c *Reconciler) SendRunners() error {
 		if runner.Status == model.RunnerStatusTerminated || runner.Status == model.RunnerStatusFinished || runner.Status == model.RunnerStatusFailed {
 			m = []model.Metrics{}
 		}
+		var job *model.Job
+		if runner.Job.ID != 0 {
+			jobCopy := runner.Job
+			job = &jobCopy
+		}
 		rq.Runners = append(rq.Runners, &model.RequestRunner{
 			Name:        runner.Name,
+			Pool:        runner.Pool,
+			Labels:      runner.Labels,
+			ARN:         runner.ARN,
 			PrivateIPv4: runner.PrivateIPv4,
 			Status:      runner.Status,
+			StopReason:  runner.StopReason,
+			Job:         job,
+			CPU:         runner.CPU,
+			Memory:      runner.Memory,
 			Metrics:     m,
+
+			CapacityProvider: runner.CapacityProvider,
 		})
 	}
+	c.mu.Unlock()
 
-	m, err := json.MarshalIndent(rq, "", "  ")
-	if err != nil {
-		logs.Error(err)
+	return c.postBackend(url+"/api/runners/", rq)
+}
+
+// SendEvents sends the events emitted since the last call to the backend in one batch.
+// Events are kept for the next call if the backend cannot be reached.
+func (c *Reconciler) SendEvents() error {
+	batch := c.eventUC.Drain()
+	if len(batch) == 0 {
 		return nil
 	}
 
-	logs.InfoF("Runners to be sent: %s", string(m))
+	creds, err := c.credentialsUC.GetCredentials()
+	if err != nil {
+		c.eventUC.Requeue(batch)
+		return err
+	}
 
-	jsonData, err := json.Marshal(rq)
+	err = c.postBackend(creds.BackendURL+"/api/events/", &model.EventsRequest{Events: batch})
 	if err != nil {
-		logs.Error(err)
-		return nil
+		c.eventUC.Requeue(batch)
+		return err
 	}
+	return nil
+}
 
-	req, err := http.NewRequest("POST", url+"/api/runners/", bytes.NewBuffer(jsonData))
+// postBackend sends the payload to the backend with the controller token.
+func (c *Reconciler) postBackend(url string, payload interface{}) error {
+	return c.doBackend(http.MethodPost, url, payload, nil)
+}
+
+// getBackend reads the response of the backend into out.
+func (c *Reconciler) getBackend(url string, out interface{}) error {
+	return c.doBackend(http.MethodGet, url, nil, out)
+}
+
+func (c *Reconciler) doBackend(method, url string, payload, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
-		logs.Error(err)
-		return nil
+		return err
 	}
 
 	if c.jwt == "" {
-		logs.Error(errors.New("no jwt token found"))
-		return nil
+		return errors.New("no jwt token found")
 	}
 
 	// Add the Content-Type and Authorization headers
@@ -373,24 +613,19 @@ func (c *Reconciler) SendRunners() error {
 	client := &http.Client{}
 	response, err := client.Do(req)
 	if err != nil {
-		logs.Error(err)
-		return nil
+		return err
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		logs.Error(errors.New(fmt.Sprintf("error: %s", response.StatusCode)))
-		return nil
+		// Drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, response.Body)
+		return fmt.Errorf("backend responded to %s with status %d", url, response.StatusCode)
 	}
 
-	// Read the response body
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		logs.Error(err)
+	if out == nil {
+		_, _ = io.Copy(io.Discard, response.Body)
 		return nil
 	}
-
-	logs.Info(string(body))
-
-	return nil
+	return json.NewDecoder(response.Body).Decode(out)
 }
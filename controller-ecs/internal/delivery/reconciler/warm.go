@@ -0,0 +1,133 @@
+package reconciler
+
+import (
+	"fmt"
+	"net/url"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/infrastructure/logs"
+	"strconv"
+	"time"
+)
+
+// ForecastInterval is how often the demand forecast is pulled from the backend.
+const ForecastInterval = 15 * time.Minute
+
+// FetchForecast pulls the hourly demand forecast of the pools from the backend, at most every ForecastInterval.
+func (c *Reconciler) FetchForecast() error {
+	if time.Since(c.forecastFetchedAt) < ForecastInterval {
+		return nil
+	}
+	c.forecastFetchedAt = time.Now()
+
+	creds, err := c.credentialsUC.GetCredentials()
+	if err != nil {
+		return err
+	}
+
+	pools, err := c.poolUC.GetPools()
+	if err != nil {
+		return err
+	}
+
+	// The recommendations are capped at the max size of the warm pools
+	query := url.Values{}
+	for _, pool := range pools {
+		if pool.WarmPool.Mode != model.WarmPoolModeOff {
+			query.Set(fmt.Sprintf("max_size[%s]", pool.Name), strconv.Itoa(pool.WarmPool.MaxSize))
+		}
+	}
+
+	var rsp model.ForecastResponse
+	err = c.getBackend(creds.BackendURL+"/api/runners/forecast?"+query.Encode(), &rsp)
+	if err != nil {
+		return err
+	}
+	c.forecast = &rsp.Data
+
+	for _, pool := range pools {
+		if pool.WarmPool.Mode == model.WarmPoolModeOff {
+			continue
+		}
+		logs.InfoF("Warm pool %s (%s): %d runners recommended for the next hour",
+			pool.Name, pool.WarmPool.Mode, c.warmPoolTarget(pool, time.Now()))
+	}
+
+	return nil
+}
+
+// ScaleWarmPools keeps as many idle warm runners in the pools in apply mode as recommended by the forecast
+// for the current hour, or the next one within the lead time of the pool. Extra ready warm runners are stopped.
+func (c *Reconciler) ScaleWarmPools() {
+	if c.forecast == nil {
+		return
+	}
+
+	pools, err := c.poolUC.GetPools()
+	if err != nil {
+		logs.ErrorF("Failed to get pools: %s", err)
+		return
+	}
+
+	c.mu.Lock()
+	now := time.Now()
+	extra := make([]runnerStop, 0)
+	for _, pool := range pools {
+		if pool.WarmPool.Mode != model.WarmPoolModeApply {
+			continue
+		}
+
+		target := c.warmPoolTarget(pool, now)
+		idle := make([]*model.Runner, 0, target)
+		for _, runner := range c.runners {
+			if runner.Pool == pool.Name && runner.IsIdleWarm() {
+				idle = append(idle, runner)
+			}
+		}
+
+		for i := len(idle); i < target; i++ {
+			runner := c.launchRunner(pool.Name, pool.Labels, model.Job{})
+			runner.Warm = true
+		}
+
+		for _, runner := range idle[min(target, len(idle)):] {
+			if runner.Status != model.RunnerStatusReady {
+				continue
+			}
+			extra = append(extra, runnerStop{runner: *runner, reason: "warm pool scaled down"})
+		}
+	}
+	c.mu.Unlock()
+
+	c.stopRunners(extra, c.markWarmStopped)
+}
+
+func (c *Reconciler) warmPoolTarget(pool *model.Pool, now time.Time) int {
+	target := max(
+		c.forecast.Recommended(pool.Name, now),
+		c.forecast.Recommended(pool.Name, now.Add(time.Duration(pool.WarmPool.Lead))),
+	)
+	return min(target, pool.WarmPool.MaxSize)
+}
+
+// idleWarmRunner returns an idle warm runner of the pool, preferring ready ones, or nil if there is none.
+// Must be called with c.mu held.
+func (c *Reconciler) idleWarmRunner(pool string) *model.Runner {
+	var found *model.Runner
+	for _, runner := range c.runners {
+		if runner.Pool != pool || !runner.IsIdleWarm() {
+			continue
+		}
+		if runner.Status == model.RunnerStatusReady {
+			return runner
+		}
+		found = runner
+	}
+	return found
+}
+
+// markWarmStopped marks the stopped warm runner finished.
+func (c *Reconciler) markWarmStopped(runner *model.Runner, reason string) {
+	runner.StopReason = reason
+	runner.Metrics = map[string]float64{}
+	c.setStatus(runner, model.RunnerStatusFinished, reason)
+}
@@ -6,4 +6,11 @@ var (
 	ErrNotImplemented    = errors.New("not implemented")
 	ErrInvalidRepoFormat = errors.New("invalid repo string format")
 	ErrNotFound          = errors.New("resource not found")
+	ErrNoMatchingPool    = errors.New("no pool matches the job labels")
+	ErrInvalidPool       = errors.New("invalid pool configuration")
+
+	// Launch errors are classified by the providers so the reconciler knows whether to retry
+	ErrRetryable = errors.New("retryable launch error")
+	ErrCapacity  = errors.New("insufficient capacity")
+	ErrFatal     = errors.New("fatal launch error")
 )
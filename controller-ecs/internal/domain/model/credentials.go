@@ -6,4 +6,13 @@ type Credentials struct {
 	GithubPAT  string
 	BackendURL string
 	ApiKey     string
+
+	// GithubPATArn references the secret holding GithubPAT, if it was loaded from a secret store
+	GithubPATArn string
+}
+
+type Secret struct {
+	Name  string
+	Value string
+	ARN   string
 }
@@ -0,0 +1,74 @@
+package model
+
+import "time"
+
+type RunnerEventType string
+
+const (
+	RunnerEventWebhookReceived RunnerEventType = "webhook_received"
+	RunnerEventLaunched        RunnerEventType = "runner_launched"
+	RunnerEventLaunchRetried   RunnerEventType = "launch_retried"
+	RunnerEventLaunchFailed    RunnerEventType = "launch_failed"
+	RunnerEventStatusChanged   RunnerEventType = "status_changed"
+	RunnerEventTaskStopped     RunnerEventType = "task_stopped"
+	RunnerEventSpotInterrupted RunnerEventType = "spot_interrupted"
+	// RunnerEventStuck is emitted when a runner exceeds a lifetime limit of its pool and is stopped.
+	RunnerEventStuck   RunnerEventType = "stuck"
+	RunnerEventDeleted RunnerEventType = "runner_deleted"
+	// RunnerEventWarmClaimed is emitted when a queued job is expected to be picked up by a warm runner.
+	RunnerEventWarmClaimed RunnerEventType = "warm_claimed"
+)
+
+// RunnerEvent is a decision of the controller or a change it observed. Events carry the job,
+// run, runner and task they relate to, so they can be correlated into a timeline per runner.
+type RunnerEvent struct {
+	Type           RunnerEventType `json:"type"`
+	Runner         string          `json:"runner,omitempty"`
+	Pool           string          `json:"pool,omitempty"`
+	ARN            string          `json:"arn,omitempty"`
+	JobID          int64           `json:"job_id,omitempty"`
+	RunID          int64           `json:"run_id,omitempty"`
+	Status         RunnerStatus    `json:"status,omitempty"`
+	PreviousStatus RunnerStatus    `json:"previous_status,omitempty"`
+	Reason         string          `json:"reason,omitempty"`
+	Timestamp      time.Time       `json:"timestamp"`
+}
+
+// NewRunnerEvent creates an event correlated with the runner.
+func NewRunnerEvent(eventType RunnerEventType, runner *Runner, reason string) *RunnerEvent {
+	return &RunnerEvent{
+		Type:      eventType,
+		Runner:    runner.Name,
+		Pool:      runner.Pool,
+		ARN:       runner.ARN,
+		JobID:     runner.Job.ID,
+		RunID:     runner.Job.RunID,
+		Status:    runner.Status,
+		Reason:    reason,
+		Timestamp: time.Now(),
+	}
+}
+
+// Fields returns the set fields of the event, to be written as a structured log line.
+func (e *RunnerEvent) Fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	for k, v := range map[string]string{
+		"runner":          e.Runner,
+		"pool":            e.Pool,
+		"arn":             e.ARN,
+		"status":          string(e.Status),
+		"previous_status": string(e.PreviousStatus),
+		"reason":          e.Reason,
+	} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	if e.JobID != 0 {
+		fields["job_id"] = e.JobID
+	}
+	if e.RunID != 0 {
+		fields["run_id"] = e.RunID
+	}
+	return fields
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Forecast is the hourly demand of the pools of the controller, derived by the backend from past jobs.
+type Forecast struct {
+	Pools []*PoolForecast `json:"pools"`
+}
+
+type PoolForecast struct {
+	Pool  string          `json:"pool"`
+	Hours []*HourForecast `json:"hours"`
+}
+
+// HourForecast is the demand of a pool in an hour of the day, in UTC.
+type HourForecast struct {
+	Hour         int     `json:"hour"`
+	ExpectedJobs float64 `json:"expected_jobs"`
+	Recommended  int     `json:"recommended"`
+}
+
+// Recommended returns the recommended warm pool size of the pool in the hour of the given time.
+func (f *Forecast) Recommended(pool string, at time.Time) int {
+	hour := at.UTC().Hour()
+	for _, p := range f.Pools {
+		if p.Pool != pool {
+			continue
+		}
+		for _, h := range p.Hours {
+			if h.Hour == hour {
+				return h.Recommended
+			}
+		}
+	}
+	return 0
+}
@@ -1,11 +1,51 @@
 package model
 
+import "time"
+
 type WorkflowJobWebhook struct {
-	Action string       `json:"action"`
-	Job    *workflowJob `json:"workflow_job"`
+	Action     string       `json:"action"`
+	Job        *workflowJob `json:"workflow_job"`
+	Repository *repository  `json:"repository"`
 }
 
 type workflowJob struct {
-	RunnerName string   `json:"runner_name"`
-	Labels     []string `json:"labels"`
+	ID           int64      `json:"id"`
+	RunID        int64      `json:"run_id"`
+	Name         string     `json:"name"`
+	WorkflowName string     `json:"workflow_name"`
+	HeadBranch   string     `json:"head_branch"`
+	HeadSHA      string     `json:"head_sha"`
+	Conclusion   string     `json:"conclusion"`
+	RunnerName   string     `json:"runner_name"`
+	Labels       []string   `json:"labels"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+}
+
+type repository struct {
+	FullName string `json:"full_name"`
+}
+
+// JobContext returns the context of the workflow job of the webhook.
+func (w *WorkflowJobWebhook) JobContext() Job {
+	job := Job{
+		ID:           w.Job.ID,
+		RunID:        w.Job.RunID,
+		Name:         w.Job.Name,
+		WorkflowName: w.Job.WorkflowName,
+		HeadBranch:   w.Job.HeadBranch,
+		HeadSHA:      w.Job.HeadSHA,
+		Conclusion:   w.Job.Conclusion,
+		CreatedAt:    w.Job.CreatedAt,
+		CompletedAt:  w.Job.CompletedAt,
+	}
+	if w.Repository != nil {
+		job.Repository = w.Repository.FullName
+	}
+	// GitHub already fills started_at on queued jobs, the job only starts once a runner picks it up
+	if w.Action != "queued" {
+		job.StartedAt = w.Job.StartedAt
+	}
+	return job
 }
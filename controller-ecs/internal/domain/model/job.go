@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Job is the context of the workflow job a runner serves.
+type Job struct {
+	ID           int64      `json:"id"`
+	RunID        int64      `json:"run_id"`
+	Name         string     `json:"name"`
+	WorkflowName string     `json:"workflow_name"`
+	Repository   string     `json:"repository"`
+	HeadBranch   string     `json:"head_branch"`
+	HeadSHA      string     `json:"head_sha"`
+	Conclusion   string     `json:"conclusion,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
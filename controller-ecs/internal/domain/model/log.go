@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+const (
+	DefaultLogLines = 100
+	MaxLogLines     = 10000
+)
+
+// LogLine is a line written by a runner container.
+type LogLine struct {
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
@@ -0,0 +1,149 @@
+package model
+
+import "time"
+
+const (
+	LaunchTypeFargate = "FARGATE"
+	LaunchTypeEC2     = "EC2"
+
+	CapacityProviderFargate     = "FARGATE"
+	CapacityProviderFargateSpot = "FARGATE_SPOT"
+
+	WarmPoolModeOff   = "off"
+	WarmPoolModeView  = "view"
+	WarmPoolModeApply = "apply"
+)
+
+type PoolsConfig struct {
+	Pools []*Pool `json:"pools"`
+}
+
+// Pool describes a group of runners serving jobs with the same labels
+// on the same kind of compute.
+type Pool struct {
+	Name   string   `json:"name"`
+	Labels []string `json:"labels"`
+
+	// LaunchType is used when no capacity provider strategy is configured.
+	LaunchType        string                     `json:"launch_type"`
+	CapacityProviders []CapacityProviderStrategy `json:"capacity_providers"`
+
+	// CPU and Memory override the task definition size, e.g. "2048" and "4096".
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+
+	// TaskRoleArn is a pre-existing role assumed by the runners of the pool.
+	// Otherwise a role with the TaskRolePolicies attached is managed by the controller.
+	TaskRoleArn      string   `json:"task_role_arn,omitempty"`
+	TaskRolePolicies []string `json:"task_role_policies,omitempty"`
+
+	// LogGroup and LogStreamPrefix configure the awslogs driver of the runner containers.
+	LogGroup        string `json:"log_group,omitempty"`
+	LogStreamPrefix string `json:"log_stream_prefix,omitempty"`
+
+	// Runners staying creating, ready or busy longer than these limits are stopped as stuck.
+	MaxProvisioning Duration `json:"max_provisioning,omitempty"`
+	MaxIdle         Duration `json:"max_idle,omitempty"`
+	MaxJobDuration  Duration `json:"max_job_duration,omitempty"`
+
+	// Retry configures how failed launches are retried.
+	Retry RetryPolicy `json:"retry"`
+
+	// After a capacity error, runners are relaunched with the fallback strategy if set,
+	// and in the next subnet, so in another availability zone.
+	FallbackCapacityProviders []CapacityProviderStrategy `json:"fallback_capacity_providers,omitempty"`
+	// Subnets overrides the subnets of the controller.
+	Subnets []string `json:"subnets,omitempty"`
+
+	// WarmPool configures the idle runners provisioned ahead of the forecast demand.
+	WarmPool WarmPool `json:"warm_pool"`
+}
+
+// WarmPool follows the hourly demand forecast of the backend. In view mode the recommended
+// size is only logged, in apply mode as many idle runners are kept ready, up to MaxSize.
+type WarmPool struct {
+	Mode    string `json:"mode"`
+	MaxSize int    `json:"max_size"`
+	// Lead is how long before an hour its recommended size is provisioned.
+	Lead Duration `json:"lead"`
+}
+
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+}
+
+// Backoff returns the delay before the given retry, doubling from InitialBackoff up to MaxBackoff.
+func (r RetryPolicy) Backoff(retry int) time.Duration {
+	delay := time.Duration(r.MaxBackoff)
+	if shift := retry - 1; shift < 16 {
+		delay = time.Duration(r.InitialBackoff) << shift
+	}
+	if delay > time.Duration(r.MaxBackoff) {
+		delay = time.Duration(r.MaxBackoff)
+	}
+	return delay
+}
+
+type CapacityProviderStrategy struct {
+	CapacityProvider string `json:"capacity_provider"`
+	Weight           int32  `json:"weight"`
+	Base             int32  `json:"base"`
+}
+
+// Strategy returns the capacity provider strategy to launch with, the fallback one if asked and configured.
+func (p *Pool) Strategy(fallback bool) []CapacityProviderStrategy {
+	if fallback && len(p.FallbackCapacityProviders) > 0 {
+		return p.FallbackCapacityProviders
+	}
+	return p.CapacityProviders
+}
+
+// IsFargate reports whether all tasks of the pool run on Fargate,
+// which is the only compute that can assign public IPs to awsvpc tasks.
+func (p *Pool) IsFargate() bool {
+	return p.UsesFargate(p.CapacityProviders)
+}
+
+// UsesFargate reports whether all tasks launched with the strategy run on Fargate.
+func (p *Pool) UsesFargate(strategy []CapacityProviderStrategy) bool {
+	if len(strategy) == 0 {
+		return p.LaunchType == "" || p.LaunchType == LaunchTypeFargate
+	}
+	for _, cp := range strategy {
+		if cp.CapacityProvider != CapacityProviderFargate && cp.CapacityProvider != CapacityProviderFargateSpot {
+			return false
+		}
+	}
+	return true
+}
+
+// Limit returns how long a runner of the pool may stay in the status, or 0 if it is not limited.
+func (p *Pool) Limit(status RunnerStatus) time.Duration {
+	switch status {
+	case RunnerStatusCreating:
+		return time.Duration(p.MaxProvisioning)
+	case RunnerStatusReady:
+		return time.Duration(p.MaxIdle)
+	case RunnerStatusBusy:
+		return time.Duration(p.MaxJobDuration)
+	default:
+		return 0
+	}
+}
+
+// Matches reports how many of the pool labels are requested by the job,
+// or -1 if the job does not request all of them.
+func (p *Pool) Matches(labels []string) int {
+	requested := make(map[string]struct{}, len(labels))
+	for _, label := range labels {
+		requested[label] = struct{}{}
+	}
+	for _, label := range p.Labels {
+		if _, ok := requested[label]; !ok {
+			return -1
+		}
+	}
+	return len(p.Labels)
+}
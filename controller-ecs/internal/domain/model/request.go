@@ -7,9 +7,32 @@ type ControllerRequest struct {
 
 type RequestRunner struct {
 	Name        string       `json:"name"`
+	Pool        string       `json:"pool"`
+	Labels      []string     `json:"labels"`
+	ARN         string       `json:"arn"`
 	PrivateIPv4 string       `json:"private_ipv4"`
 	Status      RunnerStatus `json:"status"`
+	StopReason  string       `json:"stop_reason,omitempty"`
+	CPU         string       `json:"cpu,omitempty"`
+	Memory      string       `json:"memory,omitempty"`
+	Job         *Job         `json:"job,omitempty"`
 	Metrics     []Metrics    `json:"metrics"`
+
+	// CapacityProvider is empty for tasks launched without a capacity provider strategy.
+	CapacityProvider string `json:"capacity_provider,omitempty"`
+}
+
+type EventsRequest struct {
+	Events []*RunnerEvent `json:"events"`
+}
+
+type ForecastResponse struct {
+	Data Forecast `json:"data"`
+}
+
+// HeartbeatRequest keeps the controller online, and reports the version it runs.
+type HeartbeatRequest struct {
+	Version string `json:"version"`
 }
 
 type AuthResponse struct {
@@ -17,5 +40,6 @@ type AuthResponse struct {
 }
 
 type AuthResponseData struct {
+	CtrlID      string `json:"ctrl_id"`
 	AccessToken string `json:"access_token"`
 }
@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type RunnerStatus string
 
@@ -15,11 +18,71 @@ const (
 
 type Runner struct {
 	Name        string       `json:"name"`
+	Pool        string       `json:"pool"`
+	Labels      []string     `json:"-"`
 	ARN         string       `json:"-"`
 	PrivateIPv4 string       `json:"private_ipv4"`
 	Status      RunnerStatus `json:"status"`
 	Metrics     Metrics      `json:"metrics"`
+	Health      TargetHealth `json:"-"`
+	StopReason  string       `json:"-"`
 	UpdatedAt   time.Time    `json:"-"`
+
+	// Job is the workflow job the runner was launched for, replaced by the one it picks up.
+	Job Job `json:"-"`
+
+	// CPU and Memory are the size of the task in CPU units and MiB, CapacityProvider the one it was placed on.
+	CPU              string `json:"-"`
+	Memory           string `json:"-"`
+	CapacityProvider string `json:"-"`
+
+	// Warm runners are provisioned ahead of the forecast demand, without a job.
+	Warm bool `json:"-"`
+
+	// Attempts counts the failed launches of the runner.
+	Attempts int `json:"-"`
+	// Fallback asks the provider to launch on the alternate placement of the pool.
+	Fallback bool `json:"-"`
 }
 
 type Metrics map[string]float64
+
+// SetStatus changes the status of the runner and records when it happened.
+func (r *Runner) SetStatus(status RunnerStatus) {
+	r.Status = status
+	r.UpdatedAt = time.Now()
+}
+
+// Claim assigns the job to the warm runner. The idle time of the runner restarts from the claim,
+// so that it is not stopped for the time it waited for a job before.
+func (r *Runner) Claim(job Job) {
+	r.Job = job
+	r.UpdatedAt = time.Now()
+}
+
+// IsIdleWarm reports whether the runner is a warm runner no job was assigned to yet.
+func (r *Runner) IsIdleWarm() bool {
+	if !r.Warm || r.Job.ID != 0 {
+		return false
+	}
+	return r.Status == RunnerStatusCreating || r.Status == RunnerStatusReady
+}
+
+// defaultLabels are assigned by GitHub to every Linux x64 self-hosted runner
+var defaultLabels = map[string]struct{}{
+	"self-hosted": {},
+	"linux":       {},
+	"x64":         {},
+}
+
+// CustomLabels returns the comma-separated labels the runner has to register with
+// to be able to pick up the job it was launched for.
+func (r *Runner) CustomLabels() string {
+	labels := make([]string, 0, len(r.Labels))
+	for _, label := range r.Labels {
+		if _, ok := defaultLabels[strings.ToLower(label)]; !ok {
+			labels = append(labels, label)
+		}
+	}
+	return strings.Join(labels, ",")
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type TargetHealth string
+
+const (
+	TargetHealthUnknown TargetHealth = "unknown"
+	TargetHealthUp      TargetHealth = "up"
+	TargetHealthDown    TargetHealth = "down"
+	TargetHealthBackoff TargetHealth = "backoff"
+)
+
+type ScrapeTarget struct {
+	Name string
+	URL  string
+}
+
+type ScrapeResult struct {
+	Health    TargetHealth
+	Metrics   Metrics
+	Err       error
+	Failures  int
+	ScrapedAt time.Time
+}
@@ -0,0 +1,32 @@
+package model
+
+const (
+	TaskStatusRunning = "RUNNING"
+	TaskStatusStopped = "STOPPED"
+
+	TaskStopCodeSpotInterruption = "SpotInterruption"
+)
+
+// RunnerTask is the state of the compute task backing a runner.
+type RunnerTask struct {
+	Name             string
+	ARN              string
+	LastStatus       string
+	StopCode         string
+	StoppedReason    string
+	CapacityProvider string
+	// PrivateIPv4 is empty until the task is provisioned
+	PrivateIPv4 string
+}
+
+func (t *RunnerTask) IsRunning() bool {
+	return t.LastStatus == TaskStatusRunning
+}
+
+func (t *RunnerTask) IsStopped() bool {
+	return t.LastStatus == TaskStatusStopped
+}
+
+func (t *RunnerTask) IsSpotInterruption() bool {
+	return t.StopCode == TaskStopCodeSpotInterruption
+}
@@ -18,6 +18,11 @@ func InfoF(format string, args ...interface{}) {
 	log.Info().Msgf(format, args...)
 }
 
+// Event writes a structured event, with its fields at the top level of the JSON line.
+func Event(name string, fields map[string]interface{}) {
+	log.Info().Str("event", name).Fields(fields).Send()
+}
+
 func Error(err error) {
 	log.Error().Err(err).Send()
 }
@@ -1,26 +1,46 @@
 package tools
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"log"
 	"math/rand"
 	"os"
 )
 
 var requiredEnvVars = []string{
-	"GITHUB_PAT",
 	"REPO",
 	"BACKEND_URL",
+}
+
+// secretEnvVars are only required when secrets are not loaded from a secret store
+var secretEnvVars = []string{
+	"GITHUB_PAT",
 	"BACKEND_API_KEY",
 }
 
 func CheckEnvVars() {
-	for _, envVar := range requiredEnvVars {
+	required := requiredEnvVars
+	if provider := os.Getenv("SECRETS_PROVIDER"); provider == "" || provider == "env" {
+		required = append(required, secretEnvVars...)
+	}
+
+	for _, envVar := range required {
 		if _, ok := os.LookupEnv(envVar); !ok {
 			log.Fatalf("Environment variable %s is required", envVar)
 		}
 	}
 }
 
+// RandomHex returns n random bytes of a cryptographic source, hex encoded.
+func RandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 const letterBytes = "1234567890abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
 func RandString(n int) string {
@@ -0,0 +1,22 @@
+package tools
+
+import "runtime/debug"
+
+// version is set at build time with -ldflags "-X runner-controller-ecs/internal/tools.version=<version>".
+var version string
+
+// Version returns the version the controller was built as, falling back to its VCS revision, or "dev".
+func Version() string {
+	if version != "" {
+		return version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+				return setting.Value[:12]
+			}
+		}
+	}
+	return "dev"
+}
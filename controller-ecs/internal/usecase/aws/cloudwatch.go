@@ -0,0 +1,98 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+
+	cwlTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/infrastructure/logs"
+)
+
+// ensureLogGroups creates the log groups of the pools that do not exist yet.
+func (c *AWSUC) ensureLogGroups(ctx context.Context, client *cloudwatchlogs.Client) error {
+	pools, err := c.poolUC.GetPools()
+	if err != nil {
+		return err
+	}
+
+	created := make(map[string]struct{}, len(pools))
+	for _, pool := range pools {
+		if _, ok := created[pool.LogGroup]; ok {
+			continue
+		}
+		created[pool.LogGroup] = struct{}{}
+
+		_, err = client.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: aws.String(pool.LogGroup),
+		})
+		if err != nil {
+			var existsErr *cwlTypes.ResourceAlreadyExistsException
+			if errors.As(err, &existsErr) {
+				continue
+			}
+			return fmt.Errorf("failed to create log group %s: %v", pool.LogGroup, err)
+		}
+		logs.InfoF("Created log group %s", pool.LogGroup)
+	}
+
+	return nil
+}
+
+// RunnerLogs returns the last lines written by the runner container of the task,
+// read from the awslogs stream prefix/container/task-id of the pool log group.
+func (c *AWSUC) RunnerLogs(runner *model.Runner, lines int) ([]*model.LogLine, error) {
+	ctx := context.TODO()
+
+	if runner.ARN == "" {
+		return nil, fmt.Errorf("%w: runner %s has no task", domain.ErrNotFound, runner.Name)
+	}
+
+	pool, err := c.poolUC.GetPool(runner.Pool)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := c.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	client := cloudwatchlogs.NewFromConfig(*cfg)
+
+	stream := fmt.Sprintf("%s/%s/%s", pool.LogStreamPrefix, RunnerContainerName, taskID(runner.ARN))
+	out, err := client.GetLogEvents(ctx, &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String(pool.LogGroup),
+		LogStreamName: aws.String(stream),
+		Limit:         aws.Int32(int32(lines)),
+		StartFromHead: aws.Bool(false),
+	})
+	if err != nil {
+		var notFoundErr *cwlTypes.ResourceNotFoundException
+		if errors.As(err, &notFoundErr) {
+			return nil, fmt.Errorf("%w: log stream %s", domain.ErrNotFound, stream)
+		}
+		return nil, fmt.Errorf("failed to get log events of %s: %v", stream, err)
+	}
+
+	res := make([]*model.LogLine, 0, len(out.Events))
+	for _, event := range out.Events {
+		res = append(res, &model.LogLine{
+			Timestamp: time.UnixMilli(aws.ToInt64(event.Timestamp)),
+			Message:   aws.ToString(event.Message),
+		})
+	}
+	return res, nil
+}
+
+// taskID extracts the id from arn:aws:ecs:region:account:task/cluster/id
+func taskID(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
@@ -2,38 +2,41 @@ package aws
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 
 	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
-	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	metadata "github.com/brunoscheufler/aws-ecs-metadata-go"
 
 	"runner-controller-ecs/internal/domain"
 	"runner-controller-ecs/internal/domain/model"
 	"runner-controller-ecs/internal/infrastructure/logs"
 	"runner-controller-ecs/internal/usecase"
-	runnerFile "runner-controller-ecs/runner"
 )
 
 type AWSUC struct {
 	credentialsUC usecase.ICredentialUC
+	poolUC        usecase.IPoolUC
 	cfg           *aws.Config
 
 	defaultTaskDefinition *ecs.RegisterTaskDefinitionInput
 	executionRoleArn      string
-	taskDefinitionArn     string
+	taskRoleArn           string
+	// taskDefinitionArns maps pool names to the task definition their runners are launched with
+	taskDefinitionArns map[string]string
+
+	// poolTaskRoleArns maps pool names to the task role overriding the task definition one
+	poolTaskRoleArns map[string]string
 
 	controllerMetadata *metadata.TaskMetadataV4
 	controllerPublicIP string
@@ -45,13 +48,18 @@ type AWSUC struct {
 
 const (
 	TaskDefinitionFamily  = "github-runner-task"
-	ExecutionRoleName     = "runnerTaskExecutionRole"
+	RunnerContainerName   = "github-runner"
 	ExporterContainerName = "ecs-container-exporter"
+	ExporterPort          = 9779
+
+	// DescribeTasksBatchSize is the maximum number of tasks accepted by a single DescribeTasks call
+	DescribeTasksBatchSize = 100
 )
 
-func NewAWSUC(credentialsUC usecase.ICredentialUC) usecase.IAWSUC {
+func NewAWSUC(credentialsUC usecase.ICredentialUC, poolUC usecase.IPoolUC) usecase.IAWSUC {
 	return &AWSUC{
 		credentialsUC: credentialsUC,
+		poolUC:        poolUC,
 	}
 }
 
@@ -74,6 +82,15 @@ func (c *AWSUC) GetPublicIP() string {
 	return c.controllerPublicIP
 }
 
+func (c *AWSUC) Init() error {
+	_, err := c.GetTaskMetadata()
+	return err
+}
+
+func (c *AWSUC) MetricsEndpoint(runner *model.Runner) string {
+	return fmt.Sprintf("http://%s:%d/metrics", runner.PrivateIPv4, ExporterPort)
+}
+
 func (c *AWSUC) GetTaskMetadata() (*metadata.TaskMetadataV4, error) {
 	ctx := context.TODO()
 
@@ -178,43 +195,24 @@ func (c *AWSUC) GetTaskMetadata() (*metadata.TaskMetadataV4, error) {
 		c.subnets = subnets
 	}
 
-	// Check if the IAM role exists
-	roleArn, err := c.checkIAMRole(ctx, iamClient)
+	err = c.ensureRoles(ctx, iamClient)
 	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			roleArn, err = c.createIAMRole(ctx, iamClient)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
+		return nil, err
 	}
 
-	// Check if the ECS task definition exists
-	taskDefArn, err := c.checkTaskDefinition(ctx, ecsClient)
+	err = c.ensureLogGroups(ctx, cloudwatchlogs.NewFromConfig(*cfg))
 	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			taskDefArn, err = c.createTaskDefinition(ctx, ecsClient, roleArn)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
-	}
-
-	if forceNewTaskDef := os.Getenv("FORCE_NEW_TASKDEF"); forceNewTaskDef == "true" {
-		logs.InfoF("Found task definition: %s, but creating new revision", taskDefArn)
-		taskDefArn, err = c.createTaskDefinition(ctx, ecsClient, roleArn)
+		return nil, err
 	}
 
+	// Register a new task definition revision of the pools whose config changed
+	err = c.ensureTaskDefinitions(ctx, ecsClient)
 	if err != nil {
 		return nil, err
 	}
 
-	logs.InfoF("Using IAM Role ARN: %s", roleArn)
-	logs.InfoF("Using Task Definition ARN: %s", taskDefArn)
+	logs.InfoF("Using execution role ARN: %s", c.executionRoleArn)
+	logs.InfoF("Using task role ARN: %s", c.taskRoleArn)
 
 	return metav4, nil
 }
@@ -227,226 +225,296 @@ func (c *AWSUC) CreateRunner(runner *model.Runner) (*model.Runner, error) {
 		return nil, err
 	}
 
+	pool, err := c.poolUC.GetPool(runner.Pool)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get pool %s of runner %s: %w", domain.ErrFatal, runner.Pool, runner.Name, err)
+	}
+
 	// Create an ECS client
 	ecsClient := ecs.NewFromConfig(*cfg)
 
 	// Run ECS task
-	task, name, err := c.runTask(ctx, runner.Name, ecsClient)
+	task, name, err := c.runTask(ctx, runner, pool, ecsClient)
 	if err != nil {
 		return nil, err
 	}
 
 	runner.Name = name
+	// The runner stays creating until the reconciler sees its task running
 	runner.ARN = *task.TaskArn
-	runner.Status = model.RunnerStatusReady
-	for _, container := range task.Containers {
-		if *container.Name == ExporterContainerName {
-			for _, network := range container.NetworkInterfaces {
-				logs.InfoF("Runner %s, exporter PrivateIPv4: %v", runner.Name, *network.PrivateIpv4Address)
-				runner.PrivateIPv4 = *network.PrivateIpv4Address
-			}
-			break
-		}
+	runner.CPU = aws.ToString(task.Cpu)
+	runner.Memory = aws.ToString(task.Memory)
+	runner.CapacityProvider = aws.ToString(task.CapacityProviderName)
+	if ip := taskPrivateIPv4(task); ip != "" {
+		logs.InfoF("Runner %s, exporter PrivateIPv4: %v", runner.Name, ip)
+		runner.PrivateIPv4 = ip
 	}
 
 	return runner, nil
 }
 
-func (c *AWSUC) checkIAMRole(ctx context.Context, client *iam.Client) (string, error) {
-	if c.executionRoleArn != "" {
-		return c.executionRoleArn, nil
+// taskPrivateIPv4 returns the private IP of the exporter container of the task, once it is provisioned.
+func taskPrivateIPv4(task *ecsTypes.Task) string {
+	for _, container := range task.Containers {
+		if aws.ToString(container.Name) != ExporterContainerName {
+			continue
+		}
+		for _, network := range container.NetworkInterfaces {
+			if ip := aws.ToString(network.PrivateIpv4Address); ip != "" {
+				return ip
+			}
+		}
 	}
+	return ""
+}
 
-	_, err := client.GetRole(ctx, &iam.GetRoleInput{
-		RoleName: aws.String(ExecutionRoleName),
-	})
+func (c *AWSUC) DescribeRunners(runners []*model.Runner) (map[string]*model.RunnerTask, error) {
+	ctx := context.TODO()
 
-	if err != nil {
-		var notFoundErr *iamTypes.NoSuchEntityException
-		if !errors.As(err, &notFoundErr) {
-			return "", err
-		}
-		return "", domain.ErrNotFound
+	if c.controllerMetadata == nil {
+		return nil, errors.New("task metadata (cluster name) not set")
 	}
 
-	c.executionRoleArn = fmt.Sprintf("arn:aws:iam::%s:role/%s", c.accountID, ExecutionRoleName)
-	return c.executionRoleArn, nil
-}
+	arns := make([]string, 0, len(runners))
+	for _, runner := range runners {
+		if runner.ARN != "" {
+			arns = append(arns, runner.ARN)
+		}
+	}
 
-func (c *AWSUC) createIAMRole(ctx context.Context, client *iam.Client) (string, error) {
-	trustPolicy := map[string]interface{}{
-		"Version": "2012-10-17",
-		"Statement": []map[string]interface{}{
-			{
-				"Effect": "Allow",
-				"Principal": map[string]string{
-					"Service": "ecs-tasks.amazonaws.com",
-				},
-				"Action": "sts:AssumeRole",
-			},
-		},
+	res := make(map[string]*model.RunnerTask, len(arns))
+	if len(arns) == 0 {
+		return res, nil
 	}
-	trustPolicyJSON, err := json.Marshal(trustPolicy)
+
+	cfg, err := c.LoadConfig()
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal trust policy, %v", err)
+		return nil, err
 	}
 
-	createRoleOutput, err := client.CreateRole(ctx, &iam.CreateRoleInput{
-		RoleName:                 aws.String(ExecutionRoleName),
-		AssumeRolePolicyDocument: aws.String(string(trustPolicyJSON)),
-	})
+	tasks, err := c.describeTasks(ctx, ecs.NewFromConfig(*cfg), arns)
 	if err != nil {
-		return "", fmt.Errorf("failed to create role, %v", err)
+		return nil, err
 	}
 
-	err = c.attachPolicies(ctx, client, ExecutionRoleName)
-	if err != nil {
-		return "", err
+	for _, task := range tasks {
+		res[task.ARN] = task
 	}
 
-	c.executionRoleArn = *createRoleOutput.Role.Arn
-	return c.executionRoleArn, nil
+	return res, nil
 }
 
-func (c *AWSUC) attachPolicies(ctx context.Context, client *iam.Client, roleName string) error {
-	policies := []string{
-		"arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy",
-	}
+func (c *AWSUC) StopRunner(runner *model.Runner, reason string) error {
+	ctx := context.TODO()
 
-	for _, policyArn := range policies {
-		_, err := client.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
-			RoleName:  aws.String(roleName),
-			PolicyArn: aws.String(policyArn),
-		})
-		if err != nil {
-			return fmt.Errorf("failed to attach policy %s: %v", policyArn, err)
-		}
+	if c.controllerMetadata == nil {
+		return errors.New("task metadata (cluster name) not set")
+	}
+	if runner.ARN == "" {
+		return fmt.Errorf("runner %s has no task", runner.Name)
 	}
 
-	return nil
-}
-
-func (c *AWSUC) checkTaskDefinition(ctx context.Context, client *ecs.Client) (string, error) {
-	if c.taskDefinitionArn != "" {
-		return c.taskDefinitionArn, nil
+	cfg, err := c.LoadConfig()
+	if err != nil {
+		return err
 	}
 
-	listTaskDefOutput, err := client.ListTaskDefinitions(ctx, &ecs.ListTaskDefinitionsInput{
-		FamilyPrefix: aws.String(TaskDefinitionFamily),
+	_, err = ecs.NewFromConfig(*cfg).StopTask(ctx, &ecs.StopTaskInput{
+		Cluster: aws.String(c.controllerMetadata.Cluster),
+		Task:    aws.String(runner.ARN),
+		Reason:  aws.String(reason),
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to list task definitions: %v", err)
+		return fmt.Errorf("failed to stop task of runner %s, %v", runner.Name, err)
 	}
 
-	if len(listTaskDefOutput.TaskDefinitionArns) > 0 {
-		c.taskDefinitionArn = listTaskDefOutput.TaskDefinitionArns[len(listTaskDefOutput.TaskDefinitionArns)-1]
-		return c.taskDefinitionArn, nil
+	return nil
+}
+
+// ListRunners returns the running tasks of the pool task definition families in the cluster.
+func (c *AWSUC) ListRunners() ([]*model.RunnerTask, error) {
+	ctx := context.TODO()
+
+	if c.controllerMetadata == nil {
+		return nil, errors.New("task metadata (cluster name) not set")
 	}
 
-	return "", domain.ErrNotFound
-}
+	cfg, err := c.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	ecsClient := ecs.NewFromConfig(*cfg)
 
-func (c *AWSUC) createTaskDefinition(ctx context.Context, client *ecs.Client, roleArn string) (string, error) {
-	taskDef := runnerFile.GetDefaultTaskDefinition()
-	creds, err := c.credentialsUC.GetCredentials()
+	pools, err := c.poolUC.GetPools()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var container ecsTypes.ContainerDefinition
-	ok := false
-	for i, cont := range taskDef.ContainerDefinitions {
-		if *cont.Name == "github-runner" {
-			container = cont
-			container.Environment = append(container.Environment, []ecsTypes.KeyValuePair{
-				{
-					Name:  aws.String("RUNNER_NAME"),
-					Value: aws.String("linux-runner"),
-				},
-				{
-					Name:  aws.String("GITHUB_ACTIONS_RUNNER_CONTEXT"),
-					Value: aws.String(fmt.Sprintf("https://github.com/%s/%s", creds.Owner, creds.Repo)),
-				},
-				{
-					Name:  aws.String("GITHUB_ACCESS_TOKEN"),
-					Value: aws.String(creds.GithubPAT),
-				},
-				{
-					Name:  aws.String("LABELS"),
-					Value: aws.String("saturn-v"),
-				},
-			}...)
-			taskDef.ContainerDefinitions[i] = container
-			ok = true
-			break
+	var arns []string
+	for _, pool := range pools {
+		paginator := ecs.NewListTasksPaginator(ecsClient, &ecs.ListTasksInput{
+			Cluster: aws.String(c.controllerMetadata.Cluster),
+			Family:  aws.String(poolTaskDefinitionFamily(pool)),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list runner tasks, %v", err)
+			}
+			arns = append(arns, page.TaskArns...)
 		}
 	}
 
-	if !ok {
-		return "", errors.New("container github-runner not found in default task definition")
+	if len(arns) == 0 {
+		return []*model.RunnerTask{}, nil
 	}
 
-	taskDef.TaskRoleArn = aws.String(roleArn)
+	return c.describeTasks(ctx, ecsClient, arns)
+}
 
-	taskDefOutput, err := client.RegisterTaskDefinition(ctx, taskDef)
-	if err != nil {
-		return "", fmt.Errorf("failed to register task definition, %v", err)
+func (c *AWSUC) describeTasks(ctx context.Context, client *ecs.Client, arns []string) ([]*model.RunnerTask, error) {
+	res := make([]*model.RunnerTask, 0, len(arns))
+	for start := 0; start < len(arns); start += DescribeTasksBatchSize {
+		end := min(start+DescribeTasksBatchSize, len(arns))
+
+		tasks, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(c.controllerMetadata.Cluster),
+			Tasks:   arns[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe runner tasks, %v", err)
+		}
+
+		for i, task := range tasks.Tasks {
+			res = append(res, &model.RunnerTask{
+				Name:             aws.ToString(task.StartedBy),
+				ARN:              aws.ToString(task.TaskArn),
+				LastStatus:       aws.ToString(task.LastStatus),
+				StopCode:         string(task.StopCode),
+				StoppedReason:    aws.ToString(task.StoppedReason),
+				CapacityProvider: aws.ToString(task.CapacityProviderName),
+				PrivateIPv4:      taskPrivateIPv4(&tasks.Tasks[i]),
+			})
+		}
 	}
 
-	c.taskDefinitionArn = *taskDefOutput.TaskDefinition.TaskDefinitionArn
-	return c.taskDefinitionArn, nil
+	return res, nil
 }
 
-func (c *AWSUC) runTask(ctx context.Context, name string, client *ecs.Client) (*ecsTypes.Task, string, error) {
-	if c.controllerMetadata == nil || c.taskDefinitionArn == "" {
-		return nil, "", errors.New("task metadata (cluster name) or task definition not set")
+func (c *AWSUC) runTask(ctx context.Context, runner *model.Runner, pool *model.Pool, client *ecs.Client) (*ecsTypes.Task, string, error) {
+	taskDefinitionArn, ok := c.taskDefinitionArns[pool.Name]
+	if c.controllerMetadata == nil || !ok {
+		return nil, "", fmt.Errorf("%w: task metadata (cluster name) or task definition not set", domain.ErrFatal)
+	}
+
+	name := runner.Name
+	environment := []ecsTypes.KeyValuePair{
+		{
+			Name:  aws.String("RUNNER_NAME"),
+			Value: aws.String(name),
+		},
+	}
+	if labels := runner.CustomLabels(); labels != "" {
+		environment = append(environment, ecsTypes.KeyValuePair{
+			Name:  aws.String("LABELS"),
+			Value: aws.String(labels),
+		})
 	}
 
 	runTaskInput := &ecs.RunTaskInput{
 		Cluster:        aws.String(c.controllerMetadata.Cluster),
-		TaskDefinition: aws.String(c.taskDefinitionArn),
+		TaskDefinition: aws.String(taskDefinitionArn),
 		Count:          aws.Int32(1),
-		LaunchType:     ecsTypes.LaunchTypeFargate,
+		// StartedBy identifies the runner of a task when listing the cluster
+		StartedBy: aws.String(name),
 		Overrides: &ecsTypes.TaskOverride{
 			ContainerOverrides: []ecsTypes.ContainerOverride{
 				{
-					Name: aws.String("github-runner"),
-					Environment: []ecsTypes.KeyValuePair{
-						{
-							Name:  aws.String("RUNNER_NAME"),
-							Value: aws.String(name),
-						},
-					},
+					Name:        aws.String(RunnerContainerName),
+					Environment: environment,
 				},
 			},
 		},
 		NetworkConfiguration: &ecsTypes.NetworkConfiguration{
 			AwsvpcConfiguration: &ecsTypes.AwsVpcConfiguration{
-				Subnets:        c.subnets,
-				AssignPublicIp: ecsTypes.AssignPublicIpEnabled,
+				Subnets: c.runnerSubnets(runner, pool),
 			},
 		},
 	}
 
+	// Capacity provider strategy and launch type are mutually exclusive
+	strategy := pool.Strategy(runner.Fallback)
+	if len(strategy) > 0 {
+		for _, cp := range strategy {
+			runTaskInput.CapacityProviderStrategy = append(runTaskInput.CapacityProviderStrategy, ecsTypes.CapacityProviderStrategyItem{
+				CapacityProvider: aws.String(cp.CapacityProvider),
+				Weight:           cp.Weight,
+				Base:             cp.Base,
+			})
+		}
+	} else {
+		runTaskInput.LaunchType = ecsTypes.LaunchType(pool.LaunchType)
+	}
+
+	// Public IPs can only be assigned to Fargate tasks, EC2 tasks rely on the subnet routing
+	if pool.UsesFargate(strategy) {
+		runTaskInput.NetworkConfiguration.AwsvpcConfiguration.AssignPublicIp = ecsTypes.AssignPublicIpEnabled
+	}
+
+	if roleArn, ok := c.poolTaskRoleArns[pool.Name]; ok {
+		runTaskInput.Overrides.TaskRoleArn = aws.String(roleArn)
+	}
+	if pool.CPU != "" {
+		runTaskInput.Overrides.Cpu = aws.String(pool.CPU)
+	}
+	if pool.Memory != "" {
+		runTaskInput.Overrides.Memory = aws.String(pool.Memory)
+	}
+
 	runTaskOutput, err := client.RunTask(ctx, runTaskInput)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to run task, %v", err)
+		return nil, "", classifyError(err, "failed to run task")
+	}
+
+	if len(runTaskOutput.Tasks) == 0 {
+		if len(runTaskOutput.Failures) > 0 {
+			failure := runTaskOutput.Failures[0]
+			return nil, "", classifyFailure(aws.ToString(failure.Reason), aws.ToString(failure.Detail))
+		}
+		return nil, "", fmt.Errorf("%w: failed to run task: no tasks started", domain.ErrRetryable)
 	}
 
 	logs.InfoF("Task %s started, waiting for task to be provisioned...", name)
 	time.Sleep(5 * time.Second)
 
+	// The task is running from now on. If it cannot be described yet, the runner is launched
+	// without its private IP, which is picked up by the reconciler along with the task state.
+	started := &runTaskOutput.Tasks[0]
 	tasks, err := client.DescribeTasks(ctx, &ecs.DescribeTasksInput{
 		Cluster: aws.String(c.controllerMetadata.Cluster),
-		Tasks:   []string{*runTaskOutput.Tasks[0].TaskArn},
+		Tasks:   []string{aws.ToString(started.TaskArn)},
 	})
 	if err != nil {
-		return nil, "", err
+		logs.ErrorF("Failed to describe task %s of runner %s: %s", aws.ToString(started.TaskArn), name, err)
+		return started, name, nil
 	}
-
 	if len(tasks.Tasks) == 0 {
-		return nil, "", errors.New("no tasks found or created or may have exited early")
+		logs.ErrorF("Task %s of runner %s not found after it started", aws.ToString(started.TaskArn), name)
+		return started, name, nil
 	}
 
 	return &tasks.Tasks[0], name, nil
 }
+
+// runnerSubnets returns the subnets to launch the runner in. After a capacity error
+// only the next subnet of the list is used, to move the runner to another availability zone.
+func (c *AWSUC) runnerSubnets(runner *model.Runner, pool *model.Pool) []string {
+	subnets := c.subnets
+	if len(pool.Subnets) > 0 {
+		subnets = pool.Subnets
+	}
+	if !runner.Fallback || len(subnets) < 2 {
+		return subnets
+	}
+	return []string{subnets[runner.Attempts%len(subnets)]}
+}
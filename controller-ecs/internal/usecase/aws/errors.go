@@ -0,0 +1,70 @@
+package aws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/smithy-go"
+
+	"runner-controller-ecs/internal/domain"
+)
+
+// capacityMessages are found in the RunTask errors and failures caused by a lack of capacity,
+// which may succeed on another capacity provider or in another availability zone.
+var capacityMessages = []string{
+	"capacity is unavailable",
+	"resource:cpu",
+	"resource:memory",
+	"resource:eni",
+	"resource:ports",
+	"no container instances",
+}
+
+var retryableCodes = map[string]struct{}{
+	"ThrottlingException":    {},
+	"Throttling":             {},
+	"RequestLimitExceeded":   {},
+	"ServerException":        {},
+	"ServiceUnavailable":     {},
+	"InternalFailure":        {},
+	"LimitExceededException": {},
+}
+
+// classifyError wraps an AWS API error with domain.ErrRetryable, domain.ErrCapacity or domain.ErrFatal.
+// Errors without an API error code, such as network errors, are retryable.
+func classifyError(err error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("%w: %s, %v", domain.ErrRetryable, msg, err)
+	}
+
+	if isCapacityMessage(apiErr.ErrorMessage()) {
+		return fmt.Errorf("%w: %s, %v", domain.ErrCapacity, msg, err)
+	}
+	if _, ok := retryableCodes[apiErr.ErrorCode()]; ok {
+		return fmt.Errorf("%w: %s, %v", domain.ErrRetryable, msg, err)
+	}
+	return fmt.Errorf("%w: %s, %v", domain.ErrFatal, msg, err)
+}
+
+// classifyFailure classifies a failure reported by RunTask for a task that was not started.
+func classifyFailure(reason, detail string) error {
+	// AGENT means the container instance chosen for the task lost its agent
+	if reason == "AGENT" || isCapacityMessage(reason) || isCapacityMessage(detail) {
+		return fmt.Errorf("%w: failed to run task: %s %s", domain.ErrCapacity, reason, detail)
+	}
+	return fmt.Errorf("%w: failed to run task: %s %s", domain.ErrFatal, reason, detail)
+}
+
+func isCapacityMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, m := range capacityMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
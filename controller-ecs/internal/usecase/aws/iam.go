@@ -0,0 +1,285 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+
+	iamTypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/infrastructure/logs"
+)
+
+const (
+	ExecutionRoleName      = "runnerTaskExecutionRole"
+	TaskRoleName           = "runnerTaskRole"
+	SecretsPolicyName      = "runnerSecretsAccess"
+	ExecutionRolePolicyArn = "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"
+)
+
+// ensureRoles resolves the execution role, the default task role and the task roles of the pools.
+// Roles given by ARN through EXECUTION_ROLE_ARN, TASK_ROLE_ARN or a pool task_role_arn are used as is,
+// the others are created when missing and their attached policies are kept in sync with the config.
+func (c *AWSUC) ensureRoles(ctx context.Context, client *iam.Client) error {
+	var err error
+
+	if arn := os.Getenv("EXECUTION_ROLE_ARN"); arn != "" {
+		c.executionRoleArn = arn
+	} else {
+		c.executionRoleArn, err = c.ensureRole(ctx, client, ExecutionRoleName, []string{ExecutionRolePolicyArn})
+		if err != nil {
+			return err
+		}
+		// Grant the execution role access to exactly the secrets referenced by the runner task definition
+		err = c.putSecretsPolicy(ctx, client, ExecutionRoleName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if arn := os.Getenv("TASK_ROLE_ARN"); arn != "" {
+		c.taskRoleArn = arn
+	} else {
+		// The default task role grants nothing, the runner only talks to GitHub
+		c.taskRoleArn, err = c.ensureRole(ctx, client, TaskRoleName, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	pools, err := c.poolUC.GetPools()
+	if err != nil {
+		return err
+	}
+
+	c.poolTaskRoleArns = make(map[string]string)
+	for _, pool := range pools {
+		switch {
+		case pool.TaskRoleArn != "":
+			c.poolTaskRoleArns[pool.Name] = pool.TaskRoleArn
+		case len(pool.TaskRolePolicies) > 0:
+			arn, err := c.ensureRole(ctx, client, poolTaskRoleName(pool.Name), pool.TaskRolePolicies)
+			if err != nil {
+				return err
+			}
+			c.poolTaskRoleArns[pool.Name] = arn
+		}
+	}
+
+	return nil
+}
+
+// ensureRole creates the role if it does not exist and returns its ARN.
+func (c *AWSUC) ensureRole(ctx context.Context, client *iam.Client, roleName string, policies []string) (string, error) {
+	roleArn, err := c.getRole(ctx, client, roleName)
+	if err != nil {
+		if !errors.Is(err, domain.ErrNotFound) {
+			return "", err
+		}
+		roleArn, err = c.createRole(ctx, client, roleName)
+		if err != nil {
+			return "", err
+		}
+		logs.InfoF("Created IAM role %s", roleArn)
+	}
+
+	err = c.syncPolicies(ctx, client, roleName, policies)
+	if err != nil {
+		return "", err
+	}
+
+	return roleArn, nil
+}
+
+func (c *AWSUC) getRole(ctx context.Context, client *iam.Client, roleName string) (string, error) {
+	out, err := client.GetRole(ctx, &iam.GetRoleInput{
+		RoleName: aws.String(roleName),
+	})
+	if err != nil {
+		var notFoundErr *iamTypes.NoSuchEntityException
+		if !errors.As(err, &notFoundErr) {
+			return "", err
+		}
+		return "", domain.ErrNotFound
+	}
+
+	return aws.ToString(out.Role.Arn), nil
+}
+
+func (c *AWSUC) createRole(ctx context.Context, client *iam.Client, roleName string) (string, error) {
+	trustPolicy := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect": "Allow",
+				"Principal": map[string]string{
+					"Service": "ecs-tasks.amazonaws.com",
+				},
+				"Action": "sts:AssumeRole",
+			},
+		},
+	}
+	trustPolicyJSON, err := json.Marshal(trustPolicy)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal trust policy, %v", err)
+	}
+
+	createRoleOutput, err := client.CreateRole(ctx, &iam.CreateRoleInput{
+		RoleName:                 aws.String(roleName),
+		AssumeRolePolicyDocument: aws.String(string(trustPolicyJSON)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create role %s, %v", roleName, err)
+	}
+
+	return aws.ToString(createRoleOutput.Role.Arn), nil
+}
+
+// syncPolicies attaches the missing managed policies to the role and detaches
+// the ones that are no longer configured.
+func (c *AWSUC) syncPolicies(ctx context.Context, client *iam.Client, roleName string, policies []string) error {
+	attached := make(map[string]struct{})
+	paginator := iam.NewListAttachedRolePoliciesPaginator(client, &iam.ListAttachedRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list policies of role %s: %v", roleName, err)
+		}
+		for _, policy := range page.AttachedPolicies {
+			attached[aws.ToString(policy.PolicyArn)] = struct{}{}
+		}
+	}
+
+	desired := make(map[string]struct{}, len(policies))
+	for _, policyArn := range policies {
+		desired[policyArn] = struct{}{}
+		if _, ok := attached[policyArn]; ok {
+			continue
+		}
+
+		logs.InfoF("Role %s drifted from config: + %s", roleName, policyArn)
+		_, err := client.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
+			RoleName:  aws.String(roleName),
+			PolicyArn: aws.String(policyArn),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to attach policy %s: %v", policyArn, err)
+		}
+	}
+
+	for policyArn := range attached {
+		if _, ok := desired[policyArn]; ok {
+			continue
+		}
+
+		logs.InfoF("Role %s drifted from config: - %s", roleName, policyArn)
+		_, err := client.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{
+			RoleName:  aws.String(roleName),
+			PolicyArn: aws.String(policyArn),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to detach policy %s: %v", policyArn, err)
+		}
+	}
+
+	return nil
+}
+
+// putSecretsPolicy scopes the inline secrets policy of the role to the secrets
+// referenced by the runner task definition, or removes it if there are none.
+func (c *AWSUC) putSecretsPolicy(ctx context.Context, client *iam.Client, roleName string) error {
+	creds, err := c.credentialsUC.GetCredentials()
+	if err != nil {
+		return err
+	}
+
+	secretsManagerArns, ssmArns, err := splitSecretArns([]string{creds.GithubPATArn})
+	if err != nil {
+		return err
+	}
+
+	if len(secretsManagerArns) == 0 && len(ssmArns) == 0 {
+		_, err = client.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{
+			RoleName:   aws.String(roleName),
+			PolicyName: aws.String(SecretsPolicyName),
+		})
+		var notFoundErr *iamTypes.NoSuchEntityException
+		if err != nil && !errors.As(err, &notFoundErr) {
+			return fmt.Errorf("failed to delete policy %s: %v", SecretsPolicyName, err)
+		}
+		return nil
+	}
+
+	statements := make([]map[string]interface{}, 0, 2)
+	if len(secretsManagerArns) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"Effect":   "Allow",
+			"Action":   []string{"secretsmanager:GetSecretValue"},
+			"Resource": secretsManagerArns,
+		})
+	}
+	if len(ssmArns) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"Effect":   "Allow",
+			"Action":   []string{"ssm:GetParameters"},
+			"Resource": ssmArns,
+		})
+	}
+
+	policyJSON, err := json.Marshal(map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets policy, %v", err)
+	}
+
+	_, err = client.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String(SecretsPolicyName),
+		PolicyDocument: aws.String(string(policyJSON)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put policy %s: %v", SecretsPolicyName, err)
+	}
+
+	return nil
+}
+
+// splitSecretArns sorts the ARNs of the secrets into Secrets Manager secrets and SSM parameters,
+// whatever the partition. Empty ARNs, of secrets loaded from the environment, are skipped.
+func splitSecretArns(arns []string) (secretsManagerArns, ssmArns []string, err error) {
+	for _, secretArn := range arns {
+		if secretArn == "" {
+			continue
+		}
+
+		parsed, err := arn.Parse(secretArn)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid secret ARN %s: %w", secretArn, err)
+		}
+
+		switch parsed.Service {
+		case "ssm":
+			ssmArns = append(ssmArns, secretArn)
+		case "secretsmanager":
+			secretsManagerArns = append(secretsManagerArns, secretArn)
+		default:
+			return nil, nil, fmt.Errorf("secret ARN %s is neither a Secrets Manager secret nor an SSM parameter", secretArn)
+		}
+	}
+	return secretsManagerArns, ssmArns, nil
+}
+
+func poolTaskRoleName(pool string) string {
+	return fmt.Sprintf("%s-%s", TaskRoleName, pool)
+}
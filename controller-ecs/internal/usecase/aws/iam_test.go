@@ -0,0 +1,55 @@
+package aws
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"runner-controller-ecs/internal/usecase/secrets"
+)
+
+func TestSplitSecretArns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	if err := os.WriteFile(path, []byte(`{"github-pat": "ghp_test"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := secrets.NewFileSecretStoreUC(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := store.GetSecret(secrets.GithubPAT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arns := []string{
+		secret.ARN,
+		"",
+		"arn:aws:ssm:eu-west-1:123456789012:parameter/ecs-runner-manager/github-pat",
+		"arn:aws-cn:ssm:cn-north-1:123456789012:parameter/ecs-runner-manager/github-pat",
+		"arn:aws-us-gov:secretsmanager:us-gov-west-1:123456789012:secret:ecs-runner-manager/github-pat-AbCdEf",
+	}
+	secretsManagerArns, ssmArns, err := splitSecretArns(arns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{arns[0], arns[4]}; !slices.Equal(secretsManagerArns, want) {
+		t.Errorf("secrets manager ARNs = %v, want %v", secretsManagerArns, want)
+	}
+	if want := []string{arns[2], arns[3]}; !slices.Equal(ssmArns, want) {
+		t.Errorf("SSM ARNs = %v, want %v", ssmArns, want)
+	}
+}
+
+func TestSplitSecretArnsInvalid(t *testing.T) {
+	for _, secretArn := range []string{
+		"ecs-runner-manager/github-pat",
+		"arn:aws:s3:::bucket/github-pat",
+	} {
+		if _, _, err := splitSecretArns([]string{secretArn}); err == nil {
+			t.Errorf("%s: expected an error", secretArn)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/infrastructure/logs"
+	"runner-controller-ecs/internal/usecase/pools"
+	runnerFile "runner-controller-ecs/runner"
+)
+
+const DefaultKeepRevisions = 5
+
+// taskDefinitionSpec is the part of a task definition managed by the controller,
+// normalized so that a rendered definition can be compared with a registered one.
+type taskDefinitionSpec struct {
+	Cpu                     string          `json:"cpu"`
+	Memory                  string          `json:"memory"`
+	NetworkMode             string          `json:"network_mode"`
+	RequiresCompatibilities []string        `json:"requires_compatibilities"`
+	TaskRoleArn             string          `json:"task_role_arn"`
+	ExecutionRoleArn        string          `json:"execution_role_arn"`
+	Containers              []containerSpec `json:"containers"`
+}
+
+type containerSpec struct {
+	Name         string   `json:"name"`
+	Image        string   `json:"image"`
+	Cpu          int32    `json:"cpu"`
+	Memory       int32    `json:"memory"`
+	Command      []string `json:"command"`
+	Environment  []string `json:"environment"`
+	Secrets      []string `json:"secrets"`
+	PortMappings []string `json:"port_mappings"`
+
+	LogDriver  string            `json:"log_driver"`
+	LogOptions map[string]string `json:"log_options"`
+}
+
+// ensureTaskDefinitions makes sure every pool has an up to date task definition.
+// Each pool has its own family, as the log configuration cannot be overridden when running a task.
+func (c *AWSUC) ensureTaskDefinitions(ctx context.Context, client *ecs.Client) error {
+	pools, err := c.poolUC.GetPools()
+	if err != nil {
+		return err
+	}
+
+	if c.taskDefinitionArns == nil {
+		c.taskDefinitionArns = make(map[string]string)
+	}
+	for _, pool := range pools {
+		arn, err := c.ensureTaskDefinition(ctx, client, pool)
+		if err != nil {
+			return err
+		}
+		logs.InfoF("Using task definition %s for pool %s", arn, pool.Name)
+	}
+
+	return nil
+}
+
+// ensureTaskDefinition registers a new revision of the pool task definition
+// only when the rendered definition drifted from the latest ACTIVE revision,
+// then deregisters the revisions exceeding TASKDEF_KEEP_REVISIONS.
+func (c *AWSUC) ensureTaskDefinition(ctx context.Context, client *ecs.Client, pool *model.Pool) (string, error) {
+	if arn, ok := c.taskDefinitionArns[pool.Name]; ok {
+		return arn, nil
+	}
+
+	family := poolTaskDefinitionFamily(pool)
+	desired, err := c.renderTaskDefinition(pool)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(family),
+	})
+	if err != nil {
+		var invalidErr *ecsTypes.ClientException
+		if !errors.As(err, &invalidErr) {
+			return "", fmt.Errorf("failed to describe task definition: %v", err)
+		}
+		// No ACTIVE revision of the family exists yet
+		current = nil
+	}
+
+	if current != nil && current.TaskDefinition != nil {
+		diff := diffSpecs(registeredSpec(current.TaskDefinition), desiredSpec(desired))
+		if len(diff) == 0 {
+			arn := aws.ToString(current.TaskDefinition.TaskDefinitionArn)
+			c.taskDefinitionArns[pool.Name] = arn
+			logs.InfoF("Task definition %s is up to date", arn)
+			return arn, c.pruneTaskDefinitions(ctx, client, family, arn)
+		}
+
+		logs.InfoF("Task definition %s drifted from config:\n%s",
+			aws.ToString(current.TaskDefinition.TaskDefinitionArn), strings.Join(diff, "\n"))
+	}
+
+	taskDefOutput, err := client.RegisterTaskDefinition(ctx, desired)
+	if err != nil {
+		return "", fmt.Errorf("failed to register task definition, %v", err)
+	}
+
+	arn := aws.ToString(taskDefOutput.TaskDefinition.TaskDefinitionArn)
+	c.taskDefinitionArns[pool.Name] = arn
+	logs.InfoF("Registered task definition %s", arn)
+
+	return arn, c.pruneTaskDefinitions(ctx, client, family, arn)
+}
+
+// renderTaskDefinition builds the desired task definition of the pool from the embedded template and config.
+func (c *AWSUC) renderTaskDefinition(pool *model.Pool) (*ecs.RegisterTaskDefinitionInput, error) {
+	taskDef := runnerFile.GetDefaultTaskDefinition()
+	if taskDef == nil {
+		return nil, errors.New("default task definition not found")
+	}
+	taskDef.Family = aws.String(poolTaskDefinitionFamily(pool))
+
+	// Every container logs to the pool log group, in streams named prefix/container/task-id
+	for i := range taskDef.ContainerDefinitions {
+		taskDef.ContainerDefinitions[i].LogConfiguration = &ecsTypes.LogConfiguration{
+			LogDriver: ecsTypes.LogDriverAwslogs,
+			Options: map[string]string{
+				"awslogs-group":         pool.LogGroup,
+				"awslogs-region":        c.region,
+				"awslogs-stream-prefix": pool.LogStreamPrefix,
+			},
+		}
+	}
+
+	creds, err := c.credentialsUC.GetCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	var container ecsTypes.ContainerDefinition
+	ok := false
+	for i, cont := range taskDef.ContainerDefinitions {
+		if *cont.Name == RunnerContainerName {
+			container = cont
+			if image := os.Getenv("RUNNER_IMAGE"); image != "" {
+				container.Image = aws.String(image)
+			}
+			container.Environment = append(container.Environment, []ecsTypes.KeyValuePair{
+				{
+					Name:  aws.String("RUNNER_NAME"),
+					Value: aws.String("linux-runner"),
+				},
+				{
+					Name:  aws.String("GITHUB_ACTIONS_RUNNER_CONTEXT"),
+					Value: aws.String(fmt.Sprintf("https://github.com/%s/%s", creds.Owner, creds.Repo)),
+				},
+				{
+					Name:  aws.String("LABELS"),
+					Value: aws.String("saturn-v"),
+				},
+			}...)
+			// The token is resolved by ECS at launch when it is stored in a secret store
+			if creds.GithubPATArn != "" {
+				container.Secrets = append(container.Secrets, ecsTypes.Secret{
+					Name:      aws.String("GITHUB_ACCESS_TOKEN"),
+					ValueFrom: aws.String(creds.GithubPATArn),
+				})
+			} else {
+				container.Environment = append(container.Environment, ecsTypes.KeyValuePair{
+					Name:  aws.String("GITHUB_ACCESS_TOKEN"),
+					Value: aws.String(creds.GithubPAT),
+				})
+			}
+			taskDef.ContainerDefinitions[i] = container
+			ok = true
+			break
+		}
+	}
+
+	if !ok {
+		return nil, errors.New("container github-runner not found in default task definition")
+	}
+
+	// The execution role pulls the image and fetches the secrets, the task role is assumed by the runner
+	taskDef.ExecutionRoleArn = aws.String(c.executionRoleArn)
+	taskDef.TaskRoleArn = aws.String(c.taskRoleArn)
+
+	return taskDef, nil
+}
+
+// pruneTaskDefinitions deregisters the ACTIVE revisions of the family older than the kept ones.
+func (c *AWSUC) pruneTaskDefinitions(ctx context.Context, client *ecs.Client, family, current string) error {
+	keep := DefaultKeepRevisions
+	if value := os.Getenv("TASKDEF_KEEP_REVISIONS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid TASKDEF_KEEP_REVISIONS %s", value)
+		}
+		keep = n
+	}
+
+	var arns []string
+	paginator := ecs.NewListTaskDefinitionsPaginator(client, &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String(family),
+		Status:       ecsTypes.TaskDefinitionStatusActive,
+		Sort:         ecsTypes.SortOrderDesc,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list task definitions: %v", err)
+		}
+		for _, arn := range page.TaskDefinitionArns {
+			// The prefix also matches other families starting with the same name
+			if taskDefinitionFamily(arn) == family {
+				arns = append(arns, arn)
+			}
+		}
+	}
+
+	if len(arns) <= keep {
+		return nil
+	}
+
+	for _, arn := range arns[keep:] {
+		if arn == current {
+			continue
+		}
+		_, err := client.DeregisterTaskDefinition(ctx, &ecs.DeregisterTaskDefinitionInput{
+			TaskDefinition: aws.String(arn),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to deregister task definition %s: %v", arn, err)
+		}
+		logs.InfoF("Deregistered task definition %s", arn)
+	}
+
+	return nil
+}
+
+// poolTaskDefinitionFamily returns the task definition family of the pool.
+// The default pool keeps the historical family name.
+func poolTaskDefinitionFamily(pool *model.Pool) string {
+	if pool.Name == pools.DefaultPoolName {
+		return TaskDefinitionFamily
+	}
+	return fmt.Sprintf("%s-%s", TaskDefinitionFamily, pool.Name)
+}
+
+// taskDefinitionFamily extracts the family from arn:aws:ecs:region:account:task-definition/family:revision
+func taskDefinitionFamily(arn string) string {
+	_, familyRevision, ok := strings.Cut(arn, "task-definition/")
+	if !ok {
+		return ""
+	}
+	family, _, _ := strings.Cut(familyRevision, ":")
+	return family
+}
+
+func desiredSpec(taskDef *ecs.RegisterTaskDefinitionInput) *taskDefinitionSpec {
+	spec := &taskDefinitionSpec{
+		Cpu:              aws.ToString(taskDef.Cpu),
+		Memory:           aws.ToString(taskDef.Memory),
+		NetworkMode:      string(taskDef.NetworkMode),
+		TaskRoleArn:      aws.ToString(taskDef.TaskRoleArn),
+		ExecutionRoleArn: aws.ToString(taskDef.ExecutionRoleArn),
+	}
+	for _, compatibility := range taskDef.RequiresCompatibilities {
+		spec.RequiresCompatibilities = append(spec.RequiresCompatibilities, string(compatibility))
+	}
+	for _, container := range taskDef.ContainerDefinitions {
+		spec.Containers = append(spec.Containers, newContainerSpec(container))
+	}
+	return spec.normalize()
+}
+
+func registeredSpec(taskDef *ecsTypes.TaskDefinition) *taskDefinitionSpec {
+	spec := &taskDefinitionSpec{
+		Cpu:              aws.ToString(taskDef.Cpu),
+		Memory:           aws.ToString(taskDef.Memory),
+		NetworkMode:      string(taskDef.NetworkMode),
+		TaskRoleArn:      aws.ToString(taskDef.TaskRoleArn),
+		ExecutionRoleArn: aws.ToString(taskDef.ExecutionRoleArn),
+	}
+	for _, compatibility := range taskDef.RequiresCompatibilities {
+		spec.RequiresCompatibilities = append(spec.RequiresCompatibilities, string(compatibility))
+	}
+	for _, container := range taskDef.ContainerDefinitions {
+		spec.Containers = append(spec.Containers, newContainerSpec(container))
+	}
+	return spec.normalize()
+}
+
+func newContainerSpec(container ecsTypes.ContainerDefinition) containerSpec {
+	spec := containerSpec{
+		Name:    aws.ToString(container.Name),
+		Image:   aws.ToString(container.Image),
+		Cpu:     container.Cpu,
+		Memory:  aws.ToInt32(container.Memory),
+		Command: container.Command,
+	}
+	if container.LogConfiguration != nil {
+		spec.LogDriver = string(container.LogConfiguration.LogDriver)
+		spec.LogOptions = container.LogConfiguration.Options
+	}
+	for _, kv := range container.Environment {
+		spec.Environment = append(spec.Environment, fmt.Sprintf("%s=%s", aws.ToString(kv.Name), aws.ToString(kv.Value)))
+	}
+	for _, secret := range container.Secrets {
+		spec.Secrets = append(spec.Secrets, fmt.Sprintf("%s=%s", aws.ToString(secret.Name), aws.ToString(secret.ValueFrom)))
+	}
+	for _, pm := range container.PortMappings {
+		// ECS fills in the defaults of omitted fields when registering
+		hostPort := aws.ToInt32(pm.HostPort)
+		if hostPort == 0 {
+			hostPort = aws.ToInt32(pm.ContainerPort)
+		}
+		protocol := string(pm.Protocol)
+		if protocol == "" {
+			protocol = string(ecsTypes.TransportProtocolTcp)
+		}
+		spec.PortMappings = append(spec.PortMappings, fmt.Sprintf("%d:%d/%s", hostPort, aws.ToInt32(pm.ContainerPort), protocol))
+	}
+	return spec
+}
+
+func (s *taskDefinitionSpec) normalize() *taskDefinitionSpec {
+	sort.Strings(s.RequiresCompatibilities)
+	sort.Slice(s.Containers, func(i, j int) bool {
+		return s.Containers[i].Name < s.Containers[j].Name
+	})
+	for i := range s.Containers {
+		sort.Strings(s.Containers[i].Environment)
+		sort.Strings(s.Containers[i].Secrets)
+		sort.Strings(s.Containers[i].PortMappings)
+		if len(s.Containers[i].Command) == 0 {
+			s.Containers[i].Command = nil
+		}
+	}
+	return s
+}
+
+// diffSpecs lists the fields that differ between two specs, one line per field.
+// Values of environment variables are not printed, as they contain credentials.
+func diffSpecs(current, desired *taskDefinitionSpec) []string {
+	currentFields := flattenSpec(current)
+	desiredFields := flattenSpec(desired)
+
+	keys := make(map[string]struct{}, len(currentFields)+len(desiredFields))
+	for k := range currentFields {
+		keys[k] = struct{}{}
+	}
+	for k := range desiredFields {
+		keys[k] = struct{}{}
+	}
+
+	var diff []string
+	for k := range keys {
+		oldValue, hadOld := currentFields[k]
+		newValue, hasNew := desiredFields[k]
+		secret := strings.Contains(k, ".environment.")
+		switch {
+		case hadOld && hasNew && oldValue == newValue:
+			continue
+		case secret && !hasNew:
+			diff = append(diff, fmt.Sprintf("- %s", k))
+		case secret && !hadOld:
+			diff = append(diff, fmt.Sprintf("+ %s", k))
+		case secret:
+			diff = append(diff, fmt.Sprintf("~ %s", k))
+		case !hasNew:
+			diff = append(diff, fmt.Sprintf("- %s: %s", k, oldValue))
+		case !hadOld:
+			diff = append(diff, fmt.Sprintf("+ %s: %s", k, newValue))
+		default:
+			diff = append(diff, fmt.Sprintf("~ %s: %s -> %s", k, oldValue, newValue))
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// flattenSpec maps every leaf of the spec to its value. Containers are keyed by name
+// and environment variables by their own name, so that reordering does not show up as drift.
+func flattenSpec(spec *taskDefinitionSpec) map[string]string {
+	res := make(map[string]string)
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return res
+	}
+	var tree map[string]interface{}
+	if err = json.Unmarshal(raw, &tree); err != nil {
+		return res
+	}
+
+	containers, _ := tree["containers"].([]interface{})
+	delete(tree, "containers")
+	flatten("", tree, res)
+
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		prefix := fmt.Sprintf("containers.%v", container["name"])
+
+		env, _ := container["environment"].([]interface{})
+		delete(container, "environment")
+		for _, e := range env {
+			name, value, _ := strings.Cut(fmt.Sprint(e), "=")
+			res[fmt.Sprintf("%s.environment.%s", prefix, name)] = value
+		}
+
+		flatten(prefix, container, res)
+	}
+	return res
+}
+
+func flatten(prefix string, value interface{}, res map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flatten(key, child, res)
+		}
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		res[prefix] = "[" + strings.Join(items, ", ") + "]"
+	case nil:
+		res[prefix] = ""
+	default:
+		res[prefix] = fmt.Sprint(v)
+	}
+}
@@ -5,15 +5,19 @@ import (
 	"runner-controller-ecs/internal/domain"
 	"runner-controller-ecs/internal/domain/model"
 	"runner-controller-ecs/internal/usecase"
+	"runner-controller-ecs/internal/usecase/secrets"
 	"strings"
 )
 
 type CredentialUC struct {
-	credentials *model.Credentials
+	secretStoreUC usecase.ISecretStoreUC
+	credentials   *model.Credentials
 }
 
-func NewCredentialUC() usecase.ICredentialUC {
-	return &CredentialUC{}
+func NewCredentialUC(secretStoreUC usecase.ISecretStoreUC) usecase.ICredentialUC {
+	return &CredentialUC{
+		secretStoreUC: secretStoreUC,
+	}
 }
 
 func (c *CredentialUC) GetCredentials() (*model.Credentials, error) {
@@ -22,13 +26,24 @@ func (c *CredentialUC) GetCredentials() (*model.Credentials, error) {
 			return nil, domain.ErrInvalidRepoFormat
 		}
 
+		githubPAT, err := c.secretStoreUC.GetSecret(secrets.GithubPAT)
+		if err != nil {
+			return nil, err
+		}
+
+		apiKey, err := c.secretStoreUC.GetSecret(secrets.BackendAPIKey)
+		if err != nil {
+			return nil, err
+		}
+
 		repoOwner := strings.Split(os.Getenv("REPO"), "/")
 		c.credentials = &model.Credentials{
-			Owner:      repoOwner[0],
-			Repo:       repoOwner[1],
-			GithubPAT:  os.Getenv("GITHUB_PAT"),
-			BackendURL: os.Getenv("BACKEND_URL"),
-			ApiKey:     os.Getenv("BACKEND_API_KEY"),
+			Owner:        repoOwner[0],
+			Repo:         repoOwner[1],
+			GithubPAT:    githubPAT.Value,
+			GithubPATArn: githubPAT.ARN,
+			BackendURL:   os.Getenv("BACKEND_URL"),
+			ApiKey:       apiKey.Value,
 		}
 	}
 	return c.credentials, nil
@@ -0,0 +1,500 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/infrastructure/logs"
+	"runner-controller-ecs/internal/usecase"
+	runnerFile "runner-controller-ecs/runner"
+)
+
+// DockerUC runs runners as containers of a local Docker Engine,
+// so the controller can be developed and tested without an AWS account.
+type DockerUC struct {
+	credentialsUC usecase.ICredentialUC
+	poolUC        usecase.IPoolUC
+
+	client   *http.Client
+	baseURL  string
+	image    string
+	env      []string
+	network  string
+	publicIP string
+
+	metricsAddr string
+}
+
+const (
+	DefaultHost     = "unix:///var/run/docker.sock"
+	APIVersion      = "v1.41"
+	RunnerLabel     = "ecs-runner-manager.runner"
+	PoolLabel       = "ecs-runner-manager.pool"
+	RunnerContainer = "github-runner"
+	DefaultPublicIP = "localhost"
+	// DefaultMetricsAddr serves the metrics of the containers in place of the ECS exporter sidecar
+	DefaultMetricsAddr = "127.0.0.1:9779"
+
+	StopTimeout    = 10
+	RequestTimeout = 30 * time.Second
+	PullTimeout    = 10 * time.Minute
+)
+
+const (
+	containerCreated    = "created"
+	containerRunning    = "running"
+	containerPaused     = "paused"
+	containerRestarting = "restarting"
+)
+
+func NewDockerUC(credentialsUC usecase.ICredentialUC, poolUC usecase.IPoolUC) usecase.IProviderUC {
+	return &DockerUC{
+		credentialsUC: credentialsUC,
+		poolUC:        poolUC,
+	}
+}
+
+type containerCreateRequest struct {
+	Image      string            `json:"Image"`
+	Env        []string          `json:"Env"`
+	Labels     map[string]string `json:"Labels"`
+	HostConfig hostConfig        `json:"HostConfig"`
+}
+
+type hostConfig struct {
+	NetworkMode string `json:"NetworkMode,omitempty"`
+	NanoCPUs    int64  `json:"NanoCpus,omitempty"`
+	Memory      int64  `json:"Memory,omitempty"`
+}
+
+type containerCreateResponse struct {
+	ID string `json:"Id"`
+}
+
+type containerInspect struct {
+	ID    string `json:"Id"`
+	State struct {
+		Status    string `json:"Status"`
+		ExitCode  int    `json:"ExitCode"`
+		Error     string `json:"Error"`
+		OOMKilled bool   `json:"OOMKilled"`
+	} `json:"State"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		IPAddress string `json:"IPAddress"`
+		Networks  map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+type containerSummary struct {
+	ID     string            `json:"Id"`
+	State  string            `json:"State"`
+	Status string            `json:"Status"`
+	Labels map[string]string `json:"Labels"`
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+// Init connects to the Docker Engine set in DOCKER_HOST and pulls the runner image
+// of the embedded task definition. PUBLIC_HOST is the address GitHub delivers webhooks to,
+// DOCKER_METRICS_ADDR the address the metrics of the containers are served on for the scraper.
+func (c *DockerUC) Init() error {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = DefaultHost
+	}
+
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return fmt.Errorf("invalid DOCKER_HOST %s: %w", host, err)
+	}
+
+	switch hostURL.Scheme {
+	case "unix":
+		socket := hostURL.Path
+		c.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			},
+		}
+		c.baseURL = "http://docker"
+	case "tcp", "http":
+		c.client = &http.Client{}
+		c.baseURL = "http://" + hostURL.Host
+	default:
+		return fmt.Errorf("unsupported DOCKER_HOST scheme %s", hostURL.Scheme)
+	}
+
+	c.network = os.Getenv("DOCKER_NETWORK")
+	c.publicIP = os.Getenv("PUBLIC_HOST")
+	if c.publicIP == "" {
+		c.publicIP = DefaultPublicIP
+	}
+
+	if err = c.loadTemplate(); err != nil {
+		return err
+	}
+
+	metricsAddr := os.Getenv("DOCKER_METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = DefaultMetricsAddr
+	}
+	if err = c.serveMetrics(metricsAddr); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	if err = c.do(ctx, http.MethodGet, "/_ping", nil, nil, nil); err != nil {
+		return fmt.Errorf("docker engine is not reachable: %w", err)
+	}
+
+	pullCtx, pullCancel := context.WithTimeout(context.Background(), PullTimeout)
+	defer pullCancel()
+
+	logs.InfoF("Pulling runner image %s", c.image)
+	if err = c.do(pullCtx, http.MethodPost, "/images/create", url.Values{"fromImage": {c.image}}, nil, nil); err != nil {
+		// The image may still be available locally
+		logs.ErrorF("Failed to pull runner image %s: %s", c.image, err)
+	}
+
+	return nil
+}
+
+// loadTemplate takes the runner image and static environment from the embedded task definition.
+func (c *DockerUC) loadTemplate() error {
+	taskDef := runnerFile.GetDefaultTaskDefinition()
+	if taskDef == nil {
+		return errors.New("default task definition not found")
+	}
+
+	creds, err := c.credentialsUC.GetCredentials()
+	if err != nil {
+		return err
+	}
+
+	for _, container := range taskDef.ContainerDefinitions {
+		if container.Name == nil || *container.Name != RunnerContainer {
+			continue
+		}
+		c.image = *container.Image
+		for _, kv := range container.Environment {
+			c.env = append(c.env, fmt.Sprintf("%s=%s", *kv.Name, *kv.Value))
+		}
+		c.env = append(c.env,
+			fmt.Sprintf("GITHUB_ACTIONS_RUNNER_CONTEXT=https://github.com/%s/%s", creds.Owner, creds.Repo),
+			fmt.Sprintf("GITHUB_ACCESS_TOKEN=%s", creds.GithubPAT),
+		)
+		return nil
+	}
+
+	return fmt.Errorf("container %s not found in default task definition", RunnerContainer)
+}
+
+func (c *DockerUC) GetPublicIP() string {
+	return c.publicIP
+}
+
+// MetricsEndpoint returns the endpoint serving the metrics of the container of the runner,
+// as the ECS exporter sidecar cannot run outside of ECS.
+func (c *DockerUC) MetricsEndpoint(runner *model.Runner) string {
+	if runner.ARN == "" || c.metricsAddr == "" {
+		return ""
+	}
+	return fmt.Sprintf("http://%s/containers/%s/metrics", c.metricsAddr, runner.ARN)
+}
+
+func (c *DockerUC) CreateRunner(runner *model.Runner) (*model.Runner, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	pool, err := c.poolUC.GetPool(runner.Pool)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get pool %s of runner %s: %w", domain.ErrFatal, runner.Pool, runner.Name, err)
+	}
+
+	env := append([]string{}, c.env...)
+	env = append(env, fmt.Sprintf("RUNNER_NAME=%s", runner.Name))
+	if labels := runner.CustomLabels(); labels != "" {
+		env = append(env, fmt.Sprintf("LABELS=%s", labels))
+	}
+
+	req := &containerCreateRequest{
+		Image: c.image,
+		Env:   env,
+		Labels: map[string]string{
+			RunnerLabel: runner.Name,
+			PoolLabel:   pool.Name,
+		},
+		HostConfig: hostConfig{
+			NetworkMode: c.network,
+		},
+	}
+	// Task sizes are expressed in CPU units (1024 per vCPU) and MiB
+	if cpu, err := strconv.ParseInt(pool.CPU, 10, 64); err == nil {
+		req.HostConfig.NanoCPUs = cpu * 1e9 / 1024
+		runner.CPU = pool.CPU
+	}
+	if memory, err := strconv.ParseInt(pool.Memory, 10, 64); err == nil {
+		req.HostConfig.Memory = memory * 1024 * 1024
+		runner.Memory = pool.Memory
+	}
+
+	var created containerCreateResponse
+	err = c.do(ctx, http.MethodPost, "/containers/create", url.Values{"name": {runner.Name}}, req, &created)
+	if err != nil {
+		if isConflict(err) {
+			// A container of a previous attempt was left behind, so it is removed for the next attempt
+			c.discard(runner.Name)
+		}
+		return nil, classifyError(err, "failed to create container of runner %s", runner.Name)
+	}
+
+	err = c.do(ctx, http.MethodPost, "/containers/"+created.ID+"/start", nil, nil, nil)
+	if err != nil {
+		c.discard(created.ID)
+		return nil, classifyError(err, "failed to start container of runner %s", runner.Name)
+	}
+
+	inspect, err := c.inspect(ctx, created.ID)
+	if err != nil {
+		c.discard(created.ID)
+		return nil, classifyError(err, "failed to start container of runner %s", runner.Name)
+	}
+
+	runner.ARN = created.ID
+	runner.SetStatus(model.RunnerStatusReady)
+	runner.PrivateIPv4 = inspect.ipAddress()
+	logs.InfoF("Runner %s, container %s PrivateIPv4: %v", runner.Name, created.ID, runner.PrivateIPv4)
+
+	return runner, nil
+}
+
+// StopRunner stops the container of the runner and removes it, so stopped runners do not pile up.
+func (c *DockerUC) StopRunner(runner *model.Runner, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout+StopTimeout*time.Second)
+	defer cancel()
+
+	if runner.ARN == "" {
+		return fmt.Errorf("runner %s has no container", runner.Name)
+	}
+
+	logs.InfoF("Stopping container of runner %s: %s", runner.Name, reason)
+	err := c.do(ctx, http.MethodPost, "/containers/"+runner.ARN+"/stop", url.Values{"t": {strconv.Itoa(StopTimeout)}}, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to stop container of runner %s: %w", runner.Name, err)
+	}
+
+	return c.remove(ctx, runner.ARN)
+}
+
+// DescribeRunners inspects the containers of the runners. The containers that exited on their own,
+// once their job is done, are removed after being inspected.
+func (c *DockerUC) DescribeRunners(runners []*model.Runner) (map[string]*model.RunnerTask, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	res := make(map[string]*model.RunnerTask, len(runners))
+	for _, runner := range runners {
+		if runner.ARN == "" {
+			continue
+		}
+
+		inspect, err := c.inspect(ctx, runner.ARN)
+		if errors.Is(err, domain.ErrNotFound) {
+			res[runner.ARN] = &model.RunnerTask{
+				Name:          runner.Name,
+				ARN:           runner.ARN,
+				LastStatus:    model.TaskStatusStopped,
+				StoppedReason: "container not found",
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		task := inspect.task()
+		res[runner.ARN] = task
+		if task.IsStopped() {
+			if err := c.remove(ctx, runner.ARN); err != nil {
+				logs.ErrorF("Failed to remove container of runner %s: %s", runner.Name, err)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func (c *DockerUC) ListRunners() ([]*model.RunnerTask, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	filters, err := json.Marshal(map[string][]string{"label": {RunnerLabel}})
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []containerSummary
+	err = c.do(ctx, http.MethodGet, "/containers/json", url.Values{"all": {"1"}, "filters": {string(filters)}}, nil, &containers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runner containers: %w", err)
+	}
+
+	res := make([]*model.RunnerTask, 0, len(containers))
+	for _, container := range containers {
+		res = append(res, &model.RunnerTask{
+			Name:          container.Labels[RunnerLabel],
+			ARN:           container.ID,
+			LastStatus:    taskStatus(container.State),
+			StoppedReason: container.Status,
+		})
+	}
+	return res, nil
+}
+
+// discard force-removes the container of a failed launch, so that the next attempt can reuse the name
+// of the runner. The ID may also be the name of the container.
+func (c *DockerUC) discard(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	err := c.do(ctx, http.MethodDelete, "/containers/"+id, url.Values{"force": {"1"}}, nil, nil)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		logs.ErrorF("Failed to remove container %s of a failed launch: %s", id, err)
+	}
+}
+
+// remove deletes the stopped container, which may already be gone.
+func (c *DockerUC) remove(ctx context.Context, id string) error {
+	err := c.do(ctx, http.MethodDelete, "/containers/"+id, nil, nil, nil)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("failed to remove container %s: %w", id, err)
+	}
+	return nil
+}
+
+func (c *DockerUC) inspect(ctx context.Context, id string) (*containerInspect, error) {
+	var inspect containerInspect
+	if err := c.do(ctx, http.MethodGet, "/containers/"+id+"/json", nil, nil, &inspect); err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", id, err)
+	}
+	return &inspect, nil
+}
+
+// do sends a request to the Docker Engine API and decodes the JSON response into out, if set.
+// The response is copied as is when out is an io.Writer.
+func (c *DockerUC) do(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := fmt.Sprintf("%s/%s%s", c.baseURL, APIVersion, path)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound {
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		return domain.ErrNotFound
+	}
+	if rsp.StatusCode >= http.StatusBadRequest {
+		var e errorResponse
+		_ = json.NewDecoder(rsp.Body).Decode(&e)
+		return &apiError{statusCode: rsp.StatusCode, message: e.Message}
+	}
+
+	if out == nil {
+		// Streaming endpoints such as image pulls only complete once the body is consumed
+		_, err = io.Copy(io.Discard, rsp.Body)
+		return err
+	}
+	if w, ok := out.(io.Writer); ok {
+		// Raw endpoints such as container logs are not JSON
+		_, err = io.Copy(w, rsp.Body)
+		return err
+	}
+	return json.NewDecoder(rsp.Body).Decode(out)
+}
+
+func (i *containerInspect) ipAddress() string {
+	if i.NetworkSettings.IPAddress != "" {
+		return i.NetworkSettings.IPAddress
+	}
+	for _, network := range i.NetworkSettings.Networks {
+		if network.IPAddress != "" {
+			return network.IPAddress
+		}
+	}
+	return ""
+}
+
+func (i *containerInspect) task() *model.RunnerTask {
+	task := &model.RunnerTask{
+		Name:        i.Config.Labels[RunnerLabel],
+		ARN:         i.ID,
+		LastStatus:  taskStatus(i.State.Status),
+		PrivateIPv4: i.ipAddress(),
+	}
+	if task.IsStopped() {
+		switch {
+		case i.State.OOMKilled:
+			task.StoppedReason = "container killed: out of memory"
+		case i.State.Error != "":
+			task.StoppedReason = i.State.Error
+		default:
+			task.StoppedReason = fmt.Sprintf("container exited with code %d", i.State.ExitCode)
+		}
+	}
+	return task
+}
+
+// taskStatus maps container states to the ECS task lifecycle used by the reconciler.
+func taskStatus(state string) string {
+	switch state {
+	case containerCreated, containerRunning, containerPaused, containerRestarting:
+		return model.TaskStatusRunning
+	default:
+		return model.TaskStatusStopped
+	}
+}
@@ -0,0 +1,136 @@
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/usecase"
+)
+
+type fakePoolUC struct {
+	usecase.IPoolUC
+}
+
+func (f *fakePoolUC) GetPool(name string) (*model.Pool, error) {
+	return &model.Pool{Name: name, CPU: "1024", Memory: "2048"}, nil
+}
+
+// fakeEngine answers the container requests of CreateRunner with the responses set per step, and records
+// the containers removed.
+type fakeEngine struct {
+	create, start, inspect engineStep
+
+	mu      sync.Mutex
+	removed []string
+}
+
+// engineStep is the error response of a step, which succeeds when status is 0.
+type engineStep struct {
+	status  int
+	message string
+}
+
+func (f *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/"+APIVersion)
+
+	var step engineStep
+	var body interface{}
+	switch {
+	case r.Method == http.MethodPost && path == "/containers/create":
+		step, body = f.create, containerCreateResponse{ID: "container-1"}
+	case r.Method == http.MethodPost && path == "/containers/container-1/start":
+		step = f.start
+	case r.Method == http.MethodGet && path == "/containers/container-1/json":
+		step = f.inspect
+		inspect := containerInspect{ID: "container-1"}
+		inspect.NetworkSettings.IPAddress = "172.17.0.2"
+		body = inspect
+	case r.Method == http.MethodDelete && r.URL.Query().Get("force") == "1":
+		f.mu.Lock()
+		f.removed = append(f.removed, strings.TrimPrefix(path, "/containers/"))
+		f.mu.Unlock()
+	default:
+		step = engineStep{status: http.StatusNotFound}
+	}
+
+	if step.status != 0 {
+		w.WriteHeader(step.status)
+		_ = json.NewEncoder(w).Encode(errorResponse{Message: step.message})
+		return
+	}
+	if body == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestCreateRunner(t *testing.T) {
+	tests := map[string]struct {
+		engine  *fakeEngine
+		want    error
+		removed []string
+	}{
+		"started": {
+			engine: &fakeEngine{},
+		},
+		"start failed": {
+			engine:  &fakeEngine{start: engineStep{http.StatusInternalServerError, "OCI runtime create failed"}},
+			want:    domain.ErrRetryable,
+			removed: []string{"container-1"},
+		},
+		"start out of space": {
+			engine:  &fakeEngine{start: engineStep{http.StatusInternalServerError, "write /var/lib/docker: no space left on device"}},
+			want:    domain.ErrCapacity,
+			removed: []string{"container-1"},
+		},
+		"inspect failed": {
+			engine:  &fakeEngine{inspect: engineStep{http.StatusInternalServerError, ""}},
+			want:    domain.ErrRetryable,
+			removed: []string{"container-1"},
+		},
+		"name taken by a previous attempt": {
+			engine:  &fakeEngine{create: engineStep{http.StatusConflict, `Conflict. The container name "/runner-1" is already in use`}},
+			want:    domain.ErrRetryable,
+			removed: []string{"runner-1"},
+		},
+		"image missing": {
+			engine: &fakeEngine{create: engineStep{http.StatusNotFound, "No such image: runner:latest"}},
+			want:   domain.ErrFatal,
+		},
+		"invalid configuration": {
+			engine: &fakeEngine{create: engineStep{http.StatusBadRequest, "invalid CPU value"}},
+			want:   domain.ErrFatal,
+		},
+	}
+
+	for name, tt := range tests {
+		srv := httptest.NewServer(tt.engine)
+		uc := &DockerUC{poolUC: &fakePoolUC{}, client: srv.Client(), baseURL: srv.URL, image: "runner:latest"}
+
+		runner, err := uc.CreateRunner(&model.Runner{Name: "runner-1", Pool: "default"})
+		srv.Close()
+
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %s", name, err)
+			} else if runner.ARN != "container-1" || runner.PrivateIPv4 != "172.17.0.2" {
+				t.Errorf("%s: got runner %+v", name, runner)
+			}
+		} else if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got error %v, want %v", name, err, tt.want)
+		}
+
+		if !slices.Equal(tt.engine.removed, tt.removed) {
+			t.Errorf("%s: removed containers %v, want %v", name, tt.engine.removed, tt.removed)
+		}
+	}
+}
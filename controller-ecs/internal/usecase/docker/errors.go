@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"runner-controller-ecs/internal/domain"
+)
+
+// capacityMessages are found in the errors of the Docker Engine caused by a lack of resources on the host.
+var capacityMessages = []string{
+	"no space left on device",
+	"cannot allocate memory",
+	"out of memory",
+	"port is already allocated",
+}
+
+// apiError is an error response of the Docker Engine API.
+type apiError struct {
+	statusCode int
+	message    string
+}
+
+func (e *apiError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("docker engine responded with status %d", e.statusCode)
+	}
+	return fmt.Sprintf("docker engine responded with status %d: %s", e.statusCode, e.message)
+}
+
+// classifyError wraps a Docker Engine error with domain.ErrRetryable, domain.ErrCapacity or domain.ErrFatal.
+// Errors without a response, such as network errors, and server errors are retryable, while a missing
+// image or an invalid container configuration is fatal.
+func classifyError(err error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+
+	if errors.Is(err, domain.ErrNotFound) {
+		return fmt.Errorf("%w: %s, %v", domain.ErrFatal, msg, err)
+	}
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("%w: %s, %v", domain.ErrRetryable, msg, err)
+	}
+
+	if isCapacityMessage(apiErr.message) {
+		return fmt.Errorf("%w: %s, %v", domain.ErrCapacity, msg, err)
+	}
+	if apiErr.statusCode >= http.StatusInternalServerError || apiErr.statusCode == http.StatusConflict {
+		return fmt.Errorf("%w: %s, %v", domain.ErrRetryable, msg, err)
+	}
+	return fmt.Errorf("%w: %s, %v", domain.ErrFatal, msg, err)
+}
+
+func isConflict(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.statusCode == http.StatusConflict
+}
+
+func isCapacityMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, m := range capacityMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
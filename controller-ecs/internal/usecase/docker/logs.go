@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/domain/model"
+)
+
+// RunnerLogs returns the last lines written by the runner container to stdout and stderr.
+func (c *DockerUC) RunnerLogs(runner *model.Runner, lines int) ([]*model.LogLine, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	if runner.ARN == "" {
+		return nil, fmt.Errorf("%w: runner %s has no container", domain.ErrNotFound, runner.Name)
+	}
+
+	query := url.Values{
+		"stdout":     {"1"},
+		"stderr":     {"1"},
+		"timestamps": {"1"},
+		"tail":       {strconv.Itoa(lines)},
+	}
+
+	var buf bytes.Buffer
+	err := c.do(ctx, http.MethodGet, "/containers/"+runner.ARN+"/logs", query, nil, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs of runner %s: %w", runner.Name, err)
+	}
+
+	return parseLogs(demultiplex(buf.Bytes())), nil
+}
+
+// demultiplex strips the 8 byte frame headers the engine prepends to the stdout
+// and stderr chunks of containers created without a TTY.
+func demultiplex(data []byte) []byte {
+	var out bytes.Buffer
+	for len(data) >= 8 {
+		if data[0] > 2 || data[1] != 0 || data[2] != 0 || data[3] != 0 {
+			// Not a multiplexed stream
+			return data
+		}
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		data = data[8:]
+		if size > len(data) {
+			size = len(data)
+		}
+		out.Write(data[:size])
+		data = data[size:]
+	}
+	return out.Bytes()
+}
+
+// parseLogs splits the log lines from the RFC3339 timestamp the engine prefixes them with.
+func parseLogs(data []byte) []*model.LogLine {
+	res := make([]*model.LogLine, 0)
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		ts, message, _ := strings.Cut(line, " ")
+		timestamp, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			message = line
+		}
+		res = append(res, &model.LogLine{Timestamp: timestamp, Message: message})
+	}
+	return res
+}
@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/infrastructure/logs"
+)
+
+type containerStats struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage  uint64   `json:"total_usage"`
+			PercpuUsage []uint64 `json:"percpu_usage"`
+		} `json:"cpu_usage"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64 `json:"usage"`
+	} `json:"memory_stats"`
+}
+
+// serveMetrics serves the metrics of the runner containers on addr, with the names and labels of the
+// ECS exporter sidecar, so that the runners are scraped the same way as on ECS.
+func (c *DockerUC) serveMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on DOCKER_METRICS_ADDR %s: %w", addr, err)
+	}
+	c.metricsAddr = listener.Addr().String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/", c.containerMetrics)
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logs.ErrorF("Container metrics server stopped: %s", err)
+		}
+	}()
+
+	logs.InfoF("Serving container metrics on %s", c.metricsAddr)
+	return nil
+}
+
+// containerMetrics serves /containers/{id}/metrics from a one-shot sample of the stats of the container.
+func (c *DockerUC) containerMetrics(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/metrics")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), RequestTimeout)
+	defer cancel()
+
+	var stats containerStats
+	err := c.do(ctx, http.MethodGet, "/containers/"+id+"/stats", url.Values{"stream": {"false"}, "one-shot": {"true"}}, nil, &stats)
+	if errors.Is(err, domain.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	stats.write(w)
+}
+
+// write writes the stats in the Prometheus text format, per CPU when the engine reports it.
+func (s *containerStats) write(w io.Writer) {
+	fmt.Fprintln(w, "# HELP ecs_cpu_seconds_total CPU time used by the container.")
+	fmt.Fprintln(w, "# TYPE ecs_cpu_seconds_total counter")
+	perCPU := s.CPUStats.CPUUsage.PercpuUsage
+	if len(perCPU) == 0 {
+		perCPU = []uint64{s.CPUStats.CPUUsage.TotalUsage}
+	}
+	for cpu, usage := range perCPU {
+		fmt.Fprintf(w, "ecs_cpu_seconds_total{container=%q,cpu=\"%d\"} %g\n", RunnerContainer, cpu, float64(usage)/1e9)
+	}
+
+	fmt.Fprintln(w, "# HELP ecs_memory_bytes Memory used by the container.")
+	fmt.Fprintln(w, "# TYPE ecs_memory_bytes gauge")
+	fmt.Fprintf(w, "ecs_memory_bytes{container=%q} %d\n", RunnerContainer, s.MemoryStats.Usage)
+}
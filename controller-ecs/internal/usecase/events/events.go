@@ -0,0 +1,60 @@
+package events
+
+import (
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/infrastructure/logs"
+	"runner-controller-ecs/internal/usecase"
+	"sync"
+	"time"
+)
+
+// MaxPendingEvents bounds the events kept while the backend is unreachable, the oldest are dropped first.
+const MaxPendingEvents = 1000
+
+type EventUC struct {
+	mu      sync.Mutex
+	pending []*model.RunnerEvent
+}
+
+func NewEventUC() usecase.IEventUC {
+	return &EventUC{}
+}
+
+// Emit writes the event to the log and queues it for the backend.
+func (c *EventUC) Emit(event *model.RunnerEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	logs.Event(string(event.Type), event.Fields())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, event)
+	c.trim()
+}
+
+// Drain returns the queued events and empties the queue.
+func (c *EventUC) Drain() []*model.RunnerEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	events := c.pending
+	c.pending = nil
+	return events
+}
+
+// Requeue puts back events that could not be sent, ahead of the ones emitted since.
+func (c *EventUC) Requeue(events []*model.RunnerEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = append(events, c.pending...)
+	c.trim()
+}
+
+func (c *EventUC) trim() {
+	if dropped := len(c.pending) - MaxPendingEvents; dropped > 0 {
+		logs.ErrorF("Dropping %d events not sent to the backend", dropped)
+		c.pending = c.pending[dropped:]
+	}
+}
@@ -1,6 +1,7 @@
 package usecase
 
 import (
+	"context"
 	metadata "github.com/brunoscheufler/aws-ecs-metadata-go"
 	"github.com/google/go-github/v62/github"
 	"io"
@@ -11,17 +12,49 @@ type ICredentialUC interface {
 	GetCredentials() (*model.Credentials, error)
 }
 
+type ISecretStoreUC interface {
+	GetSecret(name string) (*model.Secret, error)
+}
+
 type IGithubUC interface {
 	GetWebhook(ip string) (*github.Hook, error)
 }
 
-type IAWSUC interface {
-	GetTaskMetadata() (*metadata.TaskMetadataV4, error)
+// IProviderUC is implemented by every compute backend runners can be launched on.
+type IProviderUC interface {
+	Init() error
 	CreateRunner(runner *model.Runner) (*model.Runner, error)
+	StopRunner(runner *model.Runner, reason string) error
+	DescribeRunners(runners []*model.Runner) (map[string]*model.RunnerTask, error)
+	ListRunners() ([]*model.RunnerTask, error)
+	MetricsEndpoint(runner *model.Runner) string
+	RunnerLogs(runner *model.Runner, lines int) ([]*model.LogLine, error)
 	GetPublicIP() string
 }
 
+type IAWSUC interface {
+	IProviderUC
+	GetTaskMetadata() (*metadata.TaskMetadataV4, error)
+}
+
+type IPoolUC interface {
+	GetPools() ([]*model.Pool, error)
+	GetPool(name string) (*model.Pool, error)
+	MatchPool(labels []string) (*model.Pool, error)
+}
+
 type IPrometheusUC interface {
 	Combine(readers map[string]io.Reader) (string, error)
 	ConvertToMap(readers map[string]io.Reader) (map[string]model.Metrics, error)
+	Parse(reader io.Reader, contentType string) (model.Metrics, error)
+}
+
+type IEventUC interface {
+	Emit(event *model.RunnerEvent)
+	Drain() []*model.RunnerEvent
+	Requeue(events []*model.RunnerEvent)
+}
+
+type IScraperUC interface {
+	Scrape(ctx context.Context, targets []*model.ScrapeTarget) map[string]*model.ScrapeResult
 }
@@ -0,0 +1,204 @@
+package pools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/usecase"
+	"time"
+)
+
+const (
+	DefaultPoolName = "default"
+	DefaultLogGroup = "/ecs/github-runner"
+
+	DefaultMaxProvisioning = 10 * time.Minute
+	DefaultMaxIdle         = 30 * time.Minute
+	// DefaultMaxJobDuration matches the default timeout of GitHub Actions jobs
+	DefaultMaxJobDuration = 6 * time.Hour
+
+	DefaultMaxAttempts    = 4
+	DefaultInitialBackoff = 5 * time.Second
+	DefaultMaxBackoff     = time.Minute
+
+	DefaultWarmPoolMaxSize = 5
+	DefaultWarmPoolLead    = 10 * time.Minute
+)
+
+// roleNameRegexp restricts pool names to what can be used in the name of the pool IAM task role.
+var roleNameRegexp = regexp.MustCompile(`^[\w+=,.@-]{1,48}$`)
+
+type PoolUC struct {
+	pools []*model.Pool
+}
+
+func NewPoolUC() usecase.IPoolUC {
+	return &PoolUC{}
+}
+
+// GetPools loads the pools from the JSON file set in POOLS_CONFIG.
+// Without it, a single Fargate pool serving all self-hosted jobs is used.
+func (c *PoolUC) GetPools() ([]*model.Pool, error) {
+	if c.pools != nil {
+		return c.pools, nil
+	}
+
+	path, ok := os.LookupEnv("POOLS_CONFIG")
+	if !ok || path == "" {
+		c.pools = []*model.Pool{defaultPool()}
+		return c.pools, nil
+	}
+
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg model.PoolsConfig
+	if err = json.Unmarshal(fileBytes, &cfg); err != nil {
+		return nil, err
+	}
+
+	if err = validate(cfg.Pools); err != nil {
+		return nil, err
+	}
+
+	c.pools = cfg.Pools
+	return c.pools, nil
+}
+
+func (c *PoolUC) GetPool(name string) (*model.Pool, error) {
+	pools, err := c.GetPools()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pool := range pools {
+		if pool.Name == name {
+			return pool, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+// MatchPool picks the pool whose labels are all requested by the job.
+// When several pools match, the one with the most labels wins.
+func (c *PoolUC) MatchPool(labels []string) (*model.Pool, error) {
+	pools, err := c.GetPools()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *model.Pool
+	bestScore := -1
+	for _, pool := range pools {
+		if score := pool.Matches(labels); score > bestScore {
+			best = pool
+			bestScore = score
+		}
+	}
+
+	if best == nil {
+		return nil, domain.ErrNoMatchingPool
+	}
+	return best, nil
+}
+
+func defaultPool() *model.Pool {
+	pool := &model.Pool{
+		Name:       DefaultPoolName,
+		Labels:     []string{"self-hosted"},
+		LaunchType: model.LaunchTypeFargate,
+	}
+	setDefaults(pool)
+	return pool
+}
+
+func validate(pools []*model.Pool) error {
+	if len(pools) == 0 {
+		return fmt.Errorf("%w: no pools defined", domain.ErrInvalidPool)
+	}
+
+	names := make(map[string]struct{}, len(pools))
+	for _, pool := range pools {
+		if pool.Name == "" {
+			return fmt.Errorf("%w: pool name is required", domain.ErrInvalidPool)
+		}
+		if _, ok := names[pool.Name]; ok {
+			return fmt.Errorf("%w: duplicate pool %s", domain.ErrInvalidPool, pool.Name)
+		}
+		names[pool.Name] = struct{}{}
+
+		if !roleNameRegexp.MatchString(pool.Name) {
+			return fmt.Errorf("%w: pool name %s must be at most 48 alphanumeric or +=,.@_- characters", domain.ErrInvalidPool, pool.Name)
+		}
+		if pool.TaskRoleArn != "" && len(pool.TaskRolePolicies) > 0 {
+			return fmt.Errorf("%w: pool %s sets both task_role_arn and task_role_policies", domain.ErrInvalidPool, pool.Name)
+		}
+		if len(pool.Labels) == 0 {
+			return fmt.Errorf("%w: pool %s has no labels", domain.ErrInvalidPool, pool.Name)
+		}
+		if pool.LaunchType != "" && pool.LaunchType != model.LaunchTypeFargate && pool.LaunchType != model.LaunchTypeEC2 {
+			return fmt.Errorf("%w: pool %s has unsupported launch type %s", domain.ErrInvalidPool, pool.Name, pool.LaunchType)
+		}
+		if pool.MaxProvisioning < 0 || pool.MaxIdle < 0 || pool.MaxJobDuration < 0 {
+			return fmt.Errorf("%w: pool %s has a negative lifetime limit", domain.ErrInvalidPool, pool.Name)
+		}
+		if pool.Retry.MaxAttempts < 0 || pool.Retry.InitialBackoff < 0 || pool.Retry.MaxBackoff < 0 {
+			return fmt.Errorf("%w: pool %s has a negative retry policy", domain.ErrInvalidPool, pool.Name)
+		}
+		switch pool.WarmPool.Mode {
+		case "", model.WarmPoolModeOff, model.WarmPoolModeView, model.WarmPoolModeApply:
+		default:
+			return fmt.Errorf("%w: pool %s has unsupported warm pool mode %s", domain.ErrInvalidPool, pool.Name, pool.WarmPool.Mode)
+		}
+		if pool.WarmPool.MaxSize < 0 || pool.WarmPool.Lead < 0 {
+			return fmt.Errorf("%w: pool %s has a negative warm pool setting", domain.ErrInvalidPool, pool.Name)
+		}
+		setDefaults(pool)
+	}
+	return nil
+}
+
+// setDefaults fills in the optional settings left empty in the config.
+func setDefaults(pool *model.Pool) {
+	if pool.LaunchType == "" && len(pool.CapacityProviders) == 0 {
+		pool.LaunchType = model.LaunchTypeFargate
+	}
+	if pool.LogGroup == "" {
+		pool.LogGroup = DefaultLogGroup
+	}
+	if pool.LogStreamPrefix == "" {
+		pool.LogStreamPrefix = pool.Name
+	}
+	if pool.MaxProvisioning == 0 {
+		pool.MaxProvisioning = model.Duration(DefaultMaxProvisioning)
+	}
+	if pool.MaxIdle == 0 {
+		pool.MaxIdle = model.Duration(DefaultMaxIdle)
+	}
+	if pool.MaxJobDuration == 0 {
+		pool.MaxJobDuration = model.Duration(DefaultMaxJobDuration)
+	}
+	if pool.Retry.MaxAttempts == 0 {
+		pool.Retry.MaxAttempts = DefaultMaxAttempts
+	}
+	if pool.Retry.InitialBackoff == 0 {
+		pool.Retry.InitialBackoff = model.Duration(DefaultInitialBackoff)
+	}
+	if pool.Retry.MaxBackoff == 0 {
+		pool.Retry.MaxBackoff = model.Duration(DefaultMaxBackoff)
+	}
+	if pool.WarmPool.Mode == "" {
+		pool.WarmPool.Mode = model.WarmPoolModeView
+	}
+	if pool.WarmPool.MaxSize == 0 {
+		pool.WarmPool.MaxSize = DefaultWarmPoolMaxSize
+	}
+	if pool.WarmPool.Lead == 0 {
+		pool.WarmPool.Lead = model.Duration(DefaultWarmPoolLead)
+	}
+}
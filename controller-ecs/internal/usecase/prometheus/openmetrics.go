@@ -0,0 +1,333 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// exemplarSample is the exemplar of an OpenMetrics sample, which the text format cannot carry.
+type exemplarSample struct {
+	// series is the metric name and label set of the sample.
+	series string
+	// exemplar is the label set, value and optional timestamp following the " # " of the sample.
+	exemplar string
+}
+
+// openMetricsConverter rewrites an OpenMetrics exposition into the Prometheus text format.
+type openMetricsConverter struct {
+	b         strings.Builder
+	types     map[string]string
+	exemplars []exemplarSample
+
+	// pendingHelp is a HELP line read before the TYPE of its family, which may rename the family.
+	pendingHelp     string
+	pendingHelpName string
+}
+
+// openMetricsToText rewrites an OpenMetrics exposition into the Prometheus text format,
+// so that it can be decoded by the text parser, and returns the exemplars of its samples
+// to be attached with attachExemplars. Units and _created samples are dropped, as they
+// have no text format counterpart.
+func openMetricsToText(r io.Reader) (io.Reader, []exemplarSample, error) {
+	c := &openMetricsConverter{types: make(map[string]string)}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if line == "# EOF" {
+			break
+		}
+
+		if strings.HasPrefix(line, "#") {
+			c.convertDescriptor(line)
+			continue
+		}
+
+		c.flushHelp()
+		if err := c.convertSample(line); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	c.flushHelp()
+
+	return strings.NewReader(c.b.String()), c.exemplars, nil
+}
+
+func (c *openMetricsConverter) writeLine(format string, args ...interface{}) {
+	fmt.Fprintf(&c.b, format, args...)
+	c.b.WriteByte('\n')
+}
+
+// textName returns the name of a family in the text format, where counters and info
+// metrics are named after their samples.
+func (c *openMetricsConverter) textName(name string) string {
+	switch c.types[name] {
+	case "counter":
+		return name + "_total"
+	case "info":
+		return name + "_info"
+	default:
+		return name
+	}
+}
+
+// flushHelp writes the pending HELP line once no TYPE line can follow it anymore.
+func (c *openMetricsConverter) flushHelp() {
+	if c.pendingHelpName == "" {
+		return
+	}
+	c.writeLine("# HELP %s %s", c.textName(c.pendingHelpName), c.pendingHelp)
+	c.pendingHelpName, c.pendingHelp = "", ""
+}
+
+// convertDescriptor converts a HELP or TYPE line and remembers the type of the family.
+// A HELP line is held until the TYPE of its family is known, as OpenMetrics allows
+// the descriptors of a family in any order.
+func (c *openMetricsConverter) convertDescriptor(line string) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 {
+		return
+	}
+
+	name := fields[2]
+	if name != c.pendingHelpName {
+		c.flushHelp()
+	}
+
+	switch fields[1] {
+	case "TYPE":
+		if len(fields) < 4 {
+			return
+		}
+		typ := fields[3]
+		c.types[name] = typ
+		switch typ {
+		case "counter":
+			c.writeLine("# TYPE %s counter", c.textName(name))
+		case "gauge", "histogram", "summary":
+			c.writeLine("# TYPE %s %s", name, typ)
+		case "info":
+			c.writeLine("# TYPE %s gauge", c.textName(name))
+		case "stateset":
+			c.writeLine("# TYPE %s gauge", name)
+		}
+		c.flushHelp()
+	case "HELP":
+		help := ""
+		if len(fields) == 4 {
+			help = fields[3]
+		}
+		if _, ok := c.types[name]; ok {
+			c.writeLine("# HELP %s %s", c.textName(name), help)
+			return
+		}
+		c.pendingHelpName, c.pendingHelp = name, help
+	}
+	// UNIT and unknown descriptors have no text format counterpart
+}
+
+// convertSample strips the exemplar from a sample line, keeping it aside, and converts
+// its timestamp from seconds to milliseconds.
+func (c *openMetricsConverter) convertSample(line string) error {
+	end := strings.IndexAny(line, "{ ")
+	if end < 0 {
+		return fmt.Errorf("invalid openmetrics sample: %q", line)
+	}
+	name := line[:end]
+
+	if strings.HasSuffix(name, "_created") {
+		switch c.types[strings.TrimSuffix(name, "_created")] {
+		case "counter", "histogram", "summary":
+			return nil
+		}
+	}
+
+	if line[end] == '{' {
+		closing, err := labelsEnd(line, end)
+		if err != nil {
+			return err
+		}
+		end = closing + 1
+	}
+	series, rest := line[:end], line[end:]
+
+	if idx := strings.Index(rest, " # "); idx >= 0 {
+		c.exemplars = append(c.exemplars, exemplarSample{series: series, exemplar: rest[idx+3:]})
+		rest = rest[:idx]
+	}
+
+	fields := strings.Fields(rest)
+	switch len(fields) {
+	case 1:
+		c.writeLine("%s %s", series, fields[0])
+	case 2:
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid openmetrics timestamp: %q", line)
+		}
+		c.writeLine("%s %s %d", series, fields[0], int64(ts*1000))
+	default:
+		return fmt.Errorf("invalid openmetrics sample: %q", line)
+	}
+	return nil
+}
+
+// attachExemplars sets the exemplars of the counters and histogram buckets of the decoded families,
+// the only samples OpenMetrics allows exemplars on.
+func attachExemplars(mf map[string]*dto.MetricFamily, samples []exemplarSample) error {
+	for _, sample := range samples {
+		name, labels, err := parseSeries(sample.series)
+		if err != nil {
+			return err
+		}
+		exemplar, err := parseExemplar(sample.exemplar)
+		if err != nil {
+			return err
+		}
+
+		if family, ok := mf[name]; ok && family.GetType() == dto.MetricType_COUNTER {
+			if m := findMetric(family, labels, ""); m != nil {
+				m.GetCounter().Exemplar = exemplar
+			}
+			continue
+		}
+
+		family, ok := mf[strings.TrimSuffix(name, "_bucket")]
+		if !ok || !strings.HasSuffix(name, "_bucket") || family.GetType() != dto.MetricType_HISTOGRAM {
+			continue
+		}
+		upperBound, err := strconv.ParseFloat(labels["le"], 64)
+		if err != nil {
+			return fmt.Errorf("invalid openmetrics bucket: %q", sample.series)
+		}
+		m := findMetric(family, labels, "le")
+		for _, bucket := range m.GetHistogram().GetBucket() {
+			if bucket.GetUpperBound() == upperBound {
+				bucket.Exemplar = exemplar
+			}
+		}
+	}
+	return nil
+}
+
+// findMetric returns the metric of the family with the labels, apart from the ignored one.
+func findMetric(family *dto.MetricFamily, labels map[string]string, ignored string) *dto.Metric {
+	want := len(labels)
+	if _, ok := labels[ignored]; ok {
+		want--
+	}
+
+	for _, m := range family.GetMetric() {
+		if len(m.GetLabel()) != want {
+			continue
+		}
+		match := true
+		for _, l := range m.GetLabel() {
+			if value, ok := labels[l.GetName()]; !ok || value != l.GetValue() || l.GetName() == ignored {
+				match = false
+				break
+			}
+		}
+		if match {
+			return m
+		}
+	}
+	return nil
+}
+
+// parseSeries parses the metric name and label set of a sample with the text parser.
+func parseSeries(series string) (string, map[string]string, error) {
+	var parser expfmt.TextParser
+	mf, err := parser.TextToMetricFamilies(strings.NewReader(series + " 0\n"))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid openmetrics series %q: %w", series, err)
+	}
+
+	for name, family := range mf {
+		labels := make(map[string]string, len(family.GetMetric()[0].GetLabel()))
+		for _, l := range family.GetMetric()[0].GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		return name, labels, nil
+	}
+	return "", nil, fmt.Errorf("invalid openmetrics series %q", series)
+}
+
+// parseExemplar parses the label set, value and optional timestamp in seconds of an exemplar.
+func parseExemplar(s string) (*dto.Exemplar, error) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, fmt.Errorf("invalid openmetrics exemplar: %q", s)
+	}
+	end, err := labelsEnd(s, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, labels, err := parseSeries("exemplar" + s[:end+1])
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(s[end+1:])
+	if len(fields) != 1 && len(fields) != 2 {
+		return nil, fmt.Errorf("invalid openmetrics exemplar: %q", s)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid openmetrics exemplar value: %q", s)
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	exemplar := &dto.Exemplar{Value: proto.Float64(value)}
+	for _, name := range names {
+		exemplar.Label = append(exemplar.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(labels[name])})
+	}
+	if len(fields) == 2 {
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid openmetrics exemplar timestamp: %q", s)
+		}
+		exemplar.Timestamp = timestamppb.New(time.UnixMilli(int64(ts * 1000)))
+	}
+	return exemplar, nil
+}
+
+// labelsEnd returns the index of the brace closing the label set opened at start.
+func labelsEnd(line string, start int) (int, error) {
+	quoted := false
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case '}':
+			if !quoted {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated label set: %q", line)
+}
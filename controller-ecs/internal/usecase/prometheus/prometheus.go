@@ -1,7 +1,10 @@
 package prometheus
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"runner-controller-ecs/internal/domain/model"
 	"runner-controller-ecs/internal/usecase"
 	"strings"
@@ -13,6 +16,14 @@ import (
 
 type prometheusUC struct{}
 
+// AcceptHeader negotiates the exposition format with exporters,
+// preferring protobuf over OpenMetrics over the text format.
+const AcceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=1,` +
+	`application/openmetrics-text;version=1.0.0;q=0.8,` +
+	`application/openmetrics-text;version=0.0.1;q=0.75,` +
+	`text/plain;version=0.0.4;q=0.5,` +
+	`*/*;q=0.1`
+
 func NewPrometheusUC() usecase.IPrometheusUC {
 	return &prometheusUC{}
 }
@@ -50,37 +61,94 @@ func (c *prometheusUC) ConvertToMap(readers map[string]io.Reader) (map[string]mo
 
 	resMap := make(map[string]model.Metrics)
 	for name, mf := range mfs {
-		res := make(model.Metrics)
-		res["timestamp"] = float64(time.Now().Unix())
-		for k, v := range mf {
-			if k == "ecs_cpu_seconds_total" {
-				sum := 0.0
-				counter := 0
-				skip := true
-				for _, m := range v.Metric {
-					for _, l := range m.Label {
-						if *l.Name == "container" && *l.Value == "github-runner" {
-							skip = false
-							break
-						}
-					}
-					if skip {
-						continue
-					}
-					sum += m.GetCounter().GetValue()
-					counter++
-				}
-				if counter > 0 {
-					res[k] = sum / float64(counter)
-				} else {
-					res[k] = 0
-				}
-			}
+		resMap[name] = c.toMetrics(mf)
+	}
+	return resMap, nil
+}
+
+// Parse decodes a single exposition of the given Content-Type and flattens it into
+// runner metrics, so that a malformed payload only affects the runner it was scraped from.
+func (c *prometheusUC) Parse(reader io.Reader, contentType string) (model.Metrics, error) {
+	mf, err := decode(reader, contentType)
+	if err != nil {
+		return nil, err
+	}
+	return c.toMetrics(mf), nil
+}
+
+// decode reads the metric families of an exposition of the given Content-Type.
+func decode(reader io.Reader, contentType string) (map[string]*dto.MetricFamily, error) {
+	format, err := responseFormat(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	// expfmt has no OpenMetrics decoder, so the exposition is decoded as text and its exemplars attached after
+	var exemplars []exemplarSample
+	if format.FormatType() == expfmt.TypeOpenMetrics {
+		reader, exemplars, err = openMetricsToText(reader)
+		if err != nil {
+			return nil, err
+		}
+		format = expfmt.NewFormat(expfmt.TypeTextPlain)
+	}
+
+	mf := make(map[string]*dto.MetricFamily)
+	decoder := expfmt.NewDecoder(reader, format)
+	for {
+		family := &dto.MetricFamily{}
+		err := decoder.Decode(family)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		mf[family.GetName()] = family
+	}
+
+	if err = attachExemplars(mf, exemplars); err != nil {
+		return nil, err
+	}
+	return mf, nil
+}
+
+// responseFormat resolves the exposition format from the Content-Type of a scrape response.
+// A missing Content-Type is treated as the text format, as that is what older exporters send.
+func responseFormat(contentType string) (expfmt.Format, error) {
+	if contentType == "" {
+		return expfmt.NewFormat(expfmt.TypeTextPlain), nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+
+	switch mediaType {
+	case expfmt.ProtoType:
+		if params["proto"] != expfmt.ProtoProtocol || params["encoding"] != "delimited" {
+			return "", fmt.Errorf("unsupported protobuf exposition %q", contentType)
+		}
+		return expfmt.NewFormat(expfmt.TypeProtoDelim), nil
+	case expfmt.OpenMetricsType:
+		return expfmt.NewFormat(expfmt.TypeOpenMetrics), nil
+	case "text/plain":
+		return expfmt.NewFormat(expfmt.TypeTextPlain), nil
+	default:
+		return "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+func (c *prometheusUC) toMetrics(mf map[string]*dto.MetricFamily) model.Metrics {
+	res := make(model.Metrics)
+	res["timestamp"] = float64(time.Now().Unix())
+	for k, v := range mf {
+		if k == "ecs_cpu_seconds_total" {
+			sum := 0.0
+			counter := 0
+			skip := true
 			for _, m := range v.Metric {
-				if k == "ecs_cpu_seconds_total" {
-					continue
-				}
-				skip := true
 				for _, l := range m.Label {
 					if *l.Name == "container" && *l.Value == "github-runner" {
 						skip = false
@@ -90,19 +158,40 @@ func (c *prometheusUC) ConvertToMap(readers map[string]io.Reader) (map[string]mo
 				if skip {
 					continue
 				}
-
-				switch v.GetType() {
-				case dto.MetricType_GAUGE:
-					res[k] = m.GetGauge().GetValue()
-				case dto.MetricType_COUNTER:
-					res[k] = m.GetCounter().GetValue()
-				default:
+				sum += m.GetCounter().GetValue()
+				counter++
+			}
+			if counter > 0 {
+				res[k] = sum / float64(counter)
+			} else {
+				res[k] = 0
+			}
+		}
+		for _, m := range v.Metric {
+			if k == "ecs_cpu_seconds_total" {
+				continue
+			}
+			skip := true
+			for _, l := range m.Label {
+				if *l.Name == "container" && *l.Value == "github-runner" {
+					skip = false
+					break
 				}
 			}
+			if skip {
+				continue
+			}
+
+			switch v.GetType() {
+			case dto.MetricType_GAUGE:
+				res[k] = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				res[k] = m.GetCounter().GetValue()
+			default:
+			}
 		}
-		resMap[name] = res
 	}
-	return resMap, nil
+	return res
 }
 
 func (c *prometheusUC) Combine(readers map[string]io.Reader) (string, error) {
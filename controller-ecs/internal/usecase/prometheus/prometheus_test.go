@@ -0,0 +1,210 @@
+package prometheus
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	textContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	protoContentType       = "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited"
+)
+
+func decodeFixture(t *testing.T, name, contentType string) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	mf, err := decode(f, contentType)
+	if err != nil {
+		t.Fatalf("decode %s: %s", name, err)
+	}
+	return mf
+}
+
+func familyText(t *testing.T, family *dto.MetricFamily) string {
+	t.Helper()
+
+	b := new(strings.Builder)
+	if _, err := expfmt.MetricFamilyToText(b, family); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestDecodeText(t *testing.T) {
+	mf := decodeFixture(t, "runner.prom", textContentType)
+
+	counter := mf["ecs_cpu_seconds_total"]
+	if counter.GetType() != dto.MetricType_COUNTER || len(counter.Metric) != 2 {
+		t.Fatalf("unexpected counter: %v", counter)
+	}
+
+	histogram := mf["job_duration_seconds"].GetMetric()[0].GetHistogram()
+	if histogram.GetSampleCount() != 6 || histogram.GetSampleSum() != 42.5 {
+		t.Fatalf("unexpected histogram: %v", histogram)
+	}
+	if buckets := histogram.GetBucket(); len(buckets) < 2 || buckets[1].GetUpperBound() != 10 || buckets[1].GetCumulativeCount() != 5 {
+		t.Fatalf("unexpected histogram buckets: %v", buckets)
+	}
+
+	summary := mf["request_latency_seconds"].GetMetric()[0].GetSummary()
+	if summary.GetSampleCount() != 40 || len(summary.GetQuantile()) != 2 || summary.GetQuantile()[1].GetValue() != 1.5 {
+		t.Fatalf("unexpected summary: %v", summary)
+	}
+}
+
+// TestDecodeFormats checks that the counters, gauges, histograms and summaries of the same exposition
+// decode to the same families whatever the format the exporter serves.
+func TestDecodeFormats(t *testing.T) {
+	want := decodeFixture(t, "runner.prom", textContentType)
+
+	formats := map[string]map[string]*dto.MetricFamily{
+		"openmetrics": decodeFixture(t, "runner.om.txt", openMetricsContentType),
+		"protobuf":    decodeFixture(t, "runner.pb", protoContentType),
+	}
+
+	for format, got := range formats {
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d families, want %d", format, len(got), len(want))
+		}
+		for name, family := range want {
+			if _, ok := got[name]; !ok {
+				t.Errorf("%s: family %s missing", format, name)
+				continue
+			}
+			if g, w := familyText(t, got[name]), familyText(t, family); g != w {
+				t.Errorf("%s: family %s\ngot:\n%s\nwant:\n%s", format, name, g, w)
+			}
+		}
+	}
+}
+
+// TestDecodeExemplars checks that the exemplars of the counters and histogram buckets, which the text
+// format does not carry, are decoded from the OpenMetrics and protobuf expositions alike.
+func TestDecodeExemplars(t *testing.T) {
+	openMetrics := decodeFixture(t, "runner.om.txt", openMetricsContentType)
+	protobuf := decodeFixture(t, "runner.pb", protoContentType)
+
+	for name, want := range protobuf {
+		if got := openMetrics[name]; !proto.Equal(got, want) {
+			t.Errorf("family %s\ngot:  %v\nwant: %v", name, got, want)
+		}
+	}
+
+	counter := openMetrics["ecs_cpu_seconds_total"].GetMetric()[0].GetCounter().GetExemplar()
+	if counter.GetValue() != 0.5 || counter.GetLabel()[0].GetValue() != "4bf92f3577b34da6" || counter.GetTimestamp().GetSeconds() != 1700000000 {
+		t.Errorf("unexpected counter exemplar: %v", counter)
+	}
+	bucket := openMetrics["job_duration_seconds"].GetMetric()[0].GetHistogram().GetBucket()[0].GetExemplar()
+	if bucket.GetValue() != 0.7 || bucket.GetLabel()[0].GetValue() != "00f067aa0ba902b7" {
+		t.Errorf("unexpected bucket exemplar: %v", bucket)
+	}
+	if exemplar := openMetrics["job_duration_seconds"].GetMetric()[0].GetHistogram().GetBucket()[1].GetExemplar(); exemplar != nil {
+		t.Errorf("unexpected exemplar on a bucket without one: %v", exemplar)
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	uc := &prometheusUC{}
+
+	fixtures := map[string]string{
+		"runner.prom":   textContentType,
+		"runner.om.txt": openMetricsContentType,
+		"runner.pb":     protoContentType,
+	}
+
+	for name, contentType := range fixtures {
+		f, err := os.Open(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics, err := uc.Parse(f, contentType)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if got := metrics["ecs_cpu_seconds_total"]; got != 10 {
+			t.Errorf("%s: ecs_cpu_seconds_total = %v, want the average of 10", name, got)
+		}
+		if got := metrics["ecs_memory_bytes"]; got != 524288000 {
+			t.Errorf("%s: ecs_memory_bytes = %v, want 524288000", name, got)
+		}
+	}
+}
+
+func TestOpenMetricsToText(t *testing.T) {
+	tests := map[string]struct {
+		in        string
+		want      string
+		exemplars []exemplarSample
+	}{
+		"timestamp in seconds": {
+			in:   "# TYPE up gauge\nup 1 1700000000.5\n# EOF\n",
+			want: "# TYPE up gauge\nup 1 1700000000500\n",
+		},
+		"exemplar and created": {
+			in: "# TYPE requests counter\nrequests_total{code=\"200\"} 3 # {trace_id=\"a b\"} 1\n" +
+				"requests_created{code=\"200\"} 1.7e+09\n# EOF\n",
+			want:      "# TYPE requests_total counter\nrequests_total{code=\"200\"} 3\n",
+			exemplars: []exemplarSample{{series: "requests_total{code=\"200\"}", exemplar: "{trace_id=\"a b\"} 1"}},
+		},
+		"braces in label values": {
+			in:   "# TYPE info_value gauge\ninfo_value{path=\"/a}b\"} 2\n# EOF\n",
+			want: "# TYPE info_value gauge\ninfo_value{path=\"/a}b\"} 2\n",
+		},
+		"help before type": {
+			in:   "# HELP requests Requests served.\n# UNIT requests requests\n# TYPE requests counter\nrequests_total 3\n# EOF\n",
+			want: "# TYPE requests_total counter\n# HELP requests_total Requests served.\nrequests_total 3\n",
+		},
+		"help without type": {
+			in:   "# HELP requests Requests served.\nrequests 3\n# HELP other Other.\n# EOF\n",
+			want: "# HELP requests Requests served.\nrequests 3\n# HELP other Other.\n",
+		},
+	}
+
+	for name, tt := range tests {
+		r, exemplars, err := openMetricsToText(strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", name, got, tt.want)
+		}
+		if !reflect.DeepEqual(exemplars, tt.exemplars) {
+			t.Errorf("%s: got exemplars %q, want %q", name, exemplars, tt.exemplars)
+		}
+	}
+}
+
+func TestDecodeOpenMetricsHelp(t *testing.T) {
+	mf := decodeFixture(t, "runner.om.txt", openMetricsContentType)
+
+	for name, help := range map[string]string{
+		"ecs_cpu_seconds_total": "CPU time used by the container.",
+		"ecs_memory_bytes":      "Memory used by the container.",
+		"job_duration_seconds":  "Duration of the job steps.",
+	} {
+		if got := mf[name].GetHelp(); got != help {
+			t.Errorf("help of %s: got %q, want %q", name, got, help)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/usecase"
+	"runner-controller-ecs/internal/usecase/prometheus"
+	"sync"
+	"time"
+)
+
+const (
+	MaxConcurrentScrapes = 8
+	ScrapeTimeout        = 5 * time.Second
+	BackoffBase          = 2 * time.Second
+	BackoffMax           = 2 * time.Minute
+)
+
+type ScraperUC struct {
+	promUC usecase.IPrometheusUC
+	client *http.Client
+
+	mu      sync.Mutex
+	targets map[string]*targetState
+}
+
+// targetState keeps the consecutive failure count of a single target
+// and the earliest time it may be scraped again.
+type targetState struct {
+	failures    int
+	nextAttempt time.Time
+}
+
+func NewScraperUC(promUC usecase.IPrometheusUC) usecase.IScraperUC {
+	return &ScraperUC{
+		promUC:  promUC,
+		client:  &http.Client{},
+		targets: make(map[string]*targetState),
+	}
+}
+
+// Scrape fetches all targets concurrently, at most MaxConcurrentScrapes at a time.
+// Targets that are backing off after previous failures are not requested
+// and reported with TargetHealthBackoff.
+func (c *ScraperUC) Scrape(ctx context.Context, targets []*model.ScrapeTarget) map[string]*model.ScrapeResult {
+	c.forgetMissing(targets)
+
+	results := make(map[string]*model.ScrapeResult, len(targets))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, MaxConcurrentScrapes)
+
+	for _, target := range targets {
+		if failures, wait := c.backoff(target.Name); wait > 0 {
+			// The goroutines of the previous targets are already writing their results
+			resultsMu.Lock()
+			results[target.Name] = &model.ScrapeResult{
+				Health:   model.TargetHealthBackoff,
+				Err:      fmt.Errorf("backing off for %s", wait.Round(time.Second)),
+				Failures: failures,
+			}
+			resultsMu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(target *model.ScrapeTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := c.scrapeTarget(ctx, target)
+			res.Failures = c.record(target.Name, res.Health)
+
+			resultsMu.Lock()
+			results[target.Name] = res
+			resultsMu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (c *ScraperUC) scrapeTarget(ctx context.Context, target *model.ScrapeTarget) *model.ScrapeResult {
+	ctx, cancel := context.WithTimeout(ctx, ScrapeTimeout)
+	defer cancel()
+
+	res := &model.ScrapeResult{ScrapedAt: time.Now()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		res.Health = model.TargetHealthDown
+		res.Err = err
+		return res
+	}
+	req.Header.Set("Accept", prometheus.AcceptHeader)
+
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		res.Health = model.TargetHealthDown
+		res.Err = err
+		return res
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		res.Health = model.TargetHealthDown
+		res.Err = fmt.Errorf("unexpected status code %d", rsp.StatusCode)
+		return res
+	}
+
+	// The target answered, so a parse error does not make it unhealthy.
+	res.Health = model.TargetHealthUp
+	res.Metrics, res.Err = c.promUC.Parse(rsp.Body, rsp.Header.Get("Content-Type"))
+	return res
+}
+
+func (c *ScraperUC) backoff(name string) (int, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.targets[name]
+	if !ok {
+		return 0, 0
+	}
+	return state.failures, time.Until(state.nextAttempt)
+}
+
+// record updates the backoff state of a target and returns its consecutive failure count.
+func (c *ScraperUC) record(name string, health model.TargetHealth) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if health != model.TargetHealthDown {
+		delete(c.targets, name)
+		return 0
+	}
+
+	state, ok := c.targets[name]
+	if !ok {
+		state = &targetState{}
+		c.targets[name] = state
+	}
+	state.failures++
+
+	delay := BackoffMax
+	if shift := state.failures - 1; shift < 16 {
+		delay = BackoffBase << shift
+	}
+	if delay > BackoffMax {
+		delay = BackoffMax
+	}
+	state.nextAttempt = time.Now().Add(delay)
+
+	return state.failures
+}
+
+// forgetMissing drops the backoff state of targets that are no longer scraped.
+func (c *ScraperUC) forgetMissing(targets []*model.ScrapeTarget) {
+	present := make(map[string]struct{}, len(targets))
+	for _, target := range targets {
+		present[target.Name] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.targets {
+		if _, ok := present[name]; !ok {
+			delete(c.targets, name)
+		}
+	}
+}
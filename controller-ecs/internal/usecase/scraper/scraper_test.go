@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/usecase/prometheus"
+	"sync/atomic"
+	"testing"
+)
+
+// testTargets starts a healthy and a failing exporter, and returns count targets of each, interleaved so that
+// the scrapes of the healthy targets run while the failing ones are handled.
+func testTargets(t *testing.T, count int) (targets []*model.ScrapeTarget, failingRequests *atomic.Int64) {
+	t.Helper()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = fmt.Fprint(w, "# TYPE ecs_memory_bytes gauge\necs_memory_bytes{container=\"github-runner\"} 1024\n")
+	}))
+	t.Cleanup(healthy.Close)
+
+	failingRequests = new(atomic.Int64)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failingRequests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	for i := 0; i < count; i++ {
+		targets = append(targets,
+			&model.ScrapeTarget{Name: fmt.Sprintf("up-%d", i), URL: healthy.URL},
+			&model.ScrapeTarget{Name: fmt.Sprintf("down-%d", i), URL: failing.URL},
+		)
+	}
+	return targets, failingRequests
+}
+
+func TestScrapeWithBackoff(t *testing.T) {
+	const count = 2 * MaxConcurrentScrapes
+	targets, failingRequests := testTargets(t, count)
+	scraper := NewScraperUC(prometheus.NewPrometheusUC())
+
+	results := scraper.Scrape(context.Background(), targets)
+	for _, target := range targets {
+		res := results[target.Name]
+		want := model.TargetHealthUp
+		if target.URL != targets[0].URL {
+			want = model.TargetHealthDown
+		}
+		if res == nil || res.Health != want {
+			t.Fatalf("first scrape of %s: got %+v, want %s", target.Name, res, want)
+		}
+	}
+	if got := failingRequests.Load(); got != count {
+		t.Fatalf("failing exporter requested %d times, want %d", got, count)
+	}
+
+	// The failing targets back off while the healthy ones are scraped again
+	for i := 0; i < 10; i++ {
+		results = scraper.Scrape(context.Background(), targets)
+		if len(results) != len(targets) {
+			t.Fatalf("got %d results, want %d", len(results), len(targets))
+		}
+		for _, target := range targets {
+			res := results[target.Name]
+			if target.URL == targets[0].URL {
+				if res.Health != model.TargetHealthUp || res.Metrics["ecs_memory_bytes"] != 1024 {
+					t.Fatalf("scrape of %s: got %+v", target.Name, res)
+				}
+				continue
+			}
+			if res.Health != model.TargetHealthBackoff || res.Failures != 1 || res.Err == nil {
+				t.Fatalf("scrape of %s: got %+v, want a backoff after one failure", target.Name, res)
+			}
+		}
+	}
+	if got := failingRequests.Load(); got != count {
+		t.Fatalf("failing exporter requested %d times while backing off, want %d", got, count)
+	}
+
+	// The backoff of a target is forgotten once it is no longer scraped
+	scraper.Scrape(context.Background(), targets[:1])
+	results = scraper.Scrape(context.Background(), targets[:2])
+	if res := results[targets[1].Name]; res.Health != model.TargetHealthDown || res.Failures != 1 {
+		t.Fatalf("scrape of %s after it was dropped: got %+v", targets[1].Name, res)
+	}
+}
@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runner-controller-ecs/internal/domain"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/usecase"
+)
+
+// FakeARNPrefix is prepended to secret names to build the ARNs of file secrets
+const FakeARNPrefix = "arn:aws:secretsmanager:local:000000000000:secret:"
+
+type fileSecretStoreUC struct {
+	secrets map[string]string
+}
+
+// NewFileSecretStoreUC reads secrets from a JSON object of names to values.
+// It is meant for tests and local development, where no AWS account is available.
+func NewFileSecretStoreUC(path string) (usecase.ISecretStoreUC, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	secrets := make(map[string]string)
+	if err = json.Unmarshal(fileBytes, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+
+	return &fileSecretStoreUC{
+		secrets: secrets,
+	}, nil
+}
+
+func (c *fileSecretStoreUC) GetSecret(name string) (*model.Secret, error) {
+	value, ok := c.secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("secret %s: %w", name, domain.ErrNotFound)
+	}
+	return &model.Secret{
+		Name:  name,
+		Value: value,
+		ARN:   FakeARNPrefix + name,
+	}, nil
+}
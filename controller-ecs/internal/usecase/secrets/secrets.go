@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/usecase"
+)
+
+// Names of the secrets the controller reads, relative to SECRETS_PREFIX
+const (
+	GithubPAT     = "github-pat"
+	BackendAPIKey = "backend-api-key"
+)
+
+const (
+	ProviderEnv            = "env"
+	ProviderSecretsManager = "secretsmanager"
+	ProviderSSM            = "ssm"
+	ProviderFile           = "file"
+
+	DefaultPrefix = "ecs-runner-manager/"
+)
+
+// NewSecretStoreUC returns the secret store selected by SECRETS_PROVIDER,
+// falling back to plain environment variables.
+func NewSecretStoreUC() (usecase.ISecretStoreUC, error) {
+	prefix, ok := os.LookupEnv("SECRETS_PREFIX")
+	if !ok {
+		prefix = DefaultPrefix
+	}
+
+	switch provider := Provider(); provider {
+	case ProviderEnv:
+		return NewEnvSecretStoreUC(), nil
+	case ProviderSecretsManager:
+		return NewSecretsManagerUC(prefix), nil
+	case ProviderSSM:
+		return NewSSMUC(prefix), nil
+	case ProviderFile:
+		return NewFileSecretStoreUC(os.Getenv("SECRETS_FILE"))
+	default:
+		return nil, fmt.Errorf("unsupported secrets provider %s", provider)
+	}
+}
+
+func Provider() string {
+	if provider := os.Getenv("SECRETS_PROVIDER"); provider != "" {
+		return provider
+	}
+	return ProviderEnv
+}
+
+type envSecretStoreUC struct{}
+
+var envVars = map[string]string{
+	GithubPAT:     "GITHUB_PAT",
+	BackendAPIKey: "BACKEND_API_KEY",
+}
+
+// NewEnvSecretStoreUC reads secrets from environment variables. Secrets loaded this way
+// have no ARN and are passed to runners as plain environment variables.
+func NewEnvSecretStoreUC() usecase.ISecretStoreUC {
+	return &envSecretStoreUC{}
+}
+
+func (c *envSecretStoreUC) GetSecret(name string) (*model.Secret, error) {
+	envVar, ok := envVars[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown secret %s", name)
+	}
+	return &model.Secret{
+		Name:  name,
+		Value: os.Getenv(envVar),
+	}, nil
+}
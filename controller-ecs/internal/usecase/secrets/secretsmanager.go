@@ -0,0 +1,48 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/usecase"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+type SecretsManagerUC struct {
+	prefix string
+	client *secretsmanager.Client
+}
+
+func NewSecretsManagerUC(prefix string) usecase.ISecretStoreUC {
+	return &SecretsManagerUC{
+		prefix: prefix,
+	}
+}
+
+func (c *SecretsManagerUC) GetSecret(name string) (*model.Secret, error) {
+	ctx := context.TODO()
+
+	if c.client == nil {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.client = secretsmanager.NewFromConfig(cfg)
+	}
+
+	out, err := c.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(c.prefix + name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s%s, %v", c.prefix, name, err)
+	}
+
+	return &model.Secret{
+		Name:  name,
+		Value: aws.ToString(out.SecretString),
+		ARN:   aws.ToString(out.ARN),
+	}, nil
+}
@@ -0,0 +1,55 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"runner-controller-ecs/internal/domain/model"
+	"runner-controller-ecs/internal/usecase"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+type SSMUC struct {
+	prefix string
+	client *ssm.Client
+}
+
+// NewSSMUC reads secrets from SecureString parameters of the SSM Parameter Store.
+func NewSSMUC(prefix string) usecase.ISecretStoreUC {
+	// Hierarchical parameter names have to be fully qualified
+	if strings.Contains(prefix, "/") && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return &SSMUC{
+		prefix: prefix,
+	}
+}
+
+func (c *SSMUC) GetSecret(name string) (*model.Secret, error) {
+	ctx := context.TODO()
+
+	if c.client == nil {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.client = ssm.NewFromConfig(cfg)
+	}
+
+	out, err := c.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(c.prefix + name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parameter %s%s, %v", c.prefix, name, err)
+	}
+
+	return &model.Secret{
+		Name:  name,
+		Value: aws.ToString(out.Parameter.Value),
+		ARN:   aws.ToString(out.Parameter.ARN),
+	}, nil
+}